@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"os"
+	"path/filepath"
+)
+
+// backupDir holds the files of backup and restore; empty disables them.
+var backupDir string
+
+// handleAdminRequest runs maintenance commands:
+//
+//	["backup", path]  - writes a consistent snapshot of the store to path
+//	["restore", path] - loads a backup into an empty store
+//
+// Paths are relative to the backup directory. Both commands need
+// authentication to be enabled, as they touch the server's filesystem.
+func handleAdminRequest(msg *Message) string {
+	var command []interface{}
+	if err := json.Unmarshal([]byte(msg.Payload), &command); err != nil {
+		return errorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	if len(command) == 0 {
+		return errorResponse("empty command")
+	}
+
+	cmd, ok := command[0].(string)
+	if !ok {
+		return errorResponse("invalid command type")
+	}
+
+	result, err := executeAdminCommand(cmd, command[1:])
+	if err != nil {
+		return errResponse(err)
+	}
+
+	data, _ := json.Marshal(result)
+	return string(data)
+}
+
+func executeAdminCommand(cmd string, args []interface{}) (interface{}, error) {
+	switch cmd {
+	case "backup":
+		path, err := adminPath(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Backup(path); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	case "restore":
+		path, err := adminPath(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Restore(path); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	default:
+		return nil, fmt.Errorf("%w: unknown command: %s", common.ErrInvalidInput, cmd)
+	}
+}
+
+// adminPath resolves the file argument of backup and restore inside the
+// backup directory, which it creates if missing.
+func adminPath(args []interface{}) (string, error) {
+	if !db.AuthEnabled() {
+		return "", fmt.Errorf("%w: backup and restore need authentication; create a user first", common.ErrForbidden)
+	}
+	if backupDir == "" {
+		return "", fmt.Errorf("%w: backup and restore are disabled: no backup directory configured", common.ErrForbidden)
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("%w: file path required", common.ErrInvalidInput)
+	}
+	path, ok := args[0].(string)
+	if !ok || !filepath.IsLocal(path) {
+		return "", fmt.Errorf("%w: invalid file path: must be relative to the backup directory, without '..'", common.ErrInvalidInput)
+	}
+	if err := os.MkdirAll(backupDir, 0o700); err != nil {
+		return "", err
+	}
+	return filepath.Join(backupDir, path), nil
+}
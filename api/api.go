@@ -1,14 +1,25 @@
 package api
 
 import (
+	"context"
+	"onql/config"
 	"onql/database"
 )
 
 var db *database.DB
 
 // SetDatabase sets the database instance for the API
+// and routes its committed changes to live subscriptions.
 func SetDatabase(database *database.DB) {
 	db = database
+	db.SetChangeListener(notifySubscriptions)
+}
+
+// SetConfig applies the server-wide query limits, cursor expiry and backup directory.
+func SetConfig(cfg *config.Config) {
+	queryTimeout, queryMaxRows, queryMaxMemory = cfg.QueryTimeout, cfg.QueryMaxRows, int64(cfg.QueryMaxMemory)
+	cursorIdle, maxCursors, maxCursorBytes = cfg.CursorIdle, cfg.CursorMax, int64(cfg.CursorMaxBytes)
+	backupDir = cfg.BackupDir
 }
 
 // Message represents an API request/response
@@ -18,10 +29,46 @@ type Message struct {
 	RID     string `json:"rid"`
 	Payload string `json:"payload"`
 	Type    string `json:"type"`
+
+	// ClientSubject is the subject of the verified TLS client certificate,
+	// empty without mutual TLS.
+	ClientSubject string `json:"-"`
+
+	// Ctx is cancelled when the request is cancelled or its connection
+	// closes. The transport may set a parent; HandleRequest replaces it.
+	Ctx context.Context `json:"-"`
+
+	// afterReply is the work deferred by the handler until the response is written.
+	afterReply []func()
+}
+
+// AfterReply defers fn until the transport has written the response, for work
+// such as pushes that must not overtake it. fn runs in its own goroutine.
+func (m *Message) AfterReply(fn func()) {
+	m.afterReply = append(m.afterReply, fn)
+}
+
+// Replied starts the work deferred by AfterReply. Transports call it after
+// writing the response.
+func (m *Message) Replied() {
+	for _, fn := range m.afterReply {
+		go fn()
+	}
+	m.afterReply = nil
 }
 
 // HandleRequest routes API requests to appropriate handlers
 func HandleRequest(msg *Message) string {
+	if msg.Target == "auth" {
+		return handleAuthRequest(msg)
+	}
+	if err := authorize(msg); err != nil {
+		return errResponse(err)
+	}
+
+	done := startRequest(msg)
+	defer done()
+
 	switch msg.Target {
 	case "database":
 		return handleDatabaseRequest(msg)
@@ -33,13 +80,52 @@ func HandleRequest(msg *Message) string {
 		return handleSchemaRequest(msg)
 	case "insert":
 		return HandleInsertRequest(msg)
+	case "upsert":
+		return HandleUpsertRequest(msg)
+	case "bulk_insert":
+		return HandleBulkInsertRequest(msg)
 	case "update":
 		return HandleUpdateRequest(msg)
 	case "delete":
 		return HandleDeleteRequest(msg)
+	case "transaction":
+		return handleTransactionRequest(msg)
 	case "stats":
 		return handleStatsRequest(msg)
+	case "admin":
+		return handleAdminRequest(msg)
+	case "changes":
+		return handleChangesRequest(msg)
+	case "subscribe":
+		return handleSubscribeRequest(msg)
+	case "unsubscribe":
+		return handleUnsubscribeRequest(msg)
+	case "user":
+		return handleUserRequest(msg)
+	case "role":
+		return handleRoleRequest(msg)
+	case "cancel":
+		return handleCancelRequest(msg)
+	case "cursor":
+		return handleCursorRequest(msg)
 	default:
-		return errorResponse("unknown target: " + msg.Target)
+		return marshal(map[string]any{"error": "unknown target: " + msg.Target, "code": CodeNotFound})
+	}
+}
+
+// CloseConnection releases per-connection API state when a client disconnects.
+// Running requests are cancelled, an open transaction is rolled back, live
+// subscriptions are removed and the user is logged out.
+func CloseConnection(connID string) {
+	cancelConnection(connID)
+	closeConnectionCursors(connID)
+
+	sessionsMu.Lock()
+	delete(sessions, connID)
+	sessionsMu.Unlock()
+
+	if tx, err := takeTransaction(connID); err == nil {
+		tx.Rollback()
 	}
+	unsubscribeConnection(connID)
 }
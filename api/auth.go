@@ -0,0 +1,278 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"onql/dsl"
+	"onql/storemanager"
+	"strings"
+	"sync"
+)
+
+// Authenticated users keyed by connection ID (Message.ID).
+var (
+	sessions   = make(map[string]string)
+	sessionsMu sync.RWMutex
+)
+
+// errAuthRequired refuses requests of connections without a user.
+var errAuthRequired = fmt.Errorf("%w: authentication required", common.ErrForbidden)
+
+// grant is a permission a request needs on a database ("*" for all of them).
+type grant struct {
+	db, perm string
+}
+
+// handleAuthRequest binds a user to the connection:
+//
+//	{"user": "alice", "password": "..."}
+//	{"logout": true}
+func handleAuthRequest(msg *Message) string {
+	var req struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+		Logout   bool   `json:"logout"`
+	}
+	if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+		return errorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	if req.Logout {
+		sessionsMu.Lock()
+		delete(sessions, msg.ID)
+		sessionsMu.Unlock()
+		return marshal(map[string]any{"data": "success", "error": ""})
+	}
+
+	if err := db.Authenticate(req.User, req.Password); err != nil {
+		return marshal(errorResult(err))
+	}
+	sessionsMu.Lock()
+	sessions[msg.ID] = req.User
+	sessionsMu.Unlock()
+	return marshal(map[string]any{"data": map[string]any{"user": req.User}, "error": ""})
+}
+
+// sessionUser returns the user bound to the connection. A connection with a
+// TLS client certificate bound to a user is authenticated as that user.
+func sessionUser(msg *Message) string {
+	sessionsMu.RLock()
+	user := sessions[msg.ID]
+	sessionsMu.RUnlock()
+	if user != "" {
+		return user
+	}
+
+	if user = db.UserBySubject(msg.ClientSubject); user != "" {
+		sessionsMu.Lock()
+		sessions[msg.ID] = user
+		sessionsMu.Unlock()
+	}
+	return user
+}
+
+// authorize checks that the connection's user may run the request. Until the
+// first user is created every request is allowed.
+func authorize(msg *Message) error {
+	if !db.AuthEnabled() {
+		return nil
+	}
+	user := sessionUser(msg)
+	if user == "" {
+		return errAuthRequired
+	}
+
+	grants, err := requiredGrants(msg, user)
+	if err != nil {
+		return err
+	}
+	for _, g := range grants {
+		if !db.Permits(user, g.db, g.perm) {
+			return fmt.Errorf("%w: %s needs %s on %s", common.ErrForbidden, msg.Target, g.perm, g.db)
+		}
+	}
+	return nil
+}
+
+// requiredGrants lists the permissions a request needs. Targets not listed
+// here are refused, so a new target must state its grants to be reachable.
+func requiredGrants(msg *Message, user string) ([]grant, error) {
+	switch msg.Target {
+	case "onql", "subscribe":
+		var req DSLRequest
+		if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+			return nil, invalidPayload(err)
+		}
+		tables, err := dsl.Tables(req.Protopass, req.Query)
+		if err != nil {
+			return nil, err
+		}
+		var grants []grant
+		for _, t := range tables {
+			dbName, _, _ := strings.Cut(t, ".")
+			grants = append(grants, grant{dbName, storemanager.PermRead})
+		}
+		return grants, nil
+
+	case "changes":
+		var req changesRequest
+		json.Unmarshal([]byte(msg.Payload), &req)
+		return []grant{{orAll(req.DB), storemanager.PermRead}}, nil
+
+	case "insert", "upsert", "update", "delete":
+		var req struct {
+			DB string `json:"db"`
+		}
+		if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+			return nil, invalidPayload(err)
+		}
+		return []grant{{orAll(req.DB), storemanager.PermWrite}}, nil
+
+	case "bulk_insert":
+		// Records may follow as NDJSON; only the leading object names the database
+		var req struct {
+			DB string `json:"db"`
+		}
+		json.NewDecoder(strings.NewReader(msg.Payload)).Decode(&req)
+		return []grant{{orAll(req.DB), storemanager.PermWrite}}, nil
+
+	case "transaction":
+		var command []json.RawMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &command); err != nil || len(command) == 0 {
+			return nil, nil // reported by the handler
+		}
+		return transactionGrants(command), nil
+
+	case "database":
+		var req DatabaseRequest
+		if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+			return nil, nil
+		}
+		var dbName string
+		if len(req.Args) > 0 {
+			json.Unmarshal(req.Args[0], &dbName)
+		}
+		switch req.Function {
+		case "GetDatabases":
+			return []grant{{"", storemanager.PermRead}}, nil
+		case "GetTables", "Get":
+			return []grant{{orAll(dbName), storemanager.PermRead}}, nil
+		case "Insert", "Update", "Delete":
+			return []grant{{orAll(dbName), storemanager.PermWrite}}, nil
+		default:
+			return []grant{{orAll(dbName), storemanager.PermSchema}}, nil
+		}
+
+	case "schema":
+		var command []interface{}
+		if err := json.Unmarshal([]byte(msg.Payload), &command); err != nil || len(command) == 0 {
+			return nil, nil
+		}
+		return schemaGrants(command), nil
+
+	case "user":
+		// Users may change their own password
+		var command []string
+		json.Unmarshal([]byte(msg.Payload), &command)
+		if len(command) == 3 && command[0] == "password" && command[1] == user {
+			return nil, nil
+		}
+		return []grant{{"*", storemanager.PermAdmin}}, nil
+
+	case "protocol":
+		return []grant{{"*", storemanager.PermProtocol}}, nil
+
+	case "stats", "admin", "role":
+		return []grant{{"*", storemanager.PermAdmin}}, nil
+
+	case "auth", "cancel", "cursor", "unsubscribe":
+		// Act only on the connection's own session, requests, cursors and subscriptions
+		return []grant{}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown target %s", common.ErrForbidden, msg.Target)
+}
+
+// transactionGrants requires write access to the database of every staged operation.
+func transactionGrants(command []json.RawMessage) []grant {
+	var cmd string
+	json.Unmarshal(command[0], &cmd)
+
+	var ops [][]json.RawMessage
+	switch cmd {
+	case "insert", "upsert", "update", "delete":
+		ops = [][]json.RawMessage{command}
+	case "exec":
+		if len(command) > 1 {
+			json.Unmarshal(command[1], &ops)
+		}
+	}
+
+	var grants []grant
+	for _, op := range ops {
+		var data struct {
+			DB string `json:"db"`
+		}
+		if len(op) > 1 {
+			json.Unmarshal(op[1], &data)
+		}
+		grants = append(grants, grant{orAll(data.DB), storemanager.PermWrite})
+	}
+	return grants
+}
+
+// schemaGrants maps schema commands to the databases they read or change.
+func schemaGrants(command []interface{}) []grant {
+	cmd, _ := command[0].(string)
+	arg := func(i int) string {
+		if i+1 < len(command) {
+			s, _ := command[i+1].(string)
+			return orAll(s)
+		}
+		return "*"
+	}
+
+	switch cmd {
+	case "databases":
+		return []grant{{"", storemanager.PermRead}}
+	case "desc":
+		if len(command) == 1 {
+			return []grant{{"", storemanager.PermRead}}
+		}
+		return []grant{{arg(0), storemanager.PermRead}}
+	case "tables":
+		return []grant{{arg(0), storemanager.PermRead}}
+	case "create", "index":
+		return []grant{{arg(1), storemanager.PermSchema}}
+	case "rename":
+		if len(command) == 4 {
+			// rename db <old> <new>
+			return []grant{{arg(1), storemanager.PermSchema}, {arg(2), storemanager.PermSchema}}
+		}
+		return []grant{{arg(1), storemanager.PermSchema}}
+	case "set":
+		var grants []grant
+		if len(command) > 1 {
+			if defs, ok := command[1].(map[string]interface{}); ok {
+				for dbName := range defs {
+					grants = append(grants, grant{dbName, storemanager.PermSchema})
+				}
+			}
+		}
+		if len(grants) == 0 {
+			grants = []grant{{"*", storemanager.PermSchema}}
+		}
+		return grants
+	default:
+		// drop, alter and anything new
+		return []grant{{arg(0), storemanager.PermSchema}}
+	}
+}
+
+// orAll returns dbName, or "*" if it is empty.
+func orAll(dbName string) string {
+	if dbName == "" {
+		return "*"
+	}
+	return dbName
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"onql/common"
+	"strings"
+)
+
+// bulkInsertData is the payload of the bulk_insert target. The records are
+// either a "records" array or, NDJSON style, one JSON object per line after
+// the line holding the other fields.
+type bulkInsertData struct {
+	DB              string           `json:"db"`
+	Table           string           `json:"table"`
+	Records         []map[string]any `json:"records"`
+	ContinueOnError bool             `json:"continue_on_error"`
+}
+
+// parseBulkInsert decodes a bulk_insert payload in either form.
+func parseBulkInsert(payload string) (bulkInsertData, error) {
+	var req bulkInsertData
+	dec := json.NewDecoder(strings.NewReader(payload))
+	if err := dec.Decode(&req); err != nil {
+		return req, err
+	}
+	for {
+		var record map[string]any
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			return req, nil
+		}
+		if err != nil {
+			return req, fmt.Errorf("%w: record %d: %v", common.ErrInvalidInput, len(req.Records), err)
+		}
+		req.Records = append(req.Records, record)
+	}
+}
+
+// HandleBulkInsertRequest inserts many records into one table in a single
+// write and reports the primary key or error of every record. Unless
+// continue_on_error is set, it stops at the first failing record; the records
+// before it are kept and the ones after it are not attempted.
+func HandleBulkInsertRequest(msg *Message) string {
+	req, err := parseBulkInsert(msg.Payload)
+	if err != nil {
+		return marshal(map[string]any{"data": nil, "error": fmt.Sprintf("invalid payload: %v", err), "code": CodeInvalidRequest})
+	}
+
+	_, finish := StartQueryTrace("bulk_insert", fmt.Sprintf("%s.%s", req.DB, req.Table), len(msg.Payload))
+
+	results, err := db.InsertMany(req.DB, req.Table, req.Records, !req.ContinueOnError)
+	if err != nil {
+		resp := marshal(errorResult(err))
+		finish(resp, err.Error())
+		return resp
+	}
+
+	rows := make([]map[string]string, len(results))
+	failed := 0
+	for i, r := range results {
+		if r.Err != nil {
+			rows[i] = map[string]string{"error": r.Err.Error(), "code": errorCode(r.Err)}
+			failed++
+		} else {
+			rows[i] = map[string]string{"id": r.PK}
+		}
+	}
+
+	resp := marshal(map[string]any{
+		"data": map[string]any{
+			"inserted": len(results) - failed,
+			"failed":   failed,
+			"results":  rows,
+		},
+		"error": "",
+	})
+	finish(resp, "")
+	return resp
+}
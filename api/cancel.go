@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"sync"
+)
+
+// In-flight requests by connection ID and RID, so that a client can cancel
+// them and a closed connection stops everything it started.
+var (
+	inflight   = make(map[string]map[string]*inflightRequest)
+	inflightMu sync.Mutex
+)
+
+type inflightRequest struct {
+	cancel context.CancelFunc
+}
+
+// startRequest replaces msg.Ctx (Background if unset) with a cancellable child
+// registered under the connection and RID. The returned func must be called
+// once the request finishes.
+func startRequest(msg *Message) func() {
+	parent := msg.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	msg.Ctx = ctx
+	req := &inflightRequest{cancel: cancel}
+
+	inflightMu.Lock()
+	reqs := inflight[msg.ID]
+	if reqs == nil {
+		reqs = make(map[string]*inflightRequest)
+		inflight[msg.ID] = reqs
+	}
+	reqs[msg.RID] = req
+	inflightMu.Unlock()
+
+	return func() {
+		cancel()
+		inflightMu.Lock()
+		// A later request may have reused the RID
+		if reqs := inflight[msg.ID]; reqs[msg.RID] == req {
+			delete(reqs, msg.RID)
+			if len(reqs) == 0 {
+				delete(inflight, msg.ID)
+			}
+		}
+		inflightMu.Unlock()
+	}
+}
+
+// handleCancelRequest cancels a request still running on the same connection:
+//
+//	{"rid": "..."}
+func handleCancelRequest(msg *Message) string {
+	var req struct {
+		RID string `json:"rid"`
+	}
+	if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+		return errorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	inflightMu.Lock()
+	r, ok := inflight[msg.ID][req.RID]
+	inflightMu.Unlock()
+	if !ok || req.RID == msg.RID {
+		return marshal(errorResult(fmt.Errorf("%w: no request %s in flight", common.ErrNotFound, req.RID)))
+	}
+	r.cancel()
+	return marshal(map[string]any{"data": "cancelled", "error": ""})
+}
+
+// cancelConnection cancels every request still running on a connection.
+func cancelConnection(connID string) {
+	inflightMu.Lock()
+	reqs := inflight[connID]
+	delete(inflight, connID)
+	inflightMu.Unlock()
+
+	for _, r := range reqs {
+		r.cancel()
+	}
+}
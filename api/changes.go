@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+)
+
+type changesRequest struct {
+	After uint64 `json:"after"`
+	Limit int    `json:"limit"`
+	DB    string `json:"db"`
+	Table string `json:"table"`
+}
+
+// handleChangesRequest reads the change log:
+//
+//	{"after": 0, "limit": 1000, "db": "", "table": ""}
+//
+// It returns the changes with a sequence number above after and "last", the
+// value of after for the next request. db and table optionally narrow the feed.
+func handleChangesRequest(msg *Message) string {
+	var req changesRequest
+	if msg.Payload != "" {
+		if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+			return marshal(errorResult(invalidPayload(err)))
+		}
+	}
+
+	changes, last, err := db.Changes(req.After, req.Limit, req.DB, req.Table)
+	if err != nil {
+		return marshal(errorResult(err))
+	}
+	return marshal(map[string]any{
+		"data":  map[string]any{"changes": changes, "last": last},
+		"error": "",
+	})
+}
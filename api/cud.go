@@ -5,13 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"onql/dsl"
-	"time"
+	"onql/storemanager"
 )
 
 type insertData struct {
-	DB      string         `json:"db"`
-	Table   string         `json:"table"`
-	Records map[string]any `json:"records"`
+	DB         string         `json:"db"`
+	Table      string         `json:"table"`
+	Records    map[string]any `json:"records"`
+	OnConflict string         `json:"on_conflict"` // error|ignore|replace|merge
 }
 
 type updateData struct {
@@ -21,6 +22,10 @@ type updateData struct {
 	Query     string         `json:"query"`
 	Ids       []string       `json:"ids"`
 	Protopass string         `json:"protopass"`
+	Returning bool           `json:"returning"`  // reply with the updated rows
+	Atomic    bool           `json:"atomic"`     // update every row or none
+	IfVersion *uint64        `json:"if_version"` // version every row must be at, if given
+	QueryLimits
 }
 
 type deleteData struct {
@@ -29,6 +34,16 @@ type deleteData struct {
 	Query     string   `json:"query"`
 	Ids       []string `json:"ids"`
 	Protopass string   `json:"protopass"`
+	Atomic    bool     `json:"atomic"`     // delete every row or none
+	IfVersion *uint64  `json:"if_version"` // version every row must be at, if given
+	QueryLimits
+}
+
+// rowWriter applies updates and deletes: the database directly, or a
+// transaction for atomic requests.
+type rowWriter interface {
+	Update(dbName, tableName, pk string, data map[string]interface{}, ifVersion *uint64) (map[string]interface{}, error)
+	Delete(dbName, tableName, pk string, ifVersion *uint64) error
 }
 
 // HandleInsert handles insert operations with records
@@ -36,110 +51,208 @@ func HandleInsert(payload string) map[string]string {
 	insData := insertData{}
 
 	if err := json.Unmarshal([]byte(payload), &insData); err != nil {
-		return map[string]string{"error": err.Error(), "data": ""}
+		return failedInsert(invalidPayload(err))
+	}
+	if insData.OnConflict != "" {
+		return upsert(insData)
 	}
 
 	id, err := db.Insert(insData.DB, insData.Table, insData.Records)
 	if err != nil {
-		return map[string]string{"error": err.Error(), "data": ""}
+		return failedInsert(err)
 	}
 
 	return map[string]string{"error": "", "data": id}
 }
 
-// HandleUpdate handles update operations with query or IDs
-func HandleUpdate(payload string) map[string]string {
-	updData := updateData{}
+// HandleUpsert handles upsert operations: an insert whose on_conflict defaults to merge.
+func HandleUpsert(payload string) map[string]string {
+	insData := insertData{}
 
-	if err := json.Unmarshal([]byte(payload), &updData); err != nil {
-		return map[string]string{"error": err.Error(), "data": ""}
+	if err := json.Unmarshal([]byte(payload), &insData); err != nil {
+		return failedInsert(invalidPayload(err))
 	}
+	if insData.OnConflict == "" {
+		insData.OnConflict = string(storemanager.ConflictMerge)
+	}
+	return upsert(insData)
+}
 
-	pks := []string{}
-
-	if updData.Query != "" {
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancel()
-		result, err := dsl.Execute(ctx, updData.Protopass, updData.Query, "", []string{})
-		if err != nil {
-			return map[string]string{"error": err.Error(), "data": ""}
-		}
+// upsert inserts the record or resolves a primary key conflict as
+// insData.OnConflict says. "op" reports what was done: insert, update or ignore.
+func upsert(insData insertData) map[string]string {
+	onConflict, err := storemanager.ParseConflictAction(insData.OnConflict)
+	if err != nil {
+		return failedInsert(err)
+	}
 
-		if result == nil {
-			pks = []string{}
-		} else {
-			var ok bool
-			pks, ok = result.([]string)
-			if !ok {
-				return map[string]string{"error": "ids not returned by query", "data": ""}
-			}
-		}
+	id, op, err := db.Upsert(insData.DB, insData.Table, insData.Records, onConflict)
+	if err != nil {
+		return failedInsert(err)
 	}
+	if op == "" {
+		op = string(storemanager.ConflictIgnore)
+	}
+
+	return map[string]string{"error": "", "data": id, "op": op}
+}
+
+// HandleUpdate handles update operations with query or IDs.
+// Rows are updated one by one; on error the rows updated before it stay
+// updated, unless the request is atomic.
+func HandleUpdate(ctx context.Context, payload string) map[string]any {
+	updData := updateData{}
 
-	if len(updData.Ids) != 0 {
-		pks = updData.Ids
+	if err := json.Unmarshal([]byte(payload), &updData); err != nil {
+		return failedWrite(invalidPayload(err))
+	}
+	if updData.Records == nil {
+		return map[string]any{"error": "update expects records", "data": "", "code": CodeInvalidRequest}
 	}
 
-	var payloadError string
-	for _, pk := range pks {
-		updData.Records["id"] = pk
-		err := db.Update(updData.DB, updData.Table, pk, updData.Records)
-		if err != nil {
-			payloadError = err.Error()
-			break
-		}
+	pks, err := resolvePks(ctx, updData.QueryLimits, updData.Query, updData.Protopass, updData.Ids)
+	if err != nil {
+		return failedWrite(err)
 	}
 
-	if payloadError != "" {
-		return map[string]string{"error": payloadError, "data": ""}
+	if !updData.Atomic {
+		done, rows, err := updateRows(db, updData, pks)
+		return writeResult(done, rows, err)
 	}
 
-	return map[string]string{"error": "", "data": "success"}
+	tx := db.Begin()
+	done, rows, err := updateRows(tx, updData, pks)
+	if err != nil {
+		tx.Rollback()
+		return writeResult(nil, nil, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return writeResult(nil, nil, err)
+	}
+	return writeResult(done, rows, nil)
 }
 
-// HandleDelete handles delete operations with query or IDs
-func HandleDelete(payload string) map[string]string {
+// HandleDelete handles delete operations with query or IDs.
+// Rows are deleted one by one; on error the rows deleted before it stay
+// deleted, unless the request is atomic.
+func HandleDelete(ctx context.Context, payload string) map[string]any {
 	delData := deleteData{}
 
 	if err := json.Unmarshal([]byte(payload), &delData); err != nil {
-		return map[string]string{"error": err.Error(), "data": ""}
+		return failedWrite(invalidPayload(err))
 	}
 
-	pks := []string{}
+	pks, err := resolvePks(ctx, delData.QueryLimits, delData.Query, delData.Protopass, delData.Ids)
+	if err != nil {
+		return failedWrite(err)
+	}
+
+	if !delData.Atomic {
+		done, err := deleteRows(db, delData, pks)
+		return writeResult(done, nil, err)
+	}
 
-	if delData.Query != "" {
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancel()
-		result, err := dsl.Execute(ctx, delData.Protopass, delData.Query, "", []string{})
+	tx := db.Begin()
+	done, err := deleteRows(tx, delData, pks)
+	if err != nil {
+		tx.Rollback()
+		return writeResult(nil, nil, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return writeResult(nil, nil, err)
+	}
+	return writeResult(done, nil, nil)
+}
+
+// updateRows updates the rows at pks through w. It returns the pks updated
+// before any error and, if updData.Returning is set, their rows as written.
+func updateRows(w rowWriter, updData updateData, pks []string) ([]string, []map[string]any, error) {
+	done := make([]string, 0, len(pks))
+	var rows []map[string]any
+	if updData.Returning {
+		rows = make([]map[string]any, 0, len(pks))
+	}
+	for _, pk := range pks {
+		updData.Records["id"] = pk
+		row, err := w.Update(updData.DB, updData.Table, pk, updData.Records, updData.IfVersion)
 		if err != nil {
-			return map[string]string{"error": err.Error(), "data": ""}
+			return done, rows, err
 		}
+		done = append(done, pk)
+		if updData.Returning {
+			rows = append(rows, row)
+		}
+	}
+	return done, rows, nil
+}
 
-		if result == nil {
-			pks = []string{}
-		} else {
-			var ok bool
-			pks, ok = result.([]string)
-			if !ok {
-				return map[string]string{"error": "ids not returned by query", "data": ""}
-			}
+// deleteRows deletes the rows at pks through w and returns the pks deleted
+// before any error.
+func deleteRows(w rowWriter, delData deleteData, pks []string) ([]string, error) {
+	done := make([]string, 0, len(pks))
+	for _, pk := range pks {
+		if err := w.Delete(delData.DB, delData.Table, pk, delData.IfVersion); err != nil {
+			return done, err
 		}
+		done = append(done, pk)
 	}
+	return done, nil
+}
 
-	if len(delData.Ids) != 0 {
-		pks = delData.Ids
+// writeResult is the response of an update or delete: the number and ids of
+// the rows written, also when err stopped it part way, and the updated rows
+// if they were asked for.
+func writeResult(pks []string, rows []map[string]any, err error) map[string]any {
+	if pks == nil {
+		pks = []string{}
 	}
+	result := map[string]any{"error": "", "data": "success", "affected": len(pks), "ids": pks}
+	if rows != nil {
+		result["rows"] = rows
+	}
+	if err != nil {
+		result["error"] = err.Error()
+		result["data"] = ""
+		result["code"] = errorCode(err)
+	}
+	return result
+}
 
-	if len(pks) != 0 {
-		for _, pk := range pks {
-			err := db.Delete(delData.DB, delData.Table, pk)
-			if err != nil {
-				return map[string]string{"error": err.Error(), "data": ""}
-			}
-		}
+// resolvePks returns the primary keys targeted by an update or delete.
+// Explicit ids take precedence over the ids returned by query.
+func resolvePks(ctx context.Context, limits QueryLimits, query, protopass string, ids []string) ([]string, error) {
+	if len(ids) != 0 {
+		return ids, nil
 	}
+	if query == "" {
+		return []string{}, nil
+	}
+
+	ctx, cancel, queryLimits := limits.apply(ctx)
+	defer cancel()
+	result, err := dsl.Execute(ctx, queryLimits, protopass, query, "", []string{}, false)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return []string{}, nil
+	}
+	pks, ok := result.([]string)
+	if !ok {
+		return nil, fmt.Errorf("ids not returned by query")
+	}
+	return pks, nil
+}
+
+// failedWrite is the response of an update or delete that failed before
+// writing a row.
+func failedWrite(err error) map[string]any {
+	return map[string]any{"error": err.Error(), "data": "", "code": errorCode(err)}
+}
 
-	return map[string]string{"error": "", "data": "success"}
+// failedInsert is the response of an insert or upsert that failed.
+func failedInsert(err error) map[string]string {
+	return map[string]string{"error": err.Error(), "data": "", "code": errorCode(err)}
 }
 
 // HandleInsertRequest handles insert API requests
@@ -152,6 +265,16 @@ func HandleInsertRequest(msg *Message) string {
 	return resp
 }
 
+// HandleUpsertRequest handles upsert API requests
+func HandleUpsertRequest(msg *Message) string {
+	_, finish := StartQueryTrace("upsert", fmt.Sprintf("%s.%s", extractField(msg.Payload, "db"), extractField(msg.Payload, "table")), len(msg.Payload))
+	result := HandleUpsert(msg.Payload)
+	data, _ := json.Marshal(result)
+	resp := string(data)
+	finish(resp, result["error"])
+	return resp
+}
+
 // HandleUpdateRequest handles update API requests
 func HandleUpdateRequest(msg *Message) string {
 	query := extractField(msg.Payload, "query")
@@ -159,10 +282,10 @@ func HandleUpdateRequest(msg *Message) string {
 		query = fmt.Sprintf("%s.%s", extractField(msg.Payload, "db"), extractField(msg.Payload, "table"))
 	}
 	_, finish := StartQueryTrace("update", query, len(msg.Payload))
-	result := HandleUpdate(msg.Payload)
+	result := HandleUpdate(msg.Ctx, msg.Payload)
 	data, _ := json.Marshal(result)
 	resp := string(data)
-	finish(resp, result["error"])
+	finish(resp, result["error"].(string))
 	return resp
 }
 
@@ -173,10 +296,10 @@ func HandleDeleteRequest(msg *Message) string {
 		query = fmt.Sprintf("%s.%s", extractField(msg.Payload, "db"), extractField(msg.Payload, "table"))
 	}
 	_, finish := StartQueryTrace("delete", query, len(msg.Payload))
-	result := HandleDelete(msg.Payload)
+	result := HandleDelete(msg.Ctx, msg.Payload)
 	data, _ := json.Marshal(result)
 	resp := string(data)
-	finish(resp, result["error"])
+	finish(resp, result["error"].(string))
 	return resp
 }
 
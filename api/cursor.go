@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Stream sends one of several response frames for a request; the response
+// HandleRequest returns is the last one. Set by the server package.
+var Stream func(connID, rid, target, payload string) bool
+
+const defaultChunkSize = 1000
+
+// cursorIdle is how long a cursor may go without a fetch before it is closed.
+var cursorIdle = 5 * time.Minute
+
+// Per connection limits on open cursors: their number, and the bytes of rows
+// they hold, measured as JSON.
+var (
+	maxCursors           = 16
+	maxCursorBytes int64 = 64 << 20
+)
+
+// Open cursors by ID. A cursor holds the complete result of a query, as the
+// evaluator cannot resume from a position, and belongs to the connection that
+// ran the query.
+var (
+	cursors   = make(map[string]*cursor)
+	cursorsMu sync.Mutex
+)
+
+type cursor struct {
+	connID   string
+	rows     []any
+	pos      int
+	size     int64 // bytes of rows, counted against maxCursorBytes
+	lastUsed time.Time
+	timer    *time.Timer
+}
+
+// resultRows returns a query result as a list of rows: a list is used as is,
+// any other value is a single row.
+func resultRows(result any) []any {
+	if result == nil {
+		return []any{}
+	}
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Slice {
+		return []any{result}
+	}
+	rows := make([]any, v.Len())
+	for i := range rows {
+		rows[i] = v.Index(i).Interface()
+	}
+	return rows
+}
+
+// streamRows sends rows in chunks of size frames under the request's RID and
+// returns the final end-of-stream response.
+func streamRows(msg *Message, rows []any, size int) (string, error) {
+	errNoConnection := fmt.Errorf("%w: streaming needs a persistent connection", common.ErrInvalidInput)
+	if Stream == nil {
+		return "", errNoConnection
+	}
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+
+	chunks := 0
+	for start := 0; start < len(rows); start += size {
+		if err := msg.Ctx.Err(); err != nil {
+			return "", err
+		}
+		end := min(start+size, len(rows))
+		chunk := marshal(map[string]any{"data": rows[start:end], "error": "", "chunk": chunks})
+		if !Stream(msg.ID, msg.RID, msg.Target, chunk) {
+			return "", errNoConnection
+		}
+		chunks++
+	}
+	return marshal(map[string]any{"data": nil, "error": "", "done": true, "rows": len(rows), "chunks": chunks}), nil
+}
+
+// openCursor keeps rows server-side for the connection and returns the cursor
+// ID. It fails if the connection would exceed maxCursors or maxCursorBytes.
+func openCursor(connID string, rows []any) (string, error) {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return "", err
+	}
+	id := uuid.NewString()
+	c := &cursor{connID: connID, rows: rows, size: int64(len(data)), lastUsed: time.Now()}
+
+	cursorsMu.Lock()
+	defer cursorsMu.Unlock()
+
+	open, size := 0, c.size
+	for _, other := range cursors {
+		if other.connID == connID {
+			open++
+			size += other.size
+		}
+	}
+	if maxCursors > 0 && open >= maxCursors {
+		return "", fmt.Errorf("%w: too many open cursors: the connection may hold %d, close one first", common.ErrInvalidInput, maxCursors)
+	}
+	if maxCursorBytes > 0 && size > maxCursorBytes {
+		return "", fmt.Errorf("%w: open cursors of the connection would hold more than %d bytes", common.ErrMemoryLimit, maxCursorBytes)
+	}
+
+	cursors[id] = c
+	c.timer = time.AfterFunc(cursorIdle, func() { expireCursor(id) })
+	return id, nil
+}
+
+// expireCursor closes the cursor if it has been idle for cursorIdle, and
+// otherwise checks again when it would be.
+func expireCursor(id string) {
+	cursorsMu.Lock()
+	defer cursorsMu.Unlock()
+
+	c, ok := cursors[id]
+	if !ok {
+		return
+	}
+	if idle := time.Since(c.lastUsed); idle < cursorIdle {
+		c.timer.Reset(cursorIdle - idle)
+		return
+	}
+	delete(cursors, id)
+}
+
+// closeCursor must be called with cursorsMu held.
+func closeCursor(id string, c *cursor) {
+	c.timer.Stop()
+	delete(cursors, id)
+}
+
+// closeConnectionCursors closes every cursor opened on a connection.
+func closeConnectionCursors(connID string) {
+	cursorsMu.Lock()
+	defer cursorsMu.Unlock()
+
+	for id, c := range cursors {
+		if c.connID == connID {
+			closeCursor(id, c)
+		}
+	}
+}
+
+// handleCursorRequest reads from a cursor opened by a DSL query with
+// "cursor": true on the same connection:
+//
+//	["fetch", id, n]   next n rows (chunk size if omitted); closes the cursor once done
+//	["close", id]      release the cursor
+func handleCursorRequest(msg *Message) string {
+	var command []any
+	if err := json.Unmarshal([]byte(msg.Payload), &command); err != nil {
+		return errorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+	if len(command) < 2 {
+		return errorResponse("invalid command")
+	}
+	action, _ := command[0].(string)
+	id, _ := command[1].(string)
+
+	cursorsMu.Lock()
+	defer cursorsMu.Unlock()
+
+	c, ok := cursors[id]
+	if !ok || c.connID != msg.ID {
+		return marshal(errorResult(fmt.Errorf("%w: no cursor %s", common.ErrNotFound, id)))
+	}
+
+	switch action {
+	case "fetch":
+		n := defaultChunkSize
+		if len(command) > 2 {
+			f, ok := command[2].(float64)
+			if !ok || f < 1 {
+				return errorResponse("fetch size must be a positive number")
+			}
+			n = int(f)
+		}
+		end := min(c.pos+n, len(c.rows))
+		rows := c.rows[c.pos:end]
+		c.pos = end
+		c.lastUsed = time.Now()
+
+		done := c.pos == len(c.rows)
+		if done {
+			closeCursor(id, c)
+		}
+		return marshal(map[string]any{
+			"data":  map[string]any{"rows": rows, "remaining": len(c.rows) - c.pos, "done": done},
+			"error": "",
+		})
+
+	case "close":
+		closeCursor(id, c)
+		return marshal(map[string]any{"data": "closed", "error": ""})
+
+	default:
+		return errorResponse(fmt.Sprintf("unknown cursor command: %s", action))
+	}
+}
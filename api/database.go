@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"onql/common"
 	"onql/storemanager"
 )
 
@@ -20,7 +21,7 @@ func handleDatabaseRequest(msg *Message) string {
 
 	result, err := callDatabaseFunc(req.Function, req.Args)
 	if err != nil {
-		return errorResponse(err.Error())
+		return errResponse(err)
 	}
 
 	data, _ := json.Marshal(result)
@@ -34,7 +35,7 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 
 	case "GetTables":
 		if len(args) != 1 {
-			return nil, fmt.Errorf("GetTables expects 1 arg")
+			return nil, fmt.Errorf("%w: GetTables expects 1 arg", common.ErrInvalidInput)
 		}
 		var dbName string
 		json.Unmarshal(args[0], &dbName)
@@ -42,7 +43,7 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 
 	case "CreateDatabase":
 		if len(args) != 1 {
-			return nil, fmt.Errorf("CreateDatabase expects 1 arg")
+			return nil, fmt.Errorf("%w: CreateDatabase expects 1 arg", common.ErrInvalidInput)
 		}
 		var name string
 		json.Unmarshal(args[0], &name)
@@ -53,7 +54,7 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 
 	case "DropDatabase":
 		if len(args) != 1 {
-			return nil, fmt.Errorf("DropDatabase expects 1 arg")
+			return nil, fmt.Errorf("%w: DropDatabase expects 1 arg", common.ErrInvalidInput)
 		}
 		var name string
 		json.Unmarshal(args[0], &name)
@@ -64,7 +65,7 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 
 	case "CreateTable":
 		if len(args) != 2 {
-			return nil, fmt.Errorf("CreateTable expects 2 args")
+			return nil, fmt.Errorf("%w: CreateTable expects 2 args", common.ErrInvalidInput)
 		}
 		var dbName string
 		var table storemanager.Table
@@ -77,7 +78,7 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 
 	case "DropTable":
 		if len(args) != 2 {
-			return nil, fmt.Errorf("DropTable expects 2 args")
+			return nil, fmt.Errorf("%w: DropTable expects 2 args", common.ErrInvalidInput)
 		}
 		var dbName, tableName string
 		json.Unmarshal(args[0], &dbName)
@@ -89,7 +90,7 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 
 	case "Insert":
 		if len(args) != 3 {
-			return nil, fmt.Errorf("Insert expects 3 args")
+			return nil, fmt.Errorf("%w: Insert expects 3 args", common.ErrInvalidInput)
 		}
 		var dbName, tableName string
 		var data map[string]interface{}
@@ -100,7 +101,7 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 
 	case "Get":
 		if len(args) != 3 {
-			return nil, fmt.Errorf("Get expects 3 args")
+			return nil, fmt.Errorf("%w: Get expects 3 args", common.ErrInvalidInput)
 		}
 		var dbName, tableName, pk string
 		json.Unmarshal(args[0], &dbName)
@@ -110,7 +111,7 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 
 	case "Update":
 		if len(args) != 4 {
-			return nil, fmt.Errorf("Update expects 4 args")
+			return nil, fmt.Errorf("%w: Update expects 4 args", common.ErrInvalidInput)
 		}
 		var dbName, tableName, pk string
 		var data map[string]interface{}
@@ -118,25 +119,25 @@ func callDatabaseFunc(name string, args []json.RawMessage) (any, error) {
 		json.Unmarshal(args[1], &tableName)
 		json.Unmarshal(args[2], &pk)
 		json.Unmarshal(args[3], &data)
-		if err := db.Update(dbName, tableName, pk, data); err != nil {
+		if _, err := db.Update(dbName, tableName, pk, data, nil); err != nil {
 			return nil, err
 		}
 		return "success", nil
 
 	case "Delete":
 		if len(args) != 3 {
-			return nil, fmt.Errorf("Delete expects 3 args")
+			return nil, fmt.Errorf("%w: Delete expects 3 args", common.ErrInvalidInput)
 		}
 		var dbName, tableName, pk string
 		json.Unmarshal(args[0], &dbName)
 		json.Unmarshal(args[1], &tableName)
 		json.Unmarshal(args[2], &pk)
-		if err := db.Delete(dbName, tableName, pk); err != nil {
+		if err := db.Delete(dbName, tableName, pk, nil); err != nil {
 			return nil, err
 		}
 		return "success", nil
 
 	default:
-		return nil, fmt.Errorf("function %q not found", name)
+		return nil, fmt.Errorf("function %q %w", name, common.ErrNotFound)
 	}
 }
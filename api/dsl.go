@@ -1,11 +1,9 @@
 package api
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"onql/dsl"
-	"time"
 )
 
 // DSLRequest represents a DSL query request
@@ -14,6 +12,17 @@ type DSLRequest struct {
 	Query     string   `json:"query"`
 	CtxKey    string   `json:"ctxkey"`
 	CtxValues []string `json:"ctxvalues"`
+	QueryLimits
+
+	// Stream sends the result in frames of ChunkSize rows under the request's
+	// RID, followed by an end-of-stream response. Cursor instead keeps the
+	// result server-side to be read with the "cursor" target.
+	Stream    bool `json:"stream"`
+	ChunkSize int  `json:"chunk_size"`
+	Cursor    bool `json:"cursor"`
+
+	// Versions adds each row's version as "_version" to the rows read from tables.
+	Versions bool `json:"versions"`
 }
 
 func handleDSLRequest(msg *Message) string {
@@ -24,20 +33,35 @@ func handleDSLRequest(msg *Message) string {
 
 	_, finish := StartQueryTrace("onql", req.Query, len(msg.Payload))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel, limits := req.apply(msg.Ctx)
 	defer cancel()
 
-	result, err := dsl.Execute(ctx, req.Protopass, req.Query, req.CtxKey, req.CtxValues)
+	result, err := dsl.Execute(ctx, limits, req.Protopass, req.Query, req.CtxKey, req.CtxValues, req.Versions)
+	if err == nil && req.Stream {
+		var resp string
+		if resp, err = streamRows(msg, resultRows(result), req.ChunkSize); err == nil {
+			finish(resp, "")
+			return resp
+		}
+	}
 
 	response := map[string]interface{}{
 		"data":  result,
 		"error": "",
 	}
+	if err == nil && req.Cursor {
+		rows := resultRows(result)
+		var id string
+		if id, err = openCursor(msg.ID, rows); err == nil {
+			response["data"] = map[string]any{"cursor": id, "rows": len(rows)}
+		}
+	}
 	errMsg := ""
 	if err != nil {
 		errMsg = err.Error()
 		response["error"] = errMsg
 		response["data"] = nil
+		response["code"] = errorCode(err)
 	}
 
 	data, _ := json.Marshal(response)
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"onql/common"
+	"onql/dsl"
+	"time"
+)
+
+// Server-wide query limits; zero means no limit.
+var (
+	queryTimeout   = 60 * time.Second
+	queryMaxRows   int
+	queryMaxMemory int64
+)
+
+// QueryLimits are the optional per-request limits of a DSL query. They can
+// only tighten the server-wide limits.
+type QueryLimits struct {
+	TimeoutMs      int64 `json:"timeout_ms"`
+	MaxRows        int   `json:"max_rows"`
+	MaxMemoryBytes int64 `json:"max_memory_bytes"`
+}
+
+// apply derives a context with the effective timeout from ctx and returns the
+// effective row and memory limits.
+func (l QueryLimits) apply(ctx context.Context) (context.Context, context.CancelFunc, *dsl.Limits) {
+	limits := &dsl.Limits{
+		MaxRows:        capLimit(l.MaxRows, queryMaxRows),
+		MaxMemoryBytes: capLimit(l.MaxMemoryBytes, queryMaxMemory),
+	}
+	if timeout := capLimit(time.Duration(l.TimeoutMs)*time.Millisecond, queryTimeout); timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		return ctx, cancel, limits
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, cancel, limits
+}
+
+// capLimit returns the smaller of requested and max, ignoring either one
+// that is not positive.
+func capLimit[T ~int | ~int64](requested, max T) T {
+	if requested <= 0 || (max > 0 && requested > max) {
+		return max
+	}
+	return requested
+}
+
+// Machine-readable codes of errors, sent as "code" next to every "error".
+const (
+	CodeTimeout         = "QUERY_TIMEOUT"
+	CodeCancelled       = "QUERY_CANCELLED"
+	CodeRowLimit        = "ROW_LIMIT_EXCEEDED"
+	CodeMemoryLimit     = "MEMORY_LIMIT_EXCEEDED"
+	CodeVersionConflict = "VERSION_CONFLICT"
+	CodeUnauthorized    = "UNAUTHORIZED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeChangesTrimmed  = "CHANGES_TRIMMED"
+	CodeInvalidRequest  = "INVALID_REQUEST"
+	CodeFailed          = "REQUEST_FAILED"
+)
+
+// errorCode returns the code of an error: CodeFailed if no other applies, or
+// "" for a nil error.
+func errorCode(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCancelled
+	case errors.Is(err, common.ErrRowLimit):
+		return CodeRowLimit
+	case errors.Is(err, common.ErrMemoryLimit):
+		return CodeMemoryLimit
+	case errors.Is(err, common.ErrVersionConflict):
+		return CodeVersionConflict
+	case errors.Is(err, common.ErrUnauthorized), errors.Is(err, errAuthRequired):
+		return CodeUnauthorized
+	case errors.Is(err, common.ErrForbidden):
+		return CodeForbidden
+	case errors.Is(err, common.ErrNotFound):
+		return CodeNotFound
+	case errors.Is(err, common.ErrDuplicate), errors.Is(err, common.ErrDatabaseExists),
+		errors.Is(err, common.ErrTableExists), errors.Is(err, common.ErrConflict):
+		return CodeConflict
+	case errors.Is(err, common.ErrChangesTrimmed):
+		return CodeChangesTrimmed
+	case errors.Is(err, common.ErrInvalidInput):
+		return CodeInvalidRequest
+	}
+	return CodeFailed
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"onql/common"
 	"onql/storemanager"
 )
 
@@ -23,7 +24,7 @@ func handleProtocolRequest(msg *Message) string {
 
 	result, err := executeProtocolCommand(cmd, command[1:])
 	if err != nil {
-		return errorResponse(err.Error())
+		return errResponse(err)
 	}
 
 	data, _ := json.Marshal(result)
@@ -38,24 +39,27 @@ func executeProtocolCommand(cmd string, args []interface{}) (interface{}, error)
 		return setProtocol(args)
 	case "drop":
 		return dropProtocol(args)
+	case "rotate":
+		return rotateProtocol(args)
 	default:
-		return nil, fmt.Errorf("unknown command: %s", cmd)
+		return nil, fmt.Errorf("%w: unknown command: %s", common.ErrInvalidInput, cmd)
 	}
 }
 
+// descProtocols lists protocols by name. Secrets are never returned.
 func descProtocols(args []interface{}) (interface{}, error) {
-	passwords, err := db.GetAllProtocols()
+	names, err := db.GetAllProtocols()
 	if err != nil {
 		return nil, err
 	}
 
 	protocols := make(map[string]interface{})
-	for _, password := range passwords {
-		proto, err := db.GetProtocol(password)
+	for _, name := range names {
+		proto, err := db.GetProtocolByName(name)
 		if err != nil {
 			continue
 		}
-		protocols[password] = proto
+		protocols[name] = proto
 	}
 
 	// Navigate through args if provided
@@ -63,14 +67,14 @@ func descProtocols(args []interface{}) (interface{}, error) {
 	for _, key := range args {
 		keyStr, ok := key.(string)
 		if !ok {
-			return nil, fmt.Errorf("invalid key type")
+			return nil, fmt.Errorf("%w: invalid key type", common.ErrInvalidInput)
 		}
 
 		if m, ok := current.(map[string]interface{}); ok {
 			if val, exists := m[keyStr]; exists {
 				current = val
 			} else {
-				return nil, fmt.Errorf("protocol not found: %s", keyStr)
+				return nil, fmt.Errorf("protocol %w: %s", common.ErrNotFound, keyStr)
 			}
 		}
 	}
@@ -78,14 +82,23 @@ func descProtocols(args []interface{}) (interface{}, error) {
 	return current, nil
 }
 
+// setProtocol handles ["set", name, data] and ["set", name, data, secret].
+// A new protocol needs a secret; without one an existing protocol keeps its own.
 func setProtocol(args []interface{}) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, fmt.Errorf("set expects 2 args (password, data)")
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("%w: set expects 2 or 3 args (name, data, secret)", common.ErrInvalidInput)
 	}
 
-	password, ok := args[0].(string)
+	name, ok := args[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid password type")
+		return nil, fmt.Errorf("%w: invalid name type", common.ErrInvalidInput)
+	}
+
+	var secret string
+	if len(args) == 3 {
+		if secret, ok = args[2].(string); !ok {
+			return nil, fmt.Errorf("%w: invalid secret type", common.ErrInvalidInput)
+		}
 	}
 
 	dataBytes, _ := json.Marshal(args[1])
@@ -94,7 +107,7 @@ func setProtocol(args []interface{}) (interface{}, error) {
 		return nil, err
 	}
 
-	if err := db.SetProtocol(password, protocol); err != nil {
+	if err := db.SetProtocol(name, secret, protocol); err != nil {
 		return nil, err
 	}
 
@@ -103,17 +116,44 @@ func setProtocol(args []interface{}) (interface{}, error) {
 
 func dropProtocol(args []interface{}) (interface{}, error) {
 	if len(args) != 1 {
-		return nil, fmt.Errorf("drop expects 1 arg (password)")
+		return nil, fmt.Errorf("%w: drop expects 1 arg (name)", common.ErrInvalidInput)
 	}
 
-	password, ok := args[0].(string)
+	name, ok := args[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid password type")
+		return nil, fmt.Errorf("%w: invalid name type", common.ErrInvalidInput)
 	}
 
-	if err := db.DeleteProtocol(password); err != nil {
+	if err := db.DeleteProtocol(name); err != nil {
 		return nil, err
 	}
 
 	return "success", nil
 }
+
+// rotateProtocol handles ["rotate", name] and ["rotate", name, secret]. The
+// new secret, random unless given, is only ever returned here.
+func rotateProtocol(args []interface{}) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("%w: rotate expects 1 or 2 args (name, secret)", common.ErrInvalidInput)
+	}
+
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid name type", common.ErrInvalidInput)
+	}
+
+	var secret string
+	if len(args) == 2 {
+		if secret, ok = args[1].(string); !ok {
+			return nil, fmt.Errorf("%w: invalid secret type", common.ErrInvalidInput)
+		}
+	}
+
+	secret, err := db.RotateProtocolSecret(name, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"name": name, "secret": secret}, nil
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"onql/common"
 	"onql/storemanager"
 	"strings"
 )
@@ -24,7 +25,7 @@ func handleSchemaRequest(msg *Message) string {
 
 	result, err := executeSchemaCommand(cmd, command[1:])
 	if err != nil {
-		return errorResponse(err.Error())
+		return errResponse(err)
 	}
 
 	data, _ := json.Marshal(result)
@@ -49,8 +50,10 @@ func executeSchemaCommand(cmd string, args []interface{}) (interface{}, error) {
 		return alterSchema(args)
 	case "rename":
 		return renameSchema(args)
+	case "index":
+		return indexSchema(args)
 	default:
-		return nil, fmt.Errorf("unknown command: %s", cmd)
+		return nil, fmt.Errorf("%w: unknown command: %s", common.ErrInvalidInput, cmd)
 	}
 }
 
@@ -61,7 +64,7 @@ func descSchema(args []interface{}) (interface{}, error) {
 
 	dbName, ok := args[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid database name")
+		return nil, fmt.Errorf("%w: invalid database name", common.ErrInvalidInput)
 	}
 
 	if len(args) == 1 {
@@ -70,7 +73,7 @@ func descSchema(args []interface{}) (interface{}, error) {
 
 	tableName, ok := args[1].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid table name")
+		return nil, fmt.Errorf("%w: invalid table name", common.ErrInvalidInput)
 	}
 
 	return db.GetTableSchema(dbName, tableName)
@@ -82,29 +85,29 @@ func listDatabases(args []interface{}) (interface{}, error) {
 
 func listTables(args []interface{}) (interface{}, error) {
 	if len(args) < 1 {
-		return nil, fmt.Errorf("tables command expects database name")
+		return nil, fmt.Errorf("%w: tables command expects database name", common.ErrInvalidInput)
 	}
 	dbName, ok := args[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid database name")
+		return nil, fmt.Errorf("%w: invalid database name", common.ErrInvalidInput)
 	}
 	return db.FetchTables(dbName)
 }
 
 func createSchema(args []interface{}) (interface{}, error) {
 	if len(args) < 2 {
-		return nil, fmt.Errorf("create expects type and name/def")
+		return nil, fmt.Errorf("%w: create expects type and name/def", common.ErrInvalidInput)
 	}
 
 	targetType, ok := args[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid create type")
+		return nil, fmt.Errorf("%w: invalid create type", common.ErrInvalidInput)
 	}
 
 	if targetType == "db" || targetType == "database" {
 		dbName, ok := args[1].(string)
 		if !ok {
-			return nil, fmt.Errorf("invalid database name")
+			return nil, fmt.Errorf("%w: invalid database name", common.ErrInvalidInput)
 		}
 		if err := db.CreateDatabase(dbName); err != nil {
 			return nil, err
@@ -114,22 +117,22 @@ func createSchema(args []interface{}) (interface{}, error) {
 
 	if targetType == "table" {
 		if len(args) < 3 {
-			return nil, fmt.Errorf("create table expects db and definition")
+			return nil, fmt.Errorf("%w: create table expects db and definition", common.ErrInvalidInput)
 		}
 		dbName, ok := args[1].(string)
 		if !ok {
-			return nil, fmt.Errorf("invalid database name")
+			return nil, fmt.Errorf("%w: invalid database name", common.ErrInvalidInput)
 		}
 
 		// create table db <name> {def}
 		if len(args) == 4 {
 			tableName, ok := args[2].(string)
 			if !ok {
-				return nil, fmt.Errorf("invalid table name")
+				return nil, fmt.Errorf("%w: invalid table name", common.ErrInvalidInput)
 			}
 			colsDef, ok := args[3].(map[string]interface{})
 			if !ok {
-				return nil, fmt.Errorf("invalid column definition")
+				return nil, fmt.Errorf("%w: invalid column definition", common.ErrInvalidInput)
 			}
 			table, err := parseTableDefinition(tableName, colsDef)
 			if err != nil {
@@ -140,20 +143,20 @@ func createSchema(args []interface{}) (interface{}, error) {
 			}
 			return "success", nil
 		}
-		return nil, fmt.Errorf("create table usage: create table <db> <table> <def>")
+		return nil, fmt.Errorf("%w: create table usage: create table <db> <table> <def>", common.ErrInvalidInput)
 	}
 
-	return nil, fmt.Errorf("unknown create target: %s", targetType)
+	return nil, fmt.Errorf("%w: unknown create target: %s", common.ErrInvalidInput, targetType)
 }
 
 func setSchema(args []interface{}) (interface{}, error) {
 	if len(args) == 0 {
-		return nil, fmt.Errorf("set expects schema definition")
+		return nil, fmt.Errorf("%w: set expects schema definition", common.ErrInvalidInput)
 	}
 
 	schemaMap, ok := args[0].(map[string]interface{})
 	if !ok {
-		return nil, fmt.Errorf("invalid schema format, expected JSON object")
+		return nil, fmt.Errorf("%w: invalid schema format, expected JSON object", common.ErrInvalidInput)
 	}
 
 	if err := syncDatabases(schemaMap); err != nil {
@@ -172,7 +175,7 @@ func syncDatabases(targetSchema map[string]interface{}) error {
 	for dbName, val := range targetSchema {
 		tablesMap, ok := val.(map[string]interface{})
 		if !ok {
-			return fmt.Errorf("invalid format for database %s", dbName)
+			return fmt.Errorf("%w: invalid format for database %s", common.ErrInvalidInput, dbName)
 		}
 
 		if !existingDBs[dbName] {
@@ -211,7 +214,7 @@ func syncTables(dbName string, targetTables map[string]interface{}) error {
 	for tableName, val := range targetTables {
 		colsDef, ok := val.(map[string]interface{})
 		if !ok {
-			return fmt.Errorf("invalid format for table %s.%s", dbName, tableName)
+			return fmt.Errorf("%w: invalid format for table %s.%s", common.ErrInvalidInput, dbName, tableName)
 		}
 
 		targetTable, err := parseTableDefinition(tableName, colsDef)
@@ -224,9 +227,15 @@ func syncTables(dbName string, targetTables map[string]interface{}) error {
 				return err
 			}
 		} else {
+			if err := dropStaleIndexes(dbName, tableName, targetTable); err != nil {
+				return err
+			}
 			if err := syncColumns(dbName, tableName, targetTable); err != nil {
 				return err
 			}
+			if err := addNewIndexes(dbName, tableName, targetTable); err != nil {
+				return err
+			}
 		}
 		delete(existingTables, tableName)
 	}
@@ -256,16 +265,30 @@ func syncColumns(dbName, tableName string, targetTable *storemanager.Table) erro
 					"formatter": newCol.Formatter,
 					"validator": newCol.Validator,
 					"indexed":   newCol.Indexed,
+					"unique":    newCol.Unique,
 				},
 			}
 			if err := db.AlterTable(dbName, tableName, change); err != nil {
 				return err
 			}
 		} else {
+			// Index changes run in the background; a build must finish
+			// before a unique constraint can use the index.
+			hasIndex := oldCol.Indexed || oldCol.IndexBuilding
+			if newCol.Indexed && !hasIndex {
+				if err := db.BuildColumnIndex(dbName, tableName, colName); err != nil {
+					return err
+				}
+			} else if !newCol.Indexed && hasIndex {
+				if err := db.DropColumnIndex(dbName, tableName, colName); err != nil {
+					return err
+				}
+			}
+
 			if oldCol.Type != newCol.Type ||
 				oldCol.Formatter != newCol.Formatter ||
 				oldCol.Validator != newCol.Validator ||
-				oldCol.Indexed != newCol.Indexed ||
+				oldCol.Unique != newCol.Unique ||
 				!isDefaultEqual(oldCol.DefaultValue, newCol.DefaultValue) {
 
 				change := map[string]interface{}{
@@ -274,7 +297,7 @@ func syncColumns(dbName, tableName string, targetTable *storemanager.Table) erro
 						"type":      string(newCol.Type),
 						"formatter": newCol.Formatter,
 						"validator": newCol.Validator,
-						"indexed":   newCol.Indexed,
+						"unique":    newCol.Unique,
 						"default":   newCol.DefaultValue,
 					},
 				}
@@ -311,9 +334,12 @@ func parseTableDefinition(name string, colsDef map[string]interface{}) (*storema
 	}
 
 	for colName, def := range colsDef {
+		if colName == indexesKey {
+			continue
+		}
 		props, ok := def.(map[string]interface{})
 		if !ok {
-			return nil, fmt.Errorf("invalid column definition for %s", colName)
+			return nil, fmt.Errorf("%w: invalid column definition for %s", common.ErrInvalidInput, colName)
 		}
 
 		colType := getString(props, "type")
@@ -332,6 +358,11 @@ func parseTableDefinition(name string, colsDef map[string]interface{}) (*storema
 		}
 
 		defaultValue := props["default"]
+		unique, _ := props["unique"].(bool)
+		if getString(props, "unique") == "yes" {
+			unique = true
+		}
+		indexed := props["indexed"] != false && getString(props, "indexed") != "no"
 
 		col := &storemanager.Column{
 			Name:         colName,
@@ -339,17 +370,111 @@ func parseTableDefinition(name string, colsDef map[string]interface{}) (*storema
 			Validator:    validator,
 			Formatter:    formatter,
 			DefaultValue: defaultValue,
+			Indexed:      indexed,
+			Unique:       unique,
 			ID:           "", // Will be generated by CreateTable
 		}
 		table.Columns[colName] = col
 	}
 
+	if def, ok := colsDef[indexesKey]; ok {
+		indexes, err := parseIndexDefinitions(def)
+		if err != nil {
+			return nil, fmt.Errorf("%w: table %s: %v", common.ErrInvalidInput, name, err)
+		}
+		table.Indexes = indexes
+	}
+
 	return table, nil
 }
 
+// indexesKey is the reserved key of a table definition that declares composite indexes:
+//
+//	"_indexes": {"tenant_created": ["tenant_id", "created_at"]}
+const indexesKey = "_indexes"
+
+func parseIndexDefinitions(def interface{}) (map[string]*storemanager.Index, error) {
+	defs, ok := def.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid %s definition, expected {name: [columns]}", common.ErrInvalidInput, indexesKey)
+	}
+	indexes := make(map[string]*storemanager.Index, len(defs))
+	for name, v := range defs {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid column list for index %s", common.ErrInvalidInput, name)
+		}
+		idx := &storemanager.Index{Name: name}
+		for _, c := range list {
+			colName, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: invalid column list for index %s", common.ErrInvalidInput, name)
+			}
+			idx.Columns = append(idx.Columns, colName)
+		}
+		indexes[name] = idx
+	}
+	return indexes, nil
+}
+
+// dropStaleIndexes drops the composite indexes of a table that are missing from,
+// or declared with different columns in, the target definition. It runs before
+// column changes so a removed column is no longer referenced by an index.
+func dropStaleIndexes(dbName, tableName string, targetTable *storemanager.Table) error {
+	oldTable, err := db.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return err
+	}
+	for name, oldIdx := range oldTable.Indexes {
+		if newIdx, ok := targetTable.Indexes[name]; ok && sameColumns(oldIdx.Columns, newIdx.Columns) {
+			continue
+		}
+		change := map[string]interface{}{
+			"dropIndex": map[string]interface{}{"name": name},
+		}
+		if err := db.AlterTable(dbName, tableName, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addNewIndexes builds the composite indexes declared in the target definition
+// that the table does not have yet.
+func addNewIndexes(dbName, tableName string, targetTable *storemanager.Table) error {
+	oldTable, err := db.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return err
+	}
+	for name, newIdx := range targetTable.Indexes {
+		if _, ok := oldTable.Indexes[name]; ok {
+			continue
+		}
+		change := map[string]interface{}{
+			"addIndex": map[string]interface{}{"name": name, "columns": newIdx.Columns},
+		}
+		if err := db.AlterTable(dbName, tableName, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func renameSchema(args []interface{}) (interface{}, error) {
 	if len(args) < 3 {
-		return nil, fmt.Errorf("rename expects at least 3 args")
+		return nil, fmt.Errorf("%w: rename expects at least 3 args", common.ErrInvalidInput)
 	}
 
 	if len(args) == 3 {
@@ -371,17 +496,44 @@ func renameSchema(args []interface{}) (interface{}, error) {
 		return "success", nil
 	}
 
-	return nil, fmt.Errorf("invalid rename arguments")
+	return nil, fmt.Errorf("%w: invalid rename arguments", common.ErrInvalidInput)
+}
+
+// indexSchema starts building or dropping the index of a column:
+// ["index", "build"|"drop", db, table, column]. The work continues in the
+// background; desc shows IndexBuilding until a build is complete.
+func indexSchema(args []interface{}) (interface{}, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf("%w: index expects action, db, table and column", common.ErrInvalidInput)
+	}
+	action, _ := args[0].(string)
+	dbName, _ := args[1].(string)
+	tableName, _ := args[2].(string)
+	colName, _ := args[3].(string)
+
+	var err error
+	switch action {
+	case "build":
+		err = db.BuildColumnIndex(dbName, tableName, colName)
+	case "drop":
+		err = db.DropColumnIndex(dbName, tableName, colName)
+	default:
+		return nil, fmt.Errorf("%w: unknown index action: %s", common.ErrInvalidInput, action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return "started", nil
 }
 
 func dropSchema(args []interface{}) (interface{}, error) {
 	if len(args) == 0 {
-		return nil, fmt.Errorf("drop expects at least 1 arg")
+		return nil, fmt.Errorf("%w: drop expects at least 1 arg", common.ErrInvalidInput)
 	}
 
 	dbName, ok := args[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid database name")
+		return nil, fmt.Errorf("%w: invalid database name", common.ErrInvalidInput)
 	}
 
 	if len(args) == 1 {
@@ -393,7 +545,7 @@ func dropSchema(args []interface{}) (interface{}, error) {
 
 	tableName, ok := args[1].(string)
 	if !ok {
-		return nil, fmt.Errorf("invalid table name")
+		return nil, fmt.Errorf("%w: invalid table name", common.ErrInvalidInput)
 	}
 
 	if err := db.DropTable(dbName, tableName); err != nil {
@@ -404,7 +556,7 @@ func dropSchema(args []interface{}) (interface{}, error) {
 
 func alterSchema(args []interface{}) (interface{}, error) {
 	if len(args) != 3 {
-		return nil, fmt.Errorf("alter expects 3 args (db, table, changes)")
+		return nil, fmt.Errorf("%w: alter expects 3 args (db, table, changes)", common.ErrInvalidInput)
 	}
 
 	dbName, _ := args[0].(string)
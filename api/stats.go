@@ -190,6 +190,14 @@ func handleStatsRequest(msg *Message) string {
 		clearHistory()
 		return marshal(map[string]any{"data": "cleared", "error": ""})
 
+	case "purge":
+		// Dropped tables and databases whose keys are still being deleted
+		pending, err := db.PurgeStatus()
+		if err != nil {
+			return marshal(errorResult(err))
+		}
+		return marshal(map[string]any{"data": pending, "error": ""})
+
 	default:
 		var m runtime.MemStats
 		runtime.ReadMemStats(&m)
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"onql/dsl"
+	"onql/storemanager"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// maxPendingChanges bounds the changes queued for one subscription. Beyond it
+// the queue is replaced by a single "overflow" notification.
+const maxPendingChanges = 1000
+
+// Push sends a message to a connection outside of request/response, framed
+// like a response with rid and target. It reports false if the connection is
+// gone. It is set by the server package to avoid import cycles.
+var Push func(connID, rid, target, payload string) bool
+
+// SubscribeRequest registers a live query. Mode "changes" (the default) pushes
+// which rows of the tables the query reads changed; mode "results" re-runs the
+// query after such changes and pushes its result.
+type SubscribeRequest struct {
+	DSLRequest
+	Mode string `json:"mode"`
+}
+
+// changeNotice is what mode "changes" pushes for a change: the changed row and
+// the operation, without the row images. Clients re-read the rows through their
+// protopass, which applies the protocol's field mapping and context filters.
+type changeNotice struct {
+	Seq   uint64 `json:"seq,omitempty"`
+	Time  int64  `json:"ts"`
+	DB    string `json:"db"`
+	Table string `json:"table"`
+	PK    string `json:"pk"`
+	Op    string `json:"op"`
+}
+
+// subscription is a live query registered by a connection.
+type subscription struct {
+	id     string
+	connID string
+	req    SubscribeRequest
+	tables map[string]bool // "db.table" names the query reads
+	wake   chan struct{}
+	done   chan struct{}
+
+	mu       sync.Mutex
+	pending  []changeNotice
+	overflow bool
+}
+
+// Live subscriptions keyed by subscription ID.
+var (
+	subscriptions   = make(map[string]*subscription)
+	subscriptionsMu sync.RWMutex
+)
+
+// handleSubscribeRequest registers a live query for the connection and returns
+// its subscription ID, which is used as the RID of every pushed message:
+//
+//	{"protopass": "...", "query": "shop.orders[status='open']", "ctxkey": "", "ctxvalues": [], "mode": "changes"|"results"}
+func handleSubscribeRequest(msg *Message) string {
+	var req SubscribeRequest
+	if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+		return errorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+	if req.Mode == "" {
+		req.Mode = "changes"
+	}
+	if req.Mode != "changes" && req.Mode != "results" {
+		return marshal(map[string]any{"data": nil, "error": "unknown mode: " + req.Mode, "code": CodeInvalidRequest})
+	}
+
+	tables, err := dsl.Tables(req.Protopass, req.Query)
+	if err != nil {
+		return marshal(errorResult(err))
+	}
+
+	sub := &subscription{
+		id:     uuid.NewString(),
+		connID: msg.ID,
+		req:    req,
+		tables: make(map[string]bool),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	for _, t := range tables {
+		sub.tables[t] = true
+	}
+
+	subscriptionsMu.Lock()
+	subscriptions[sub.id] = sub
+	subscriptionsMu.Unlock()
+
+	data := map[string]any{"sid": sub.id, "tables": tables}
+	if req.Mode == "results" {
+		// Registered first, so no change after this result goes unnoticed
+		result, err := sub.results()
+		if err != nil {
+			subscriptionsMu.Lock()
+			delete(subscriptions, sub.id)
+			subscriptionsMu.Unlock()
+			close(sub.done)
+			return marshal(errorResult(err))
+		}
+		data["result"] = result
+	}
+	// Pushes start once the response is out, so none arrives before it
+	msg.AfterReply(sub.run)
+	return marshal(map[string]any{"data": data, "error": ""})
+}
+
+// handleUnsubscribeRequest removes a subscription of the connection: {"sid": "..."}
+func handleUnsubscribeRequest(msg *Message) string {
+	var req struct {
+		SID string `json:"sid"`
+	}
+	if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+		return errorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	subscriptionsMu.Lock()
+	sub, ok := subscriptions[req.SID]
+	if ok && sub.connID == msg.ID {
+		delete(subscriptions, req.SID)
+	}
+	subscriptionsMu.Unlock()
+
+	if !ok || sub.connID != msg.ID {
+		return marshal(map[string]any{"data": nil, "error": "unknown subscription: " + req.SID, "code": CodeNotFound})
+	}
+	close(sub.done)
+	return marshal(map[string]any{"data": "success", "error": ""})
+}
+
+// unsubscribeConnection removes every subscription of a closed connection.
+func unsubscribeConnection(connID string) {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+	for id, sub := range subscriptions {
+		if sub.connID == connID {
+			delete(subscriptions, id)
+			close(sub.done)
+		}
+	}
+}
+
+// notifySubscriptions is the database change listener. It queues the changes
+// each subscription is interested in and wakes its goroutine; it never blocks.
+func notifySubscriptions(changes []storemanager.Change) {
+	subscriptionsMu.RLock()
+	defer subscriptionsMu.RUnlock()
+	for _, sub := range subscriptions {
+		sub.queue(changes)
+	}
+}
+
+// queue adds the changes of the subscribed tables and wakes the subscription.
+func (sub *subscription) queue(changes []storemanager.Change) {
+	matched := false
+	sub.mu.Lock()
+	for _, c := range changes {
+		if !sub.tables[c.DB+"."+c.Table] {
+			continue
+		}
+		matched = true
+		if sub.req.Mode != "changes" || sub.overflow {
+			continue
+		}
+		if len(sub.pending) >= maxPendingChanges {
+			sub.pending = nil
+			sub.overflow = true
+			continue
+		}
+		sub.pending = append(sub.pending, changeNotice{
+			Seq: c.Seq, Time: c.Time, DB: c.DB, Table: c.Table, PK: c.PK, Op: c.Op,
+		})
+	}
+	sub.mu.Unlock()
+
+	if matched {
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run pushes notifications until the subscription is removed or its
+// connection is gone. Changes arriving while a push is in progress are
+// delivered together in the next one.
+func (sub *subscription) run() {
+	for {
+		select {
+		case <-sub.done:
+			return
+		case <-sub.wake:
+		}
+
+		var payload string
+		if sub.req.Mode == "results" {
+			if result, err := sub.results(); err != nil {
+				payload = marshal(errorResult(err))
+			} else {
+				payload = marshal(map[string]any{"data": result, "error": ""})
+			}
+		} else {
+			sub.mu.Lock()
+			changes, overflow := sub.pending, sub.overflow
+			sub.pending, sub.overflow = nil, false
+			sub.mu.Unlock()
+
+			data := map[string]any{"changes": changes}
+			if overflow {
+				// Too many changes to deliver; the client should re-read
+				data = map[string]any{"changes": []changeNotice{}, "overflow": true}
+			}
+			payload = marshal(map[string]any{"data": data, "error": ""})
+		}
+
+		if Push == nil || !Push(sub.connID, sub.id, "subscribe", payload) {
+			unsubscribeConnection(sub.connID)
+			return
+		}
+	}
+}
+
+// results runs the subscribed query.
+func (sub *subscription) results() (any, error) {
+	req := sub.req.DSLRequest
+	ctx, cancel, limits := req.apply(context.Background())
+	defer cancel()
+
+	return dsl.Execute(ctx, limits, req.Protopass, req.Query, req.CtxKey, req.CtxValues, req.Versions)
+}
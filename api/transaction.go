@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"onql/database"
+	"onql/storemanager"
+	"sync"
+)
+
+// Open transactions keyed by connection ID (Message.ID).
+var (
+	transactions   = make(map[string]*database.Tx)
+	transactionsMu sync.Mutex
+)
+
+// handleTransactionRequest handles the "transaction" target.
+//
+//	["begin"]                                  start a transaction bound to this connection
+//	["insert"|"upsert"|"update"|"delete", {}]  stage a write in the open transaction
+//	["commit"] / ["rollback"]                  finish the open transaction
+//	["exec", [["insert", {}], ...]]            run a list of writes as one transaction
+//
+// Write payloads use the same fields as the insert, upsert, update and delete targets.
+func handleTransactionRequest(msg *Message) string {
+	var command []interface{}
+	if err := json.Unmarshal([]byte(msg.Payload), &command); err != nil {
+		return errorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	if len(command) == 0 {
+		return errorResponse("empty command")
+	}
+
+	cmd, ok := command[0].(string)
+	if !ok {
+		return errorResponse("invalid command type")
+	}
+
+	_, finish := StartQueryTrace("transaction", cmd, len(msg.Payload))
+	result, err := executeTransactionCommand(msg.Ctx, msg.ID, cmd, command[1:])
+	if err != nil {
+		resp := errResponse(err)
+		finish(resp, err.Error())
+		return resp
+	}
+
+	data, _ := json.Marshal(result)
+	resp := string(data)
+	finish(resp, "")
+	return resp
+}
+
+func executeTransactionCommand(ctx context.Context, connID, cmd string, args []interface{}) (interface{}, error) {
+	switch cmd {
+	case "begin":
+		return beginTransaction(connID)
+	case "commit":
+		return commitTransaction(connID)
+	case "rollback":
+		return rollbackTransaction(connID)
+	case "insert", "upsert", "update", "delete":
+		tx, err := openTransaction(connID)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) < 1 {
+			return nil, fmt.Errorf("%w: %s expects a payload", common.ErrInvalidInput, cmd)
+		}
+		return stageTransactionWrite(ctx, tx, cmd, args[0])
+	case "exec":
+		return execTransaction(ctx, args)
+	default:
+		return nil, fmt.Errorf("%w: unknown command: %s", common.ErrInvalidInput, cmd)
+	}
+}
+
+func beginTransaction(connID string) (interface{}, error) {
+	transactionsMu.Lock()
+	defer transactionsMu.Unlock()
+
+	if _, ok := transactions[connID]; ok {
+		return nil, fmt.Errorf("%w: transaction already in progress", common.ErrInvalidInput)
+	}
+	transactions[connID] = db.Begin()
+	return "success", nil
+}
+
+func openTransaction(connID string) (*database.Tx, error) {
+	transactionsMu.Lock()
+	defer transactionsMu.Unlock()
+
+	tx, ok := transactions[connID]
+	if !ok {
+		return nil, fmt.Errorf("%w: no transaction in progress", common.ErrInvalidInput)
+	}
+	return tx, nil
+}
+
+// takeTransaction removes and returns the connection's open transaction.
+func takeTransaction(connID string) (*database.Tx, error) {
+	transactionsMu.Lock()
+	defer transactionsMu.Unlock()
+
+	tx, ok := transactions[connID]
+	if !ok {
+		return nil, fmt.Errorf("%w: no transaction in progress", common.ErrInvalidInput)
+	}
+	delete(transactions, connID)
+	return tx, nil
+}
+
+func commitTransaction(connID string) (interface{}, error) {
+	tx, err := takeTransaction(connID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return "success", nil
+}
+
+func rollbackTransaction(connID string) (interface{}, error) {
+	tx, err := takeTransaction(connID)
+	if err != nil {
+		return nil, err
+	}
+	tx.Rollback()
+	return "success", nil
+}
+
+// execTransaction stages every operation in args[0] and commits them together.
+// The first failing operation rolls the whole list back.
+func execTransaction(ctx context.Context, args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("%w: exec expects a list of operations", common.ErrInvalidInput)
+	}
+	ops, ok := args[0].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid operation list", common.ErrInvalidInput)
+	}
+
+	tx := db.Begin()
+	results := make([]interface{}, 0, len(ops))
+	for i, raw := range ops {
+		op, ok := raw.([]interface{})
+		if !ok || len(op) < 2 {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: operation %d: expected [command, payload]", common.ErrInvalidInput, i)
+		}
+		cmd, _ := op[0].(string)
+		result, err := stageTransactionWrite(ctx, tx, cmd, op[1])
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// stageTransactionWrite applies one insert, upsert, update or delete payload to tx.
+// Inserts and upserts return the primary key; updates and deletes return the affected ids.
+func stageTransactionWrite(ctx context.Context, tx *database.Tx, cmd string, payload interface{}) (interface{}, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cmd {
+	case "insert":
+		var insData insertData
+		if err := json.Unmarshal(raw, &insData); err != nil {
+			return nil, err
+		}
+		if insData.OnConflict == "" {
+			return tx.Insert(insData.DB, insData.Table, insData.Records)
+		}
+		return stageUpsert(tx, insData)
+	case "upsert":
+		var insData insertData
+		if err := json.Unmarshal(raw, &insData); err != nil {
+			return nil, err
+		}
+		if insData.OnConflict == "" {
+			insData.OnConflict = string(storemanager.ConflictMerge)
+		}
+		return stageUpsert(tx, insData)
+	case "update":
+		var updData updateData
+		if err := json.Unmarshal(raw, &updData); err != nil {
+			return nil, err
+		}
+		if updData.Records == nil {
+			return nil, fmt.Errorf("%w: update expects records", common.ErrInvalidInput)
+		}
+		pks, err := resolvePks(ctx, updData.QueryLimits, updData.Query, updData.Protopass, updData.Ids)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := updateRows(tx, updData, pks); err != nil {
+			return nil, err
+		}
+		return pks, nil
+	case "delete":
+		var delData deleteData
+		if err := json.Unmarshal(raw, &delData); err != nil {
+			return nil, err
+		}
+		pks, err := resolvePks(ctx, delData.QueryLimits, delData.Query, delData.Protopass, delData.Ids)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := deleteRows(tx, delData, pks); err != nil {
+			return nil, err
+		}
+		return pks, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown transaction operation: %s", common.ErrInvalidInput, cmd)
+	}
+}
+
+// stageUpsert stages an insert that resolves primary key conflicts as insData.OnConflict says.
+func stageUpsert(tx *database.Tx, insData insertData) (interface{}, error) {
+	onConflict, err := storemanager.ParseConflictAction(insData.OnConflict)
+	if err != nil {
+		return nil, err
+	}
+	pk, _, err := tx.Upsert(insData.DB, insData.Table, insData.Records, onConflict)
+	return pk, err
+}
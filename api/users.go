@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"onql/storemanager"
+)
+
+// handleUserRequest manages user accounts:
+//
+//	["create", name, password, [roles]]
+//	["drop", name]
+//	["password", name, password]
+//	["roles", name, [roles]]
+//	["subject", name, "CN=..."]   authenticate TLS clients with this certificate subject as name
+//	["list"]
+func handleUserRequest(msg *Message) string {
+	return handleCommand(msg, executeUserCommand)
+}
+
+// handleRoleRequest manages roles:
+//
+//	["set", name, {"shop": ["read", "write"], "*": ["read"]}]
+//	["drop", name]
+//	["list"]
+func handleRoleRequest(msg *Message) string {
+	return handleCommand(msg, executeRoleCommand)
+}
+
+// handleCommand decodes a ["command", args...] payload and runs it with execute.
+func handleCommand(msg *Message, execute func(cmd string, args []json.RawMessage) (interface{}, error)) string {
+	var command []json.RawMessage
+	if err := json.Unmarshal([]byte(msg.Payload), &command); err != nil {
+		return errorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	if len(command) == 0 {
+		return errorResponse("empty command")
+	}
+
+	var cmd string
+	if err := json.Unmarshal(command[0], &cmd); err != nil {
+		return errorResponse("invalid command type")
+	}
+
+	result, err := execute(cmd, command[1:])
+	if err != nil {
+		return errResponse(err)
+	}
+
+	data, _ := json.Marshal(result)
+	return string(data)
+}
+
+func executeUserCommand(cmd string, args []json.RawMessage) (interface{}, error) {
+	var name, value string
+	var roles []string
+	if cmd != "list" {
+		if len(args) < 1 {
+			return nil, fmt.Errorf("%w: %s expects a user name", common.ErrInvalidInput, cmd)
+		}
+		if err := json.Unmarshal(args[0], &name); err != nil {
+			return nil, fmt.Errorf("%w: invalid user name", common.ErrInvalidInput)
+		}
+	}
+
+	switch cmd {
+	case "create":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%w: create expects name, password and roles", common.ErrInvalidInput)
+		}
+		if err := json.Unmarshal(args[1], &value); err != nil {
+			return nil, fmt.Errorf("%w: invalid password", common.ErrInvalidInput)
+		}
+		if len(args) > 2 {
+			if err := json.Unmarshal(args[2], &roles); err != nil {
+				return nil, fmt.Errorf("%w: invalid roles", common.ErrInvalidInput)
+			}
+		}
+		if err := db.CreateUser(name, value, roles); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	case "drop":
+		if err := db.DropUser(name); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	case "password":
+		if len(args) != 2 || json.Unmarshal(args[1], &value) != nil {
+			return nil, fmt.Errorf("%w: password expects name and password", common.ErrInvalidInput)
+		}
+		if err := db.SetUserPassword(name, value); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	case "roles":
+		if len(args) != 2 || json.Unmarshal(args[1], &roles) != nil {
+			return nil, fmt.Errorf("%w: roles expects name and a list of roles", common.ErrInvalidInput)
+		}
+		if err := db.SetUserRoles(name, roles); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	case "subject":
+		if len(args) != 2 || json.Unmarshal(args[1], &value) != nil {
+			return nil, fmt.Errorf("%w: subject expects name and a certificate subject", common.ErrInvalidInput)
+		}
+		if err := db.SetUserSubject(name, value); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	case "list":
+		return db.ListUsers(), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown command: %s", common.ErrInvalidInput, cmd)
+	}
+}
+
+func executeRoleCommand(cmd string, args []json.RawMessage) (interface{}, error) {
+	switch cmd {
+	case "set":
+		var role storemanager.Role
+		if len(args) != 2 || json.Unmarshal(args[0], &role.Name) != nil || json.Unmarshal(args[1], &role.Grants) != nil {
+			return nil, fmt.Errorf("%w: set expects name and grants", common.ErrInvalidInput)
+		}
+		if err := db.SetRole(role); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	case "drop":
+		var name string
+		if len(args) != 1 || json.Unmarshal(args[0], &name) != nil {
+			return nil, fmt.Errorf("%w: drop expects a role name", common.ErrInvalidInput)
+		}
+		if err := db.DropRole(name); err != nil {
+			return nil, err
+		}
+		return "success", nil
+	case "list":
+		return db.ListRoles(), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown command: %s", common.ErrInvalidInput, cmd)
+	}
+}
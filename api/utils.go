@@ -1,8 +1,26 @@
 package api
 
-import "fmt"
+import (
+	"fmt"
+	"onql/common"
+)
 
-// errorResponse creates a JSON error response
+// errorResponse creates a JSON error response for a malformed request
 func errorResponse(msg string) string {
-	return fmt.Sprintf(`{"error":"%s"}`, msg)
+	return marshal(map[string]any{"error": msg, "code": CodeInvalidRequest})
+}
+
+// errResponse creates a JSON error response for err, with its code
+func errResponse(err error) string {
+	return marshal(map[string]any{"error": err.Error(), "code": errorCode(err)})
+}
+
+// errorResult is the response body of a request that failed with err.
+func errorResult(err error) map[string]any {
+	return map[string]any{"data": nil, "error": err.Error(), "code": errorCode(err)}
+}
+
+// invalidPayload wraps the error of decoding a request payload as invalid input.
+func invalidPayload(err error) error {
+	return fmt.Errorf("%w: invalid payload: %v", common.ErrInvalidInput, err)
 }
@@ -23,8 +23,9 @@ func main() {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
-	// 3. Set Global DB for API
+	// 3. Set Global DB and query limits for API
 	api.SetDatabase(db)
+	api.SetConfig(cfg)
 
 	// 4. Setup Graceful Shutdown
 	c := make(chan os.Signal, 1)
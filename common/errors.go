@@ -3,10 +3,18 @@ package common
 import "errors"
 
 var (
-	ErrNotFound       = errors.New("not found")
-	ErrDuplicate      = errors.New("duplicate entry")
-	ErrInvalidInput   = errors.New("invalid input")
-	ErrDatabaseExists = errors.New("database already exists")
-	ErrTableExists    = errors.New("table already exists")
-	ErrStopIteration  = errors.New("stop iteration")
+	ErrNotFound        = errors.New("not found")
+	ErrDuplicate       = errors.New("duplicate entry")
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrDatabaseExists  = errors.New("database already exists")
+	ErrTableExists     = errors.New("table already exists")
+	ErrStopIteration   = errors.New("stop iteration")
+	ErrConflict        = errors.New("transaction conflict")
+	ErrTxnClosed       = errors.New("transaction already closed")
+	ErrChangesTrimmed  = errors.New("change records trimmed")
+	ErrUnauthorized    = errors.New("authentication failed")
+	ErrForbidden       = errors.New("permission denied")
+	ErrRowLimit        = errors.New("row limit exceeded")
+	ErrMemoryLimit     = errors.New("memory limit exceeded")
+	ErrVersionConflict = errors.New("row version conflict")
 )
@@ -2,22 +2,68 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	DBPath        string
-	FlushInterval time.Duration
-	LogLevel      string
-	Port          string
+	DBPath          string
+	FlushInterval   time.Duration
+	LogLevel        string
+	Port            string
+	HTTPPort        string        // empty disables the HTTP gateway
+	WSPort          string        // empty disables the WebSocket listener
+	WSOrigins       []string      // browser origins allowed to open WebSocket connections
+	MaxFrameSize    int           // largest message payload accepted from a client, in bytes
+	FirstByteWait   time.Duration // connections silent for this long after connecting are closed, 0 for no limit
+	TLSCertFile     string        // PEM server certificate; empty serves plain TCP
+	TLSKeyFile      string
+	TLSClientCAFile string // PEM CA bundle; set to require client certificates
+	WALDir          string // empty disables the write-ahead log
+	WALSyncMode     string // always | group | interval
+	WALSyncInterval time.Duration
+	ChangeLog       bool          // record row changes for the changes target
+	ChangeRetention time.Duration // 0 keeps change records regardless of age
+	ChangeMaxCount  int           // 0 keeps any number of change records
+	QueryTimeout    time.Duration // longest a DSL query may run, 0 for no limit
+	QueryMaxRows    int           // most rows a DSL query may load, 0 for no limit
+	QueryMaxMemory  int           // most bytes of rows a DSL query may load, 0 for no limit
+	CursorIdle      time.Duration // result cursors unused for this long are closed
+	CursorMax       int           // most cursors a connection may hold open
+	CursorMaxBytes  int           // most bytes of rows the open cursors of a connection may hold
+	BackupDir       string        // directory of admin backup files; empty disables backup and restore
 }
 
 func Load() *Config {
+	dbPath := getEnv("DB_PATH", "./store")
 	return &Config{
-		DBPath:        getEnv("DB_PATH", "./store"),
-		FlushInterval: getDurationEnv("FLUSH_INTERVAL", 500*time.Millisecond),
-		LogLevel:      getEnv("LOG_LEVEL", "INFO"),
-		Port:          getEnv("PORT", "5656"),
+		DBPath:          dbPath,
+		FlushInterval:   getDurationEnv("FLUSH_INTERVAL", 500*time.Millisecond),
+		LogLevel:        getEnv("LOG_LEVEL", "INFO"),
+		Port:            getEnv("PORT", "5656"),
+		HTTPPort:        getEnv("HTTP_PORT", ""),
+		WSPort:          getEnv("WS_PORT", ""),
+		WSOrigins:       getListEnv("WS_ALLOWED_ORIGINS"),
+		MaxFrameSize:    getIntEnv("MAX_FRAME_SIZE", 16<<20),
+		FirstByteWait:   getDurationEnv("FIRST_BYTE_TIMEOUT", 0),
+		TLSCertFile:     getEnv("TLS_CERT", ""),
+		TLSKeyFile:      getEnv("TLS_KEY", ""),
+		TLSClientCAFile: getEnv("TLS_CLIENT_CA", ""),
+		WALDir:          getEnv("WAL_DIR", filepath.Join(dbPath, "wal")),
+		WALSyncMode:     getEnv("WAL_SYNC_MODE", "always"),
+		WALSyncInterval: getDurationEnv("WAL_SYNC_INTERVAL", 100*time.Millisecond),
+		ChangeLog:       getEnv("CDC_ENABLED", "true") == "true",
+		ChangeRetention: getDurationEnv("CDC_RETENTION", 24*time.Hour),
+		ChangeMaxCount:  getIntEnv("CDC_MAX_RECORDS", 0),
+		QueryTimeout:    getDurationEnv("QUERY_TIMEOUT", 60*time.Second),
+		QueryMaxRows:    getIntEnv("QUERY_MAX_ROWS", 0),
+		QueryMaxMemory:  getIntEnv("QUERY_MAX_MEMORY", 0),
+		CursorIdle:      getDurationEnv("CURSOR_IDLE_TIMEOUT", 5*time.Minute),
+		CursorMax:       getIntEnv("CURSOR_MAX", 16),
+		CursorMaxBytes:  getIntEnv("CURSOR_MAX_BYTES", 64<<20),
+		BackupDir:       getEnv("BACKUP_DIR", "./backups"),
 	}
 }
 
@@ -28,6 +74,17 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getListEnv splits a comma-separated variable, dropping empty items.
+func getListEnv(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getDurationEnv(key string, fallback time.Duration) time.Duration {
 	if value, ok := os.LookupEnv(key); ok {
 		if d, err := time.ParseDuration(value); err == nil {
@@ -36,3 +93,12 @@ func getDurationEnv(key string, fallback time.Duration) time.Duration {
 	}
 	return fallback
 }
+
+func getIntEnv(key string, fallback int) int {
+	if value, ok := os.LookupEnv(key); ok {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
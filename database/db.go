@@ -46,6 +46,7 @@ import (
 	"onql/engine"
 	"onql/logger"
 	"onql/storemanager"
+	"os"
 )
 
 // DB represents the high-level database instance.
@@ -65,7 +66,11 @@ func New(cfg *config.Config) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	sm := storemanager.New(eng, cfg)
+	sm, err := storemanager.New(eng, cfg)
+	if err != nil {
+		eng.Close()
+		return nil, err
+	}
 	db := &DB{sm: sm, engine: eng}
 
 	// Set global DB for DSL helper functions
@@ -80,3 +85,52 @@ func (db *DB) Close() {
 	db.sm.Close()
 	db.engine.Close()
 }
+
+// Backup writes a consistent snapshot of the whole store to the file at path.
+// The file is written under a temporary name and renamed once it is synced, so
+// a failed backup never leaves a truncated file behind.
+func (db *DB) Backup(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := db.sm.Backup(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Restore loads a file written by Backup into this (empty) database.
+// It delegates to the underlying StoreManager.
+func (db *DB) Restore(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return db.sm.Restore(f)
+}
+
+// Changes returns committed row changes with a sequence number above after, oldest first.
+// It delegates to the underlying StoreManager.
+func (db *DB) Changes(after uint64, limit int, dbName, tableName string) ([]storemanager.Change, uint64, error) {
+	return db.sm.Changes(after, limit, dbName, tableName)
+}
+
+// SetChangeListener registers fn to be called with the changes of every committed write.
+// It delegates to the underlying StoreManager.
+func (db *DB) SetChangeListener(fn func(changes []storemanager.Change)) {
+	db.sm.SetChangeListener(fn)
+}
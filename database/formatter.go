@@ -43,6 +43,7 @@ package database
 
 import (
 	"fmt"
+	"onql/common"
 	"strconv"
 	"strings"
 )
@@ -91,7 +92,7 @@ func Format(value interface{}, rules []string) (interface{}, error) {
 			}
 		case "decimal":
 			if len(ruleParts) < 2 {
-				return nil, fmt.Errorf("decimal rule requires precision")
+				return nil, fmt.Errorf("%w: decimal rule requires precision", common.ErrInvalidInput)
 			}
 			precision, err := strconv.Atoi(ruleParts[1])
 			if err != nil {
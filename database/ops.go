@@ -1,6 +1,9 @@
 package database
 
-import "onql/storemanager"
+import (
+	"context"
+	"onql/storemanager"
+)
 
 // Insert wrapper using globalDB
 func Insert(dbName, tableName string, data map[string]interface{}) (string, error) {
@@ -18,7 +21,8 @@ func Update(dbName, tableName, pk string, data map[string]interface{}) error {
 	if globalDB == nil {
 		panic("global DB not initialized")
 	}
-	return globalDB.Update(dbName, tableName, pk, data)
+	_, err := globalDB.Update(dbName, tableName, pk, data, nil)
+	return err
 }
 
 // Delete wrapper using globalDB
@@ -26,7 +30,7 @@ func Delete(dbName, tableName, pk string) error {
 	if globalDB == nil {
 		panic("global DB not initialized")
 	}
-	return globalDB.Delete(dbName, tableName, pk)
+	return globalDB.Delete(dbName, tableName, pk, nil)
 }
 
 // CreateDatabase wrapper using globalDB
@@ -102,25 +106,25 @@ func FetchTables(dbName string) ([]string, error) {
 }
 
 // GetAllPksWithLimits wrapper using globalDB
-func GetAllPksWithLimits(dbName, tableName string, offset, limit int, reverse bool) ([]string, error) {
+func GetAllPksWithLimits(ctx context.Context, dbName, tableName string, offset, limit int, reverse bool) ([]string, error) {
 	if globalDB == nil {
 		panic("global DB not initialized")
 	}
-	return globalDB.sm.GetAllPksWithLimits(dbName, tableName, offset, limit, reverse)
+	return globalDB.sm.GetAllPksWithLimits(ctx, dbName, tableName, offset, limit, reverse)
 }
 
 // GetPksSortedByCol retrieves PKs sorted by a column using the index.
-func GetPksSortedByCol(dbName, tableName, colName string, offset, limit int, reverse bool) ([]string, error) {
+func GetPksSortedByCol(ctx context.Context, dbName, tableName, colName string, offset, limit int, reverse bool) ([]string, error) {
 	if globalDB == nil {
 		panic("global DB not initialized")
 	}
-	return globalDB.sm.GetPksSortedByCol(dbName, tableName, colName, offset, limit, reverse)
+	return globalDB.sm.GetPksSortedByCol(ctx, dbName, tableName, colName, offset, limit, reverse)
 }
 
 // GetPksSortedByColWithFilter retrieves sorted PKs that also satisfy the given filters.
-func GetPksSortedByColWithFilter(dbName, tableName, colName string, offset, limit int, reverse bool, filters []string) ([]string, error) {
+func GetPksSortedByColWithFilter(ctx context.Context, dbName, tableName, colName string, offset, limit int, reverse bool, filters []string) ([]string, error) {
 	if globalDB == nil {
 		panic("global DB not initialized")
 	}
-	return globalDB.sm.GetPksSortedByColWithFilter(dbName, tableName, colName, offset, limit, reverse, filters)
+	return globalDB.sm.GetPksSortedByColWithFilter(ctx, dbName, tableName, colName, offset, limit, reverse, filters)
 }
@@ -42,15 +42,23 @@ For more details see: https://mariadb.com/bsl11/
 package database
 
 import (
+	"context"
 	"fmt"
+	"onql/common"
 	"onql/storemanager"
 	"strings"
 )
 
-// SetProtocol stores a protocol definition.
+// SetProtocol stores a protocol definition under name; an empty secret keeps the current one.
 // It delegates to the underlying StoreManager.
-func (db *DB) SetProtocol(password string, protocol storemanager.QueryProtocol) error {
-	return db.sm.SetProtocol(password, protocol)
+func (db *DB) SetProtocol(name, secret string, protocol storemanager.QueryProtocol) error {
+	return db.sm.SetProtocol(name, secret, protocol)
+}
+
+// RotateProtocolSecret replaces the protopass of a protocol and returns the new one.
+// It delegates to the underlying StoreManager.
+func (db *DB) RotateProtocolSecret(name, secret string) (string, error) {
+	return db.sm.RotateProtocolSecret(name, secret)
 }
 
 // GetProtocol retrieves a protocol by its password.
@@ -59,7 +67,13 @@ func (db *DB) GetProtocol(password string) (*storemanager.QueryProtocol, error)
 	return db.sm.GetProtocol(password)
 }
 
-// GetAllProtocols retrieves a list of all registered protocol passwords.
+// GetProtocolByName retrieves a protocol by its name.
+// It delegates to the underlying StoreManager.
+func (db *DB) GetProtocolByName(name string) (*storemanager.QueryProtocol, error) {
+	return db.sm.GetProtocolByName(name)
+}
+
+// GetAllProtocols retrieves a list of all registered protocol names.
 // It delegates to the underlying StoreManager.
 func (db *DB) GetAllProtocols() ([]string, error) {
 	return db.sm.GetAllProtocols()
@@ -67,8 +81,8 @@ func (db *DB) GetAllProtocols() ([]string, error) {
 
 // DeleteProtocol removes a protocol definition.
 // It delegates to the underlying StoreManager.
-func (db *DB) DeleteProtocol(password string) error {
-	return db.sm.DeleteProtocol(password)
+func (db *DB) DeleteProtocol(name string) error {
+	return db.sm.DeleteProtocol(name)
 }
 
 // GetProtoContext retrieves the context query for a specific entity within a protocol.
@@ -161,15 +175,15 @@ func GetRelationByRelationName(protoPass, dbName, tableName, relationName string
 	}
 	module, exists := (*protocol)[dbName]
 	if !exists {
-		return nil, fmt.Errorf("database %s not found in protocol", dbName)
+		return nil, fmt.Errorf("database %s %w in protocol", dbName, common.ErrNotFound)
 	}
 	entity, exists := module.Entities[tableName]
 	if !exists {
-		return nil, fmt.Errorf("entity %s not found", tableName)
+		return nil, fmt.Errorf("entity %s %w", tableName, common.ErrNotFound)
 	}
 	relation, exists := entity.Relations[relationName]
 	if !exists {
-		return nil, fmt.Errorf("relation %s not found", relationName)
+		return nil, fmt.Errorf("relation %s %w", relationName, common.ErrNotFound)
 	}
 	return relation, nil
 }
@@ -182,7 +196,7 @@ func GetDbNameFromProtoName(protoPass, dbName string) (string, error) {
 	}
 	module, exists := (*protocol)[dbName]
 	if !exists {
-		return "", fmt.Errorf("database %s not found in protocol", dbName)
+		return "", fmt.Errorf("database %s %w in protocol", dbName, common.ErrNotFound)
 	}
 	return module.Database, nil
 }
@@ -195,11 +209,11 @@ func GetTableNameFromProtoName(protoPass, dbName, tableName string) (string, err
 	}
 	module, exists := (*protocol)[dbName]
 	if !exists {
-		return "", fmt.Errorf("database %s not found in protocol", dbName)
+		return "", fmt.Errorf("database %s %w in protocol", dbName, common.ErrNotFound)
 	}
 	entity, exists := module.Entities[tableName]
 	if !exists {
-		return "", fmt.Errorf("entity %s not found", tableName)
+		return "", fmt.Errorf("entity %s %w", tableName, common.ErrNotFound)
 	}
 	return entity.Table, nil
 }
@@ -212,15 +226,15 @@ func GetColSchemaFromProtoName(protoPass, dbName, tableName, columnName string)
 	}
 	module, exists := (*protocol)[dbName]
 	if !exists {
-		return nil, fmt.Errorf("database %s not found in protocol", dbName)
+		return nil, fmt.Errorf("database %s %w in protocol", dbName, common.ErrNotFound)
 	}
 	entity, exists := module.Entities[tableName]
 	if !exists {
-		return nil, fmt.Errorf("entity %s not found", tableName)
+		return nil, fmt.Errorf("entity %s %w", tableName, common.ErrNotFound)
 	}
 	actualFieldName, exists := entity.Fields[columnName]
 	if !exists {
-		return nil, fmt.Errorf("field %s not found in entity %s", columnName, tableName)
+		return nil, fmt.Errorf("field %s %w in entity %s", columnName, common.ErrNotFound, tableName)
 	}
 
 	// Fetch actual table schema to get the type
@@ -230,7 +244,7 @@ func GetColSchemaFromProtoName(protoPass, dbName, tableName, columnName string)
 	}
 	colDef, ok := tableSchema.Columns[actualFieldName]
 	if !ok {
-		return nil, fmt.Errorf("column %s not found in table schema %s.%s", actualFieldName, module.Database, entity.Table)
+		return nil, fmt.Errorf("column %s %w in table schema %s.%s", actualFieldName, common.ErrNotFound, module.Database, entity.Table)
 	}
 
 	// Return metadata about the column
@@ -244,7 +258,7 @@ func GetColSchemaFromProtoName(protoPass, dbName, tableName, columnName string)
 
 // SetProtocolBySchema generates a protocol from a schema map and sets it.
 // It maintains a default name protocol for every database.
-func (db *DB) SetProtocolBySchema(password string, schema map[string]map[string]map[string]map[string]string) error {
+func (db *DB) SetProtocolBySchema(name, secret string, schema map[string]map[string]map[string]map[string]string) error {
 	// Convert schema to Query protocol
 	protocol := make(storemanager.QueryProtocol)
 	for dbName, tables := range schema {
@@ -260,15 +274,15 @@ func (db *DB) SetProtocolBySchema(password string, schema map[string]map[string]
 			protocol[dbName].Entities[table] = &entity
 		}
 	}
-	return db.SetProtocol(password, protocol)
+	return db.SetProtocol(name, secret, protocol)
 }
 
 // SetProtocolBySchema generates a protocol from a schema map and sets it using the global DB.
-func SetProtocolBySchema(password string, schema map[string]map[string]map[string]map[string]string) error {
+func SetProtocolBySchema(name, secret string, schema map[string]map[string]map[string]map[string]string) error {
 	if globalDB == nil {
 		return fmt.Errorf("global DB not initialized")
 	}
-	return globalDB.SetProtocolBySchema(password, schema)
+	return globalDB.SetProtocolBySchema(name, secret, schema)
 }
 
 // Global database instance for DSL functions
@@ -289,40 +303,73 @@ func GetProtoContext(password, entity, contextKey string) (string, error) {
 }
 
 // GetAllPks retrieves all primary keys for a given table using the global DB.
-func GetAllPks(dbName, tableName string) ([]string, error) {
+func GetAllPks(ctx context.Context, dbName, tableName string) ([]string, error) {
 	if globalDB == nil {
 		return nil, fmt.Errorf("global DB not initialized")
 	}
-	return globalDB.GetAllPks(dbName, tableName)
+	return globalDB.GetAllPks(ctx, dbName, tableName)
 }
 
 // GetDataByPKs retrieves multiple rows by their primary keys using the global DB.
-func GetDataByPKs(dbName, tableName string, pks []string) ([]map[string]interface{}, error) {
+func GetDataByPKs(ctx context.Context, dbName, tableName string, pks []string) ([]map[string]interface{}, error) {
 	if globalDB == nil {
 		return nil, fmt.Errorf("global DB not initialized")
 	}
-	return globalDB.GetDataByPKs(dbName, tableName, pks)
+	return globalDB.GetDataByPKs(ctx, dbName, tableName, pks)
+}
+
+// EachRowByPKs calls fn with each row of pks as it is read using the global DB.
+func EachRowByPKs(ctx context.Context, dbName, tableName string, pks []string, fn func(row *storemanager.Row) error) error {
+	if globalDB == nil {
+		return fmt.Errorf("global DB not initialized")
+	}
+	return globalDB.EachRowByPKs(ctx, dbName, tableName, pks, fn)
 }
 
 // GetPkByIndex retrieves the primary keys of rows using an indexed column value using the global DB.
-func GetPkByIndex(dbName, tableName, colName, value string) ([]string, error) {
+func GetPkByIndex(ctx context.Context, dbName, tableName, colName, value string) ([]string, error) {
+	if globalDB == nil {
+		return nil, fmt.Errorf("global DB not initialized")
+	}
+	return globalDB.GetPkByIndex(ctx, dbName, tableName, colName, value)
+}
+
+// GetPksByIndexRange retrieves the primary keys of rows matching a range on an indexed column using the global DB.
+func GetPksByIndexRange(ctx context.Context, dbName, tableName, colName string, bounds []storemanager.IndexBound) ([]string, error) {
 	if globalDB == nil {
 		return nil, fmt.Errorf("global DB not initialized")
 	}
-	return globalDB.GetPkByIndex(dbName, tableName, colName, value)
+	return globalDB.GetPksByIndexRange(ctx, dbName, tableName, colName, bounds)
+}
+
+// GetPksByCompositeIndex answers an AND-only filter with a composite index scan using the global DB.
+// The bool result is false if no composite index fits the filter.
+func GetPksByCompositeIndex(ctx context.Context, dbName, tableName string, filters []string, sortCol string, offset, limit int, reverse bool) ([]string, bool, error) {
+	if globalDB == nil {
+		return nil, false, fmt.Errorf("global DB not initialized")
+	}
+	return globalDB.GetPksByCompositeIndex(ctx, dbName, tableName, filters, sortCol, offset, limit, reverse)
+}
+
+// IsColumnIndexed reports whether queries can use the index of a column using the global DB.
+func IsColumnIndexed(dbName, tableName, colName string) bool {
+	if globalDB == nil {
+		return true
+	}
+	return globalDB.IsColumnIndexed(dbName, tableName, colName)
 }
 
 // GetWithPKs is an alias for GetDataByPKs to match DSL expectations.
-func GetWithPKs(dbName, tableName string, pks []string) ([]map[string]interface{}, error) {
-	return GetDataByPKs(dbName, tableName, pks)
+func GetWithPKs(ctx context.Context, dbName, tableName string, pks []string) ([]map[string]interface{}, error) {
+	return GetDataByPKs(ctx, dbName, tableName, pks)
 }
 
 // GetPksFromIndex is an alias for GetPkByIndex to match DSL expectations.
-func GetPksFromIndex(dbName, tableName, indexKey string) ([]string, error) {
+func GetPksFromIndex(ctx context.Context, dbName, tableName, indexKey string) ([]string, error) {
 	// indexKey is expected to be "col:val"
 	parts := strings.SplitN(indexKey, ":", 2)
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("invalid index key format: %s", indexKey)
 	}
-	return GetPkByIndex(dbName, tableName, parts[0], parts[1])
+	return GetPkByIndex(ctx, dbName, tableName, parts[0], parts[1])
 }
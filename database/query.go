@@ -42,13 +42,20 @@ For more details see: https://mariadb.com/bsl11/
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"onql/common"
 	"onql/storemanager"
 	"strconv"
 
 	"github.com/google/uuid"
 )
 
+// writeAttempts bounds how often Update and Delete retry after a concurrent
+// write to their row.
+const writeAttempts = 10
+
 // Insert adds a new row to a table.
 // It performs the following steps:
 // 1. Retrieves the table schema.
@@ -56,10 +63,133 @@ import (
 // 3. Constructs a Row object and delegates the insertion to the StoreManager.
 // Returns the primary key value of the inserted row and any error encountered.
 func (db *DB) Insert(dbName, tableName string, data map[string]interface{}) (string, error) {
+	row, pk, err := db.prepareInsert(dbName, tableName, data, db.sm.NextSequence)
+	if err != nil {
+		return "", err
+	}
+
+	// 3. Insert
+	if err := db.sm.Insert(dbName, tableName, row); err != nil {
+		return "", err
+	}
+
+	// 4. Return the primary key value
+	return pk, nil
+}
+
+// Upsert inserts a row, or resolves a conflict with the row holding the same
+// primary key as onConflict says. The data is validated and formatted once,
+// like an insert; a merge keeps the existing values of columns data leaves out.
+// It returns the primary key and the operation performed, see StoreManager.Upsert.
+func (db *DB) Upsert(dbName, tableName string, data map[string]interface{}, onConflict storemanager.ConflictAction) (string, string, error) {
+	row, pk, err := db.prepareInsert(dbName, tableName, data, db.sm.NextSequence)
+	if err != nil {
+		return "", "", err
+	}
+	op, err := db.sm.Upsert(dbName, tableName, row, onConflict, defaultedColumns(row, data))
+	if err != nil {
+		return "", "", err
+	}
+	return pk, op, nil
+}
+
+// defaultedColumns lists the columns of row that prepareInsert took from
+// column defaults rather than from data.
+func defaultedColumns(row storemanager.Row, data map[string]interface{}) []string {
+	var cols []string
+	for col := range row.Data {
+		if _, ok := data[col]; !ok {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// InsertResult is the outcome of one row of InsertMany.
+type InsertResult struct {
+	PK  string
+	Err error
+}
+
+// InsertMany adds rows to a table with the same validation and formatting as
+// Insert. Sequence values are reserved in one block per column and the rows
+// are written together; see StoreManager.InsertMany for how failures and
+// ordered are handled. It returns a result for every row attempted.
+func (db *DB) InsertMany(dbName, tableName string, data []map[string]interface{}, ordered bool) ([]InsertResult, error) {
+	_, table, err := db.sm.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reserve the $AUTO values of every row that does not set the column
+	next := make(map[string]int)
+	end := make(map[string]int)
+	for colName, colDef := range table.Columns {
+		if colDef.DefaultValue != "$AUTO" {
+			continue
+		}
+		n := 0
+		for _, d := range data {
+			if _, ok := d[colName]; !ok {
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		first, err := db.sm.ReserveSequence(dbName, tableName, colName, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate sequence for %s: %v", colName, err)
+		}
+		next[colName], end[colName] = first, first+n
+	}
+	sequence := func(dbName, tableName, colName string) (int, error) {
+		if next[colName] < end[colName] {
+			next[colName]++
+			return next[colName] - 1, nil
+		}
+		return db.sm.NextSequence(dbName, tableName, colName)
+	}
+
+	results := make([]InsertResult, 0, len(data))
+	rows := make([]storemanager.Row, 0, len(data))
+	index := make([]int, 0, len(data)) // position in results of each row
+	for _, d := range data {
+		row, pk, err := db.prepareInsert(dbName, tableName, d, sequence)
+		results = append(results, InsertResult{PK: pk, Err: err})
+		if err != nil {
+			if ordered {
+				break
+			}
+			continue
+		}
+		rows = append(rows, row)
+		index = append(index, len(results)-1)
+	}
+
+	errs := db.sm.InsertMany(dbName, tableName, rows, ordered)
+	for i, err := range errs {
+		results[index[i]].Err = err
+	}
+	if ordered && len(errs) < len(rows) {
+		results = results[:index[len(errs)-1]+1]
+	}
+	for i := range results {
+		if results[i].Err != nil {
+			results[i].PK = ""
+		}
+	}
+	return results, nil
+}
+
+// prepareInsert applies defaults, validators and formatters to data and
+// returns the row to store together with its primary key value. Sequence
+// values for $AUTO columns are taken from sequence.
+func (db *DB) prepareInsert(dbName, tableName string, data map[string]interface{}, sequence func(dbName, tableName, colName string) (int, error)) (storemanager.Row, string, error) {
 	// 1. Get Schema
 	_, table, err := db.sm.GetTableSchema(dbName, tableName)
 	if err != nil {
-		return "", err
+		return storemanager.Row{}, "", err
 	}
 
 	// 2. Validate and Format
@@ -73,9 +203,9 @@ func (db *DB) Insert(dbName, tableName string, data map[string]interface{}) (str
 			if defStr, ok := colDef.DefaultValue.(string); ok {
 				if defStr == "$AUTO" {
 					// Generate Sequence
-					seqVal, err := db.sm.NextSequence(dbName, tableName, colName)
+					seqVal, err := sequence(dbName, tableName, colName)
 					if err != nil {
-						return "", fmt.Errorf("failed to generate sequence for %s: %v", colName, err)
+						return storemanager.Row{}, "", fmt.Errorf("failed to generate sequence for %s: %v", colName, err)
 					}
 					val = seqVal
 					exists = true
@@ -116,7 +246,7 @@ func (db *DB) Insert(dbName, tableName string, data map[string]interface{}) (str
 			// Validator handles "required".
 			if !exists {
 				if err := Validate(nil, colDef.ValidatorRules); err != nil {
-					return "", fmt.Errorf("column %s: %v", colName, err)
+					return storemanager.Row{}, "", fmt.Errorf("%w: column %s: %v", common.ErrInvalidInput, colName, err)
 				}
 			} else {
 				// Runtime check: if default was applied AND it was $EMPTY (resulting in empty string),
@@ -146,11 +276,11 @@ func (db *DB) Insert(dbName, tableName string, data map[string]interface{}) (str
 				}
 
 				if err := Validate(val, rules); err != nil {
-					return "", fmt.Errorf("column %s: %v", colName, err)
+					return storemanager.Row{}, "", fmt.Errorf("%w: column %s: %v", common.ErrInvalidInput, colName, err)
 				}
 				// Type check
 				if err := ValidateType(val, string(colDef.Type)); err != nil {
-					return "", fmt.Errorf("column %s: %v", colName, err)
+					return storemanager.Row{}, "", fmt.Errorf("%w: column %s: %v", common.ErrInvalidInput, colName, err)
 				}
 			}
 		}
@@ -160,7 +290,7 @@ func (db *DB) Insert(dbName, tableName string, data map[string]interface{}) (str
 			if len(colDef.FormatterRules) > 0 {
 				formattedVal, err := Format(val, colDef.FormatterRules)
 				if err != nil {
-					return "", fmt.Errorf("column %s format error: %v", colName, err)
+					return storemanager.Row{}, "", fmt.Errorf("%w: column %s format error: %v", common.ErrInvalidInput, colName, err)
 				}
 				val = formattedVal
 			}
@@ -168,19 +298,11 @@ func (db *DB) Insert(dbName, tableName string, data map[string]interface{}) (str
 		}
 	}
 
-	// 3. Insert
-	row := storemanager.Row{Data: processedData}
-	err = db.sm.Insert(dbName, tableName, row)
-	if err != nil {
-		return "", err
-	}
-
-	// 4. Return the primary key value
 	pkVal, ok := processedData[table.PK]
 	if !ok {
-		return "", fmt.Errorf("primary key %s not found in processed data", table.PK)
+		return storemanager.Row{}, "", fmt.Errorf("%w: primary key %s not found in processed data", common.ErrInvalidInput, table.PK)
 	}
-	return fmt.Sprintf("%v", pkVal), nil
+	return storemanager.Row{Data: processedData}, fmt.Sprintf("%v", pkVal), nil
 }
 
 // Update modifies an existing row in a table.
@@ -190,11 +312,62 @@ func (db *DB) Insert(dbName, tableName string, data map[string]interface{}) (str
 // 3. Fetches the existing row.
 // 4. Merges the new data with the existing row.
 // 5. Delegates the update to the StoreManager.
-func (db *DB) Update(dbName, tableName, pk string, data map[string]interface{}) error {
+// Steps 3 to 5 run as one transaction, retried if another writer changes the
+// row in between, so concurrent updates never undo each other's columns.
+// If ifVersion is set the row must be at that version, otherwise the update
+// fails with common.ErrVersionConflict.
+// Returns the row as written, with its new version.
+func (db *DB) Update(dbName, tableName, pk string, data map[string]interface{}, ifVersion *uint64) (map[string]interface{}, error) {
+	processedData, err := db.prepareUpdate(dbName, tableName, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var row map[string]interface{}
+	err = db.retry(func(tx *Tx) error {
+		var err error
+		row, err = tx.update(dbName, tableName, pk, processedData, ifVersion)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// retry runs fn in a transaction and commits it, starting over if the commit
+// fails with common.ErrConflict.
+func (db *DB) retry(fn func(tx *Tx) error) error {
+	var err error
+	for attempt := 0; attempt < writeAttempts; attempt++ {
+		tx := db.Begin()
+		if err = fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); !errors.Is(err, common.ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// checkVersion fails with common.ErrVersionConflict unless ifVersion is nil or
+// the version of row. Rows written before versions existed are at version 0.
+func checkVersion(pk string, row *storemanager.Row, ifVersion *uint64) error {
+	if ifVersion != nil && row.Version != *ifVersion {
+		return fmt.Errorf("%w: row %s is at version %d, not %d", common.ErrVersionConflict, pk, row.Version, *ifVersion)
+	}
+	return nil
+}
+
+// prepareUpdate validates and formats the columns present in a partial update.
+// Unknown columns are dropped.
+func (db *DB) prepareUpdate(dbName, tableName string, data map[string]interface{}) (map[string]interface{}, error) {
 	// 1. Get Schema
 	_, table, err := db.sm.GetTableSchema(dbName, tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 2. Validate and Format
@@ -229,47 +402,34 @@ func (db *DB) Update(dbName, tableName, pk string, data map[string]interface{})
 
 		if len(colDef.ValidatorRules) > 0 {
 			if err := Validate(val, colDef.ValidatorRules); err != nil {
-				return fmt.Errorf("column %s: %v", key, err)
+				return nil, fmt.Errorf("%w: column %s: %v", common.ErrInvalidInput, key, err)
 			}
 			if err := ValidateType(val, string(colDef.Type)); err != nil {
-				return fmt.Errorf("column %s: %v", key, err)
+				return nil, fmt.Errorf("%w: column %s: %v", common.ErrInvalidInput, key, err)
 			}
 		}
 
 		if len(colDef.FormatterRules) > 0 {
 			formattedVal, err := Format(val, colDef.FormatterRules)
 			if err != nil {
-				return fmt.Errorf("column %s format error: %v", key, err)
+				return nil, fmt.Errorf("%w: column %s format error: %v", common.ErrInvalidInput, key, err)
 			}
 			val = formattedVal
 		}
 		processedData[key] = val
 	}
 
-	// Merge with existing data?
-	// StoreManager.Update replaces the row.
-	// So we MUST fetch the old row, merge, and then save.
-	// StoreManager.Update implementation:
-	// "Get old row... Serialize new data... Update Buffer"
-	// It seems my StoreManager.Update REPLACES the content.
-	// So I need to fetch, merge, then call sm.Update.
-
-	oldRow, err := db.sm.Get(dbName, tableName, pk)
-	if err != nil {
-		return err
-	}
-
-	for k, v := range processedData {
-		oldRow.Data[k] = v
-	}
-
-	return db.sm.Update(dbName, tableName, pk, *oldRow)
+	return processedData, nil
 }
 
 // Delete removes a row from a table by its primary key.
-// It delegates to the underlying StoreManager.
-func (db *DB) Delete(dbName, tableName, pk string) error {
-	return db.sm.Delete(dbName, tableName, pk)
+// Like Update it runs as a transaction, retried on conflict. If ifVersion is
+// set the row must be at that version, otherwise it fails with
+// common.ErrVersionConflict.
+func (db *DB) Delete(dbName, tableName, pk string, ifVersion *uint64) error {
+	return db.retry(func(tx *Tx) error {
+		return tx.Delete(dbName, tableName, pk, ifVersion)
+	})
 }
 
 // Get retrieves a single row from a table by its primary key.
@@ -284,18 +444,36 @@ func (db *DB) Get(dbName, tableName, pk string) (map[string]interface{}, error)
 
 // GetPkByIndex retrieves the primary keys of rows using an indexed column value.
 // It delegates to the underlying StoreManager.
-func (db *DB) GetPkByIndex(dbName, tableName, colName, value string) ([]string, error) {
-	return db.sm.GetPkByIndex(dbName, tableName, colName, value)
+func (db *DB) GetPkByIndex(ctx context.Context, dbName, tableName, colName, value string) ([]string, error) {
+	return db.sm.GetPkByIndex(ctx, dbName, tableName, colName, value)
+}
+
+// GetPksByIndexRange retrieves the primary keys of rows whose indexed column value
+// satisfies all bounds. It delegates to the underlying StoreManager.
+func (db *DB) GetPksByIndexRange(ctx context.Context, dbName, tableName, colName string, bounds []storemanager.IndexBound) ([]string, error) {
+	return db.sm.GetPksByIndexRange(ctx, dbName, tableName, colName, bounds)
+}
+
+// GetPksByCompositeIndex answers an AND-only filter with a composite index scan if one fits.
+// It delegates to the underlying StoreManager.
+func (db *DB) GetPksByCompositeIndex(ctx context.Context, dbName, tableName string, filters []string, sortCol string, offset, limit int, reverse bool) ([]string, bool, error) {
+	return db.sm.GetPksByCompositeIndex(ctx, dbName, tableName, filters, sortCol, offset, limit, reverse)
 }
 
 // GetAllPks retrieves all primary keys for a given table.
 // It delegates to the underlying StoreManager.
-func (db *DB) GetAllPks(dbName, tableName string) ([]string, error) {
-	return db.sm.GetAllPks(dbName, tableName)
+func (db *DB) GetAllPks(ctx context.Context, dbName, tableName string) ([]string, error) {
+	return db.sm.GetAllPks(ctx, dbName, tableName)
 }
 
 // GetDataByPKs retrieves multiple rows by their primary keys.
 // It delegates to the underlying StoreManager.
-func (db *DB) GetDataByPKs(dbName, tableName string, pks []string) ([]map[string]interface{}, error) {
-	return db.sm.GetDataByPKs(dbName, tableName, pks)
+func (db *DB) GetDataByPKs(ctx context.Context, dbName, tableName string, pks []string) ([]map[string]interface{}, error) {
+	return db.sm.GetDataByPKs(ctx, dbName, tableName, pks)
+}
+
+// EachRowByPKs calls fn with each row of pks as it is read, stopping at the first error.
+// It delegates to the underlying StoreManager.
+func (db *DB) EachRowByPKs(ctx context.Context, dbName, tableName string, pks []string, fn func(row *storemanager.Row) error) error {
+	return db.sm.EachRowByPKs(ctx, dbName, tableName, pks, fn)
 }
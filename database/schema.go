@@ -43,6 +43,7 @@ package database
 
 import (
 	"fmt"
+	"onql/common"
 	"onql/storemanager"
 	"strings"
 )
@@ -63,7 +64,7 @@ func (db *DB) CreateTable(dbName string, table storemanager.Table) error {
 		case storemanager.TypeString, storemanager.TypeNumber, storemanager.TypeTimestamp, storemanager.TypeJSON:
 			// ok
 		default:
-			return fmt.Errorf("invalid type %s for column %s", col.Type, col.Name)
+			return fmt.Errorf("%w: invalid type %s for column %s", common.ErrInvalidInput, col.Type, col.Name)
 		}
 
 		// Validate Formatter/Validator strings syntax
@@ -120,9 +121,38 @@ func (db *DB) AlterTable(dbName, tableName string, changes map[string]interface{
 	return db.sm.AlterTable(dbName, tableName, changes)
 }
 
+// BuildColumnIndex starts building the index of an unindexed column in the background.
+// It delegates to the underlying StoreManager.
+func (db *DB) BuildColumnIndex(dbName, tableName, colName string) error {
+	return db.sm.BuildColumnIndex(dbName, tableName, colName)
+}
+
+// DropColumnIndex removes the index of a column in the background.
+// It delegates to the underlying StoreManager.
+func (db *DB) DropColumnIndex(dbName, tableName, colName string) error {
+	return db.sm.DropColumnIndex(dbName, tableName, colName)
+}
+
+// PurgeStatus lists the dropped tables and databases whose keys are still being deleted.
+// It delegates to the underlying StoreManager.
+func (db *DB) PurgeStatus() ([]storemanager.Tombstone, error) {
+	return db.sm.PurgeStatus()
+}
+
 // GetTableSchema retrieves the schema definition for a table.
 // It delegates to the underlying StoreManager.
 func (db *DB) GetTableSchema(dbName, tableName string) (*storemanager.Table, error) {
 	_, table, err := db.sm.GetTableSchema(dbName, tableName)
 	return table, err
 }
+
+// IsColumnIndexed reports whether queries can use the index of a column.
+// Unknown tables and columns report true so the index lookup reports them.
+func (db *DB) IsColumnIndexed(dbName, tableName, colName string) bool {
+	_, table, err := db.sm.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return true
+	}
+	col, ok := table.Columns[colName]
+	return !ok || col.Indexed
+}
@@ -0,0 +1,156 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package database
+
+import "onql/storemanager"
+
+// Tx is a transaction over the high-level database API.
+// Writes go through the same validation and formatting as DB.Insert and
+// DB.Update, are staged privately and become visible together on Commit.
+type Tx struct {
+	db  *DB
+	txn *storemanager.Txn
+}
+
+// Begin starts a new transaction.
+func (db *DB) Begin() *Tx {
+	return &Tx{db: db, txn: db.sm.Begin()}
+}
+
+// Insert stages a new row and returns its primary key value.
+func (tx *Tx) Insert(dbName, tableName string, data map[string]interface{}) (string, error) {
+	row, pk, err := tx.db.prepareInsert(dbName, tableName, data, tx.db.sm.NextSequence)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.txn.Insert(dbName, tableName, row); err != nil {
+		return "", err
+	}
+	return pk, nil
+}
+
+// Upsert stages an insert, or the resolution of a conflict with the row holding
+// the same primary key; see DB.Upsert.
+func (tx *Tx) Upsert(dbName, tableName string, data map[string]interface{}, onConflict storemanager.ConflictAction) (string, string, error) {
+	row, pk, err := tx.db.prepareInsert(dbName, tableName, data, tx.db.sm.NextSequence)
+	if err != nil {
+		return "", "", err
+	}
+	op, err := tx.txn.Upsert(dbName, tableName, row, onConflict, defaultedColumns(row, data))
+	if err != nil {
+		return "", "", err
+	}
+	return pk, op, nil
+}
+
+// Update stages a partial update of the row at pk, merged with the row as the
+// transaction currently sees it. If ifVersion is set the row must be at that
+// version, see DB.Update. Returns the row as staged, with its new version.
+func (tx *Tx) Update(dbName, tableName, pk string, data map[string]interface{}, ifVersion *uint64) (map[string]interface{}, error) {
+	processedData, err := tx.db.prepareUpdate(dbName, tableName, data)
+	if err != nil {
+		return nil, err
+	}
+	return tx.update(dbName, tableName, pk, processedData, ifVersion)
+}
+
+// update merges already prepared data onto the row at pk and stages it.
+func (tx *Tx) update(dbName, tableName, pk string, processedData map[string]interface{}, ifVersion *uint64) (map[string]interface{}, error) {
+	oldRow, err := tx.txn.Get(dbName, tableName, pk)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(pk, oldRow, ifVersion); err != nil {
+		return nil, err
+	}
+	for k, v := range processedData {
+		oldRow.Data[k] = v
+	}
+
+	if err := tx.txn.Update(dbName, tableName, pk, *oldRow); err != nil {
+		return nil, err
+	}
+
+	// The staged change record holds oldRow.Data, so the version goes on a copy
+	row := make(map[string]interface{}, len(oldRow.Data)+1)
+	for k, v := range oldRow.Data {
+		row[k] = v
+	}
+	row[storemanager.VersionField] = oldRow.Version + 1
+	return row, nil
+}
+
+// Delete stages the removal of the row at pk. If ifVersion is set the row
+// must be at that version, see DB.Delete.
+func (tx *Tx) Delete(dbName, tableName, pk string, ifVersion *uint64) error {
+	if ifVersion != nil {
+		row, err := tx.txn.Get(dbName, tableName, pk)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(pk, row, ifVersion); err != nil {
+			return err
+		}
+	}
+	return tx.txn.Delete(dbName, tableName, pk)
+}
+
+// Get retrieves a row as the transaction sees it, including its own staged writes.
+func (tx *Tx) Get(dbName, tableName, pk string) (map[string]interface{}, error) {
+	row, err := tx.txn.Get(dbName, tableName, pk)
+	if err != nil {
+		return nil, err
+	}
+	return row.Data, nil
+}
+
+// Commit applies all staged writes atomically.
+// It returns common.ErrConflict if a row the transaction touched was changed
+// by someone else since it was first read.
+func (tx *Tx) Commit() error {
+	return tx.txn.Commit()
+}
+
+// Rollback discards all staged writes.
+func (tx *Tx) Rollback() {
+	tx.txn.Rollback()
+}
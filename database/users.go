@@ -0,0 +1,122 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package database
+
+import "onql/storemanager"
+
+// AuthEnabled reports whether connections must authenticate.
+// It delegates to the underlying StoreManager.
+func (db *DB) AuthEnabled() bool {
+	return db.sm.AuthEnabled()
+}
+
+// Authenticate checks a user's password.
+// It delegates to the underlying StoreManager.
+func (db *DB) Authenticate(name, password string) error {
+	return db.sm.Authenticate(name, password)
+}
+
+// UserBySubject returns the user bound to a TLS client certificate subject.
+// It delegates to the underlying StoreManager.
+func (db *DB) UserBySubject(subject string) string {
+	return db.sm.UserBySubject(subject)
+}
+
+// Permits reports whether a user may perform perm on a database.
+// It delegates to the underlying StoreManager.
+func (db *DB) Permits(userName, dbName, perm string) bool {
+	return db.sm.Permits(userName, dbName, perm)
+}
+
+// CreateUser adds a user with a password and roles.
+// It delegates to the underlying StoreManager.
+func (db *DB) CreateUser(name, password string, roles []string) error {
+	return db.sm.CreateUser(name, password, roles)
+}
+
+// DropUser removes a user.
+// It delegates to the underlying StoreManager.
+func (db *DB) DropUser(name string) error {
+	return db.sm.DropUser(name)
+}
+
+// SetUserPassword replaces the password of a user.
+// It delegates to the underlying StoreManager.
+func (db *DB) SetUserPassword(name, password string) error {
+	return db.sm.SetUserPassword(name, password)
+}
+
+// SetUserRoles replaces the roles of a user.
+// It delegates to the underlying StoreManager.
+func (db *DB) SetUserRoles(name string, roles []string) error {
+	return db.sm.SetUserRoles(name, roles)
+}
+
+// SetUserSubject binds a TLS client certificate subject to a user.
+// It delegates to the underlying StoreManager.
+func (db *DB) SetUserSubject(name, subject string) error {
+	return db.sm.SetUserSubject(name, subject)
+}
+
+// ListUsers returns all users without their password hashes.
+// It delegates to the underlying StoreManager.
+func (db *DB) ListUsers() []storemanager.User {
+	return db.sm.ListUsers()
+}
+
+// SetRole creates or replaces a role.
+// It delegates to the underlying StoreManager.
+func (db *DB) SetRole(role storemanager.Role) error {
+	return db.sm.SetRole(role)
+}
+
+// DropRole removes a role.
+// It delegates to the underlying StoreManager.
+func (db *DB) DropRole(name string) error {
+	return db.sm.DropRole(name)
+}
+
+// ListRoles returns all roles.
+// It delegates to the underlying StoreManager.
+func (db *DB) ListRoles() []storemanager.Role {
+	return db.sm.ListRoles()
+}
@@ -20,10 +20,8 @@ func (e *Evaluator) Eval() error {
 
 	for {
 		// Check for timeout/cancellation
-		select {
-		case <-e.Ctx.Done():
-			return e.Ctx.Err()
-		default:
+		if err := e.checkCtx(); err != nil {
+			return err
 		}
 
 		stmt := e.Plan.NextStatement(false)
@@ -38,6 +36,17 @@ func (e *Evaluator) Eval() error {
 	return nil
 }
 
+// checkCtx returns the context's error once the query is cancelled or timed out.
+// Loops over rows call it so that cancellation takes effect promptly.
+func (e *Evaluator) checkCtx() error {
+	select {
+	case <-e.Ctx.Done():
+		return e.Ctx.Err()
+	default:
+		return nil
+	}
+}
+
 func (e *Evaluator) EvalStatement() error {
 	stmt := e.Plan.NextStatement(false)
 	fmt.Println("Evaluating statement:", stmt.Name, "Operation:", stmt.Operation)
@@ -68,6 +68,9 @@ func (e *Evaluator) EvalFilter() error {
 	} else {
 		var savedEndFilterPos int
 		for _, row := range tableData {
+			if err := e.checkCtx(); err != nil {
+				return err
+			}
 			// Apply filter conditions
 			// e.Memory[filterStmt.Name] = row
 			e.SetMemoryValue(filterStmt.Name, row)
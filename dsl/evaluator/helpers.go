@@ -1,26 +1,27 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"onql/database"
 	"onql/storemanager"
 	"strings"
 )
 
-func GetTableData(db string, table string, offset, limit int) ([]map[string]any, error) {
-	pks, err := database.GetAllPksWithLimits(db, table, offset, limit, false) // Default reverse=false for now
+func (e *Evaluator) GetTableData(db string, table string, offset, limit int) ([]map[string]any, error) {
+	pks, err := database.GetAllPksWithLimits(e.Ctx, db, table, offset, limit, false) // Default reverse=false for now
 	if err != nil {
 		return nil, err
 	}
 	// fmt.Println(db,table)
-	data, err := database.GetWithPKs(db, table, pks)
+	data, err := e.loadRows(db, table, pks)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
-func GetTableDataSortedAndFiltered(db, table, sortCol string, filters []string, offset, limit int, reverse bool) ([]map[string]any, error) {
+func (e *Evaluator) GetTableDataSortedAndFiltered(db, table, sortCol string, filters []string, offset, limit int, reverse bool) ([]map[string]any, error) {
 	// Use Smart Index Scan: Iterate Index(SortCol) and check filters.
 	// For now, let's implement validation logic in Evaluator or Database.
 	// We need `database.GetPksSortedByColWithFilter`?
@@ -56,24 +57,42 @@ func GetTableDataSortedAndFiltered(db, table, sortCol string, filters []string,
 	// Let's implement the "Smart Index Scan" method in `database` package.
 	// `database.GetPksSortedByColWithFilter`
 
-	pks, err := database.GetPksSortedByColWithFilter(db, table, sortCol, offset, limit, reverse, filters)
+	// A composite index with the filter's equality columns followed by sortCol
+	// yields matching rows already in order, with no per-row filter check.
+	pks, ok, err := database.GetPksByCompositeIndex(e.Ctx, db, table, filters, sortCol, offset, limit, reverse)
 	if err != nil {
 		return nil, err
 	}
-	return database.GetWithPKs(db, table, pks)
+	if !ok {
+		pks, err = database.GetPksSortedByColWithFilter(e.Ctx, db, table, sortCol, offset, limit, reverse, filters)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e.loadRows(db, table, pks)
 }
 
-func GetTableDataSorted(db, table, col string, offset, limit int, reverse bool) ([]map[string]any, error) {
-	pks, err := database.GetPksSortedByCol(db, table, col, offset, limit, reverse)
+func (e *Evaluator) GetTableDataSorted(db, table, col string, offset, limit int, reverse bool) ([]map[string]any, error) {
+	pks, err := database.GetPksSortedByCol(e.Ctx, db, table, col, offset, limit, reverse)
 	if err != nil {
 		return nil, err
 	}
-	return database.GetWithPKs(db, table, pks)
+	return e.loadRows(db, table, pks)
 }
 
-func GetTableWithDataWithFilters(db, table string, filters []string, offset, limit int) ([]map[string]any, error) {
+func (e *Evaluator) GetTableWithDataWithFilters(db, table string, filters []string, offset, limit int) ([]map[string]any, error) {
 	if len(filters) == 0 {
-		return GetTableData(db, table, offset, limit)
+		return e.GetTableData(db, table, offset, limit)
+	}
+
+	// A composite index covering the filter answers it with one scan
+	if pks, ok, err := database.GetPksByCompositeIndex(e.Ctx, db, table, filters, "", offset, limit, false); err != nil {
+		return nil, err
+	} else if ok {
+		if len(pks) == 0 {
+			return []map[string]any{}, nil
+		}
+		return e.loadRows(db, table, pks)
 	}
 
 	trim := func(s string) string { return strings.TrimSpace(s) }
@@ -82,8 +101,12 @@ func GetTableWithDataWithFilters(db, table string, filters []string, offset, lim
 		return ls == "and" || ls == "or"
 	}
 
-	// Stack of PK sets for pending expressions.
-	stack := make([][]string, 0, len(filters))
+	// Stack of pending expressions. Range tokens stay unresolved until they
+	// meet an operator, so "col>=:a", "col<:b", "and" becomes one bounded
+	// index scan instead of two open-ended scans intersected in memory.
+	// Negations keep the excluded PK set and are only subtracted from the
+	// table's full PK set if nothing positive narrows them first.
+	stack := make([]filterOperand, 0, len(filters))
 
 	for i, tok := range filters {
 		tok = trim(tok)
@@ -91,6 +114,19 @@ func GetTableWithDataWithFilters(db, table string, filters []string, offset, lim
 			continue
 		}
 
+		if strings.ToLower(tok) == "not" {
+			if len(stack) < 1 {
+				return nil, fmt.Errorf("operator %q at index %d without a preceding expression", tok, i)
+			}
+			operand, err := stack[len(stack)-1].materialize(e.Ctx, db, table)
+			if err != nil {
+				return nil, err
+			}
+			operand.negated = !operand.negated
+			stack[len(stack)-1] = operand
+			continue
+		}
+
 		if isOp(tok) {
 			if len(stack) < 2 {
 				return nil, fmt.Errorf("operator %q at index %d without two preceding expressions", tok, i)
@@ -99,29 +135,60 @@ func GetTableWithDataWithFilters(db, table string, filters []string, offset, lim
 			left := stack[len(stack)-2]
 			stack = stack[:len(stack)-2]
 
-			var merged []string
-			if strings.ToLower(tok) == "and" {
-				merged = intersect(left, right) // AND = intersection
-			} else {
-				merged = union(left, right) // OR = union
+			and := strings.ToLower(tok) == "and"
+			if and && left.rangeCol != "" && left.rangeCol == right.rangeCol {
+				// Same column on both sides: merge the bounds into a single range
+				left.bounds = append(append([]storemanager.IndexBound{}, left.bounds...), right.bounds...)
+				stack = append(stack, left)
+				continue
+			}
+
+			left, err := left.materialize(e.Ctx, db, table)
+			if err != nil {
+				return nil, err
+			}
+			right, err = right.materialize(e.Ctx, db, table)
+			if err != nil {
+				return nil, err
 			}
-			stack = append(stack, dedupe(merged))
+			stack = append(stack, combine(left, right, and))
 			continue
 		}
 
-		// Expression token: "col:val"
-		parts := strings.SplitN(tok, ":", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("bad filter token %q at index %d; expected 'col:val'", tok, i)
+		// Expression token: "col:val", "col<op>:val" or `col in:["a","b"]`
+		col, op, val, err := storemanager.ParseFilterToken(tok)
+		if err != nil {
+			return nil, fmt.Errorf("%v at index %d", err, i)
 		}
-		col := trim(parts[0])
-		val := trim(parts[1])
 
-		pk, err := database.GetPksFromIndex(db, table, col+":"+val)
-		if err != nil {
-			return nil, err
+		switch {
+		case storemanager.IsRangeOp(op):
+			stack = append(stack, filterOperand{
+				rangeCol: col,
+				bounds:   []storemanager.IndexBound{{Op: op, Value: val}},
+			})
+		case op == "in":
+			values, err := storemanager.ParseFilterList(val)
+			if err != nil {
+				return nil, err
+			}
+			matched := make([]string, 0)
+			for _, v := range values {
+				pk, err := database.GetPksFromIndex(e.Ctx, db, table, col+":"+v)
+				if err != nil {
+					return nil, err
+				}
+				matched = append(matched, pk...)
+			}
+			stack = append(stack, filterOperand{pks: dedupe(matched)})
+		default:
+			pk, err := database.GetPksFromIndex(e.Ctx, db, table, col+":"+val)
+			if err != nil {
+				return nil, err
+			}
+			// col != val is the complement of col = val
+			stack = append(stack, filterOperand{pks: dedupe(pk), negated: op == "!="})
 		}
-		stack = append(stack, dedupe(pk))
 	}
 
 	// After consuming all tokens, we should have exactly one PK set.
@@ -132,7 +199,19 @@ func GetTableWithDataWithFilters(db, table string, filters []string, offset, lim
 		return nil, fmt.Errorf("incomplete filter: leftover %d uncombined expressions (missing operator)", len(stack)-1)
 	}
 
-	pks := dedupe(stack[0])
+	result, err := stack[0].materialize(e.Ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	pks := result.pks
+	if result.negated {
+		all, err := database.GetAllPks(e.Ctx, db, table)
+		if err != nil {
+			return nil, err
+		}
+		pks = difference(all, pks)
+	}
+	pks = dedupe(pks)
 
 	// Apply Offset/Limit
 	if offset > 0 {
@@ -149,33 +228,33 @@ func GetTableWithDataWithFilters(db, table string, filters []string, offset, lim
 	if len(pks) == 0 {
 		return []map[string]any{}, nil
 	}
-	return database.GetWithPKs(db, table, pks)
+	return e.loadRows(db, table, pks)
 }
 
-func GetRelatedTableData(db string, relation storemanager.Relation, value string) ([]map[string]any, error) {
+func (e *Evaluator) GetRelatedTableData(db string, relation storemanager.Relation, value string) ([]map[string]any, error) {
 	//two probelems pending first original col name table name and db name not alias second mtm through table thirds in oto and mto case send dict not array
 	if relation.Type == "mtm" {
-		return GetMTMRelatedTabledData(db, relation, value)
+		return e.GetMTMRelatedTabledData(db, relation, value)
 	}
 	cols := strings.Split(relation.FKField, ":")
-	pks, err := database.GetPksFromIndex(db, relation.Entity, cols[1]+":"+value)
+	pks, err := database.GetPksFromIndex(e.Ctx, db, relation.Entity, cols[1]+":"+value)
 	if err != nil {
 		return nil, err
 	}
-	data, err := database.GetWithPKs(db, relation.Entity, pks)
+	data, err := e.loadRows(db, relation.Entity, pks)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
-func GetMTMRelatedTabledData(db string, relation storemanager.Relation, value string) ([]map[string]any, error) {
+func (e *Evaluator) GetMTMRelatedTabledData(db string, relation storemanager.Relation, value string) ([]map[string]any, error) {
 	cols := strings.Split(relation.FKField, ":")
-	pks, err := database.GetPksFromIndex(db, relation.Through, cols[1]+":"+value)
+	pks, err := database.GetPksFromIndex(e.Ctx, db, relation.Through, cols[1]+":"+value)
 	if err != nil {
 		return nil, err
 	}
-	data, err := database.GetWithPKs(db, relation.Through, pks)
+	data, err := database.GetWithPKs(e.Ctx, db, relation.Through, pks)
 	if err != nil {
 		return nil, err
 	}
@@ -185,19 +264,19 @@ func GetMTMRelatedTabledData(db string, relation storemanager.Relation, value st
 			values = append(values, val.(string))
 		}
 	}
-	return GetTableDataWithColValues(db, relation.Entity, cols[3], values)
+	return e.GetTableDataWithColValues(db, relation.Entity, cols[3], values)
 }
 
-func GetTableDataWithColValues(db string, table string, col string, values []string) ([]map[string]any, error) {
+func (e *Evaluator) GetTableDataWithColValues(db string, table string, col string, values []string) ([]map[string]any, error) {
 	pksOuter := make([]string, 0)
 	for _, value := range values {
-		pks, err := database.GetPksFromIndex(db, table, col+":"+value)
+		pks, err := database.GetPksFromIndex(e.Ctx, db, table, col+":"+value)
 		if err != nil {
 			return nil, err
 		}
 		pksOuter = append(pksOuter, pks...)
 	}
-	data, err := database.GetWithPKs(db, table, pksOuter)
+	data, err := e.loadRows(db, table, pksOuter)
 	if err != nil {
 		return nil, err
 	}
@@ -212,6 +291,75 @@ func GetTableDataWithColValues(db string, table string, col string, values []str
 // 	return value, nil
 // }
 
+// loadRows reads the rows of pks, charging each against the query's limits as
+// it is read, so a query over its limits stops without loading the rest.
+// With e.Versions set the rows carry their version.
+func (e *Evaluator) loadRows(db, table string, pks []string) ([]map[string]any, error) {
+	var data []map[string]any
+	err := database.EachRowByPKs(e.Ctx, db, table, pks, func(row *storemanager.Row) error {
+		if e.Versions {
+			row.Data[storemanager.VersionField] = row.Version
+		}
+		if err := e.Limits.chargeRow(row.Data); err != nil {
+			return err
+		}
+		data = append(data, row.Data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// filterOperand is a pending filter expression: a PK set, a range on one
+// column whose bounds may still be narrowed by an "and", or a negation
+// holding the PKs it excludes.
+type filterOperand struct {
+	pks      []string
+	negated  bool
+	rangeCol string
+	bounds   []storemanager.IndexBound
+}
+
+// materialize resolves a pending range into its PK set.
+func (o filterOperand) materialize(ctx context.Context, db, table string) (filterOperand, error) {
+	if o.rangeCol == "" {
+		return o, nil
+	}
+	pks, err := database.GetPksByIndexRange(ctx, db, table, o.rangeCol, o.bounds)
+	if err != nil {
+		return o, err
+	}
+	return filterOperand{pks: pks}, nil
+}
+
+// combine applies "and"/"or" to two materialized operands without expanding
+// negations, using De Morgan's laws where both sides are negated.
+func combine(left, right filterOperand, and bool) filterOperand {
+	switch {
+	case !left.negated && !right.negated:
+		if and {
+			return filterOperand{pks: dedupe(intersect(left.pks, right.pks))} // AND = intersection
+		}
+		return filterOperand{pks: dedupe(union(left.pks, right.pks))} // OR = union
+	case left.negated && right.negated:
+		if and {
+			return filterOperand{pks: dedupe(union(left.pks, right.pks)), negated: true}
+		}
+		return filterOperand{pks: dedupe(intersect(left.pks, right.pks)), negated: true}
+	}
+
+	pos, neg := left, right
+	if left.negated {
+		pos, neg = right, left
+	}
+	if and {
+		return filterOperand{pks: difference(pos.pks, neg.pks)} // a AND NOT b = a - b
+	}
+	return filterOperand{pks: difference(neg.pks, pos.pks), negated: true} // a OR NOT b = NOT (b - a)
+}
+
 // ---------------------- set helpers ----------------------
 
 func union(a, b []string) []string {
@@ -270,3 +418,18 @@ func dedupe(in []string) []string {
 	}
 	return out
 }
+
+// difference returns the elements of a that are not in b, keeping a's order.
+func difference(a, b []string) []string {
+	drop := make(map[string]struct{}, len(b))
+	for _, x := range b {
+		drop[x] = struct{}{}
+	}
+	out := make([]string, 0, len(a))
+	for _, x := range a {
+		if _, ok := drop[x]; !ok {
+			out = append(out, x)
+		}
+	}
+	return out
+}
@@ -72,6 +72,9 @@ func (e *Evaluator) EvalProjection() error {
 	} else {
 		var savedEndProjectionPos int
 		for _, row := range tableData {
+			if err := e.checkCtx(); err != nil {
+				return err
+			}
 			e.SetMemoryValue(pStmt.Name, row)
 			obj := make(map[string]any)
 
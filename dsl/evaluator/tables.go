@@ -92,6 +92,8 @@ func (e *Evaluator) EvalTableWithContext() error {
 		return err
 	}
 	eval := NewEvaluator(e.Ctx, plan, "", []string{cntxQuery})
+	eval.Limits = e.Limits
+	eval.Versions = e.Versions
 	err = eval.Eval()
 	if err != nil {
 		return err
@@ -110,7 +112,7 @@ func (e *Evaluator) EvalTable() error {
 	}
 	// if next statement is start filteration and have
 	pos := e.Plan.Pos
-	filters := optimizer.ParseFilters(e.Plan)
+	filters := optimizer.ParseFilters(e.Plan, stmt.Meta["db"], stmt.Meta["table"])
 	var data []map[string]any
 	var err error
 
@@ -128,16 +130,16 @@ func (e *Evaluator) EvalTable() error {
 	if filters != nil && sortCol != "" {
 		// Filter + Sort
 		reverse := sortDir == "_desc"
-		data, err = GetTableDataSortedAndFiltered(stmt.Meta["db"], stmt.Meta["table"], sortCol, filters, offset, limit, reverse)
+		data, err = e.GetTableDataSortedAndFiltered(stmt.Meta["db"], stmt.Meta["table"], sortCol, filters, offset, limit, reverse)
 	} else if filters != nil {
-		data, err = GetTableWithDataWithFilters(stmt.Meta["db"], stmt.Meta["table"], filters, offset, limit)
+		data, err = e.GetTableWithDataWithFilters(stmt.Meta["db"], stmt.Meta["table"], filters, offset, limit)
 	} else if sortCol != "" {
 		// Sorted retrieval via Index
 		reverse := sortDir == "_desc"
-		data, err = GetTableDataSorted(stmt.Meta["db"], stmt.Meta["table"], sortCol, offset, limit, reverse)
+		data, err = e.GetTableDataSorted(stmt.Meta["db"], stmt.Meta["table"], sortCol, offset, limit, reverse)
 	} else {
 		// Continue with table evaluation logic
-		data, err = GetTableData(stmt.Meta["db"], stmt.Meta["table"], offset, limit)
+		data, err = e.GetTableData(stmt.Meta["db"], stmt.Meta["table"], offset, limit)
 	}
 	e.Plan.Pos = pos
 	if err != nil {
@@ -177,7 +179,7 @@ func (e *Evaluator) EvalRelatedTable() error {
 		default:
 			fkValue = fmt.Sprintf("%v", v)
 		}
-		data, err := GetRelatedTableData(stmt.Meta["db"], *stmt.Expressions.(*storemanager.Relation), fkValue)
+		data, err := e.GetRelatedTableData(stmt.Meta["db"], *stmt.Expressions.(*storemanager.Relation), fkValue)
 		if err != nil {
 			return err
 		}
@@ -188,6 +190,9 @@ func (e *Evaluator) EvalRelatedTable() error {
 			return fmt.Errorf("host table data not found for getting related table data")
 		}
 		for _, val := range tabledata {
+			if err := e.checkCtx(); err != nil {
+				return err
+			}
 			// data, err := GetRelatedTableData(stmt.Meta["db"], *stmt.Expressions.(*storemanager.Relation), val[fkKey].(string))
 			var fkValue string
 			switch v := val[fkKey].(type) {
@@ -200,7 +205,7 @@ func (e *Evaluator) EvalRelatedTable() error {
 			default:
 				fkValue = fmt.Sprintf("%v", v)
 			}
-			data, err := GetRelatedTableData(stmt.Meta["db"], *stmt.Expressions.(*storemanager.Relation), fkValue)
+			data, err := e.GetRelatedTableData(stmt.Meta["db"], *stmt.Expressions.(*storemanager.Relation), fkValue)
 			if err != nil {
 				return err
 			}
@@ -336,14 +341,26 @@ func (e *Evaluator) EvalLiteral() error {
 	if stmt.Operation != parser.OpLiteral {
 		return fmt.Errorf("expected literal operation, got '%s'", stmt.Operation)
 	}
-	if stmt.Meta["type"] == "NUMBER" {
+	switch stmt.Meta["type"] {
+	case "NUMBER":
 		num, err := strconv.ParseFloat(stmt.Expressions.(string), 64)
 		if err != nil {
 			return err
 		}
 		// e.Memory[stmt.Name] = num
 		e.SetMemoryValue(stmt.Name, num)
-	} else {
+	case "ARRAY_OF_NUMBER":
+		values := stmt.Expressions.([]string)
+		nums := make([]float64, len(values))
+		for i, v := range values {
+			num, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return err
+			}
+			nums[i] = num
+		}
+		e.SetMemoryValue(stmt.Name, nums)
+	default:
 		e.SetMemoryValue(stmt.Name, stmt.Expressions)
 	}
 	// e.Memory[stmt.Name+"_meta_type"] = stmt.Meta["type"]
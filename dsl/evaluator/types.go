@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"onql/common"
 	"onql/dsl/parser"
 	"strings"
 )
 
 type Evaluator struct {
 	Ctx            context.Context
+	Limits         *Limits // nil loads without limits
+	Versions       bool    // rows loaded from tables carry storemanager.VersionField
 	Plan           *parser.Plan
 	Memory         map[string]any
 	Result         any
@@ -29,6 +32,58 @@ func NewEvaluator(ctx context.Context, plan *parser.Plan, ContextKey string, con
 	}
 }
 
+// Limits caps the rows and memory a query may load from tables into e.Memory;
+// zero means no limit. The evaluators of context sub-queries share their
+// parent's Limits, so everything a query loads counts against one budget.
+type Limits struct {
+	MaxRows        int
+	MaxMemoryBytes int64
+
+	rows   int
+	memory int64
+}
+
+// chargeRow counts a row loaded from a table against the limits. Rows are
+// charged as they are read, so loading stops at the first row over a limit.
+func (l *Limits) chargeRow(row map[string]any) error {
+	if l == nil {
+		return nil
+	}
+	l.rows++
+	if l.MaxRows > 0 && l.rows > l.MaxRows {
+		return fmt.Errorf("%w: query loaded more than %d rows", common.ErrRowLimit, l.MaxRows)
+	}
+	if l.MaxMemoryBytes > 0 {
+		l.memory += sizeOf(row)
+		if l.memory > l.MaxMemoryBytes {
+			return fmt.Errorf("%w: query loaded more than %d bytes", common.ErrMemoryLimit, l.MaxMemoryBytes)
+		}
+	}
+	return nil
+}
+
+// sizeOf roughly estimates the memory held by a decoded value.
+func sizeOf(v any) int64 {
+	switch x := v.(type) {
+	case string:
+		return int64(len(x)) + 16
+	case map[string]any:
+		n := int64(48)
+		for k, val := range x {
+			n += int64(len(k)) + 16 + sizeOf(val)
+		}
+		return n
+	case []any:
+		n := int64(24)
+		for _, val := range x {
+			n += sizeOf(val)
+		}
+		return n
+	default:
+		return 16
+	}
+}
+
 // func (e *Evaluator) SetMemoryValue(key string, value any) {
 // 	e.Memory[key] = value
 // 	e.Memory[key+"_meta_type"] = getStructureType(value)
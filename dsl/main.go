@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"onql/common"
 	"onql/dsl/evaluator"
 	"onql/dsl/optimizer"
 	"onql/dsl/parser"
+	"onql/storemanager"
 	"runtime/debug"
 	"strings"
 	"sync/atomic"
@@ -16,6 +18,9 @@ var (
 	ActiveQueries int64
 )
 
+// Limits caps the rows and memory a query may load; see evaluator.Limits.
+type Limits = evaluator.Limits
+
 // func Execute(protoPass string, query string, ctxKey string, ctxValues []string) (any, error) {
 
 //	if protoPass == "" {
@@ -41,7 +46,9 @@ var (
 //	return evaluator.Result, nil
 // }
 
-func Execute(ctx context.Context, protoPass string, query string, ctxKey string, ctxValues []string) (res any, err error) {
+// Execute runs a DSL query. With versions set, rows read from tables carry
+// their version in the "_version" field.
+func Execute(ctx context.Context, limits *Limits, protoPass string, query string, ctxKey string, ctxValues []string, versions bool) (res any, err error) {
 	// Track active query
 	atomic.AddInt64(&ActiveQueries, 1)
 	defer atomic.AddInt64(&ActiveQueries, -1)
@@ -64,10 +71,10 @@ func Execute(ctx context.Context, protoPass string, query string, ctxKey string,
 	}()
 
 	if protoPass == "" {
-		return nil, errors.New("protocol pass required")
+		return nil, fmt.Errorf("%w: protocol pass required", common.ErrInvalidInput)
 	}
 	if query == "" {
-		return nil, errors.New("query required")
+		return nil, fmt.Errorf("%w: query required", common.ErrInvalidInput)
 	}
 
 	// Check context before starting
@@ -79,29 +86,82 @@ func Execute(ctx context.Context, protoPass string, query string, ctxKey string,
 
 	lexer, err := parser.NewLexer(query)
 	if err != nil {
-		return nil, err
+		return nil, invalidQuery(err)
 	}
 	plan := parser.NewPlan(lexer, protoPass)
 	if err := plan.Parse(); err != nil {
-		return nil, err
+		return nil, invalidQuery(err)
 	}
 
 	// Pass context to evaluator
 	// Optimize Plan
 	opt := optimizer.NewOptimizer(plan)
 	if err := opt.Optimize(); err != nil {
-		return nil, err
+		return nil, invalidQuery(err)
 	}
 
 	ev := evaluator.NewEvaluator(ctx, plan, ctxKey, ctxValues)
+	ev.Limits = limits
+	ev.Versions = versions
 	if err = ev.Eval(); err != nil {
-		return nil, err
+		if ctx.Err() != nil || errors.Is(err, common.ErrRowLimit) || errors.Is(err, common.ErrMemoryLimit) {
+			return nil, err
+		}
+		return nil, invalidQuery(err)
 	}
 
 	printStatements(ev.Plan.Statements)
 	return ev.Result, nil
 }
 
+// Tables parses query and returns the "db.table" names of every table it
+// reads, including related and mtm junction tables.
+func Tables(protoPass string, query string) ([]string, error) {
+	if protoPass == "" {
+		return nil, fmt.Errorf("%w: protocol pass required", common.ErrInvalidInput)
+	}
+	if query == "" {
+		return nil, fmt.Errorf("%w: query required", common.ErrInvalidInput)
+	}
+
+	lexer, err := parser.NewLexer(query)
+	if err != nil {
+		return nil, invalidQuery(err)
+	}
+	plan := parser.NewPlan(lexer, protoPass)
+	if err := plan.Parse(); err != nil {
+		return nil, invalidQuery(err)
+	}
+
+	seen := make(map[string]bool)
+	var tables []string
+	add := func(db, table string) {
+		name := db + "." + table
+		if table != "" && !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+	for _, stmt := range plan.Statements {
+		switch stmt.Operation {
+		case parser.OpAccessTable:
+			add(stmt.Meta["db"], stmt.Meta["table"])
+		case parser.OpAccessRelatedTable:
+			add(stmt.Meta["db"], stmt.Meta["table"])
+			if relation, ok := stmt.Expressions.(*storemanager.Relation); ok && relation.Type == "mtm" {
+				add(stmt.Meta["db"], relation.Through)
+			}
+		}
+	}
+	return tables, nil
+}
+
+// invalidQuery marks err, a fault of the query rather than of the store, as
+// invalid input.
+func invalidQuery(err error) error {
+	return fmt.Errorf("%w: %w", common.ErrInvalidInput, err)
+}
+
 func ExecuteByOnqlAssembly(ev *evaluator.Evaluator) (res any, err error) {
 	// Catch ANY panic in this goroutine and return it as an error
 	defer func() {
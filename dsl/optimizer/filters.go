@@ -1,28 +1,37 @@
 package optimizer
 
 import (
+	"encoding/json"
+	"onql/database"
 	"onql/dsl/parser"
 	"strings"
 )
 
-// ParseFilters extracts equality-based filter conditions from the plan as an RPN token list,
+// ParseFilters extracts index-friendly filter conditions from the plan as an RPN token list,
 // suitable for index-based pushdown via GetTableWithDataWithFilters.
 //
 // Supports:
-//   - Simple equality:  col = val
+//   - Simple equality:  col = val            → "col:val"
+//   - Inequality:       col != val           → "col!=:val"
+//   - Range:            col > val, col <= val → "col>:val", "col<=:val"
+//   - Between:          col >= v1 and col < v2
+//   - Membership:       col in ("a", "b")    → `col in:["a","b"]`
+//   - Negation:         not (col in ("a"))   → `col in:["a"]`, "not"
 //   - Compound AND/OR:  col1=v1 and col2=v2
 //   - Grouped OR:       col1=v1 and (col2=v2 or col3=v3)
 //   - Multi-group:      col1=v1 and (col2=v2 or col3=v3) and col4=v4
 //
-// Returns nil when any condition uses a non-equality operator (!=, <, >, etc.)
-// or when the column reference is a relational/nested access (e.g. category[0].name),
-// so the caller falls back to in-memory filter evaluation.
+// Returns nil when any condition cannot be answered from the index (arithmetic,
+// membership in a sub-query, a column declared with indexed: false, …) or when the
+// column reference is a relational/nested access (e.g. category[0].name), so the
+// caller falls back to in-memory filter evaluation.
 //
 // Strategy: walk every statement inside the filter block. For each NO statement:
-//   - op "=" → resolve left/right via StatementMap, emit "col:val"
-//   - op "and"/"or" → emit the operator
-//   ATL/LIT/other statements are skipped (they are referenced by NO statements).
-func ParseFilters(plan *parser.Plan) []string {
+//   - comparison or "in" → resolve left/right via StatementMap, emit "col<op>:val"
+//   - op "and"/"or"/"not" → emit the operator
+//
+// ATL/LIT/other statements are skipped (they are referenced by NO statements).
+func ParseFilters(plan *parser.Plan, dbName, tableName string) []string {
 	stmt := plan.NextStatement(true)
 	if stmt == nil || stmt.Operation != parser.OpStartFilter {
 		return nil
@@ -30,6 +39,23 @@ func ParseFilters(plan *parser.Plan) []string {
 
 	filters := make([]string, 0, 8)
 
+	// isDirectColOp checks that s is a direct column access on the filtered
+	// table — its source must be the StartFilter statement itself.
+	// Relational accesses like category[0].name have an intermediate ATR/ART
+	// in the source chain (ARF → ATR → ART → SFT), so their source is NOT
+	// SFT and they correctly fall through to the default case, which returns
+	// nil and forces in-memory evaluation.
+	isDirectColOp := func(s *parser.Statement) bool {
+		if s.Operation != parser.OpAccessList && s.Operation != parser.OpAccessField {
+			return false
+		}
+		if len(s.Sources) == 0 {
+			return false
+		}
+		srcStmt := plan.StatementMap[s.Sources[0].SourceValue]
+		return srcStmt != nil && srcStmt.Operation == parser.OpStartFilter
+	}
+
 	for {
 		stmt = plan.NextStatement(true)
 		if stmt == nil {
@@ -38,6 +64,11 @@ func ParseFilters(plan *parser.Plan) []string {
 		if stmt.Operation == parser.OpEndFilter {
 			break
 		}
+		// A nested filter belongs to a sub-query on another table; its
+		// conditions must not be applied to this one.
+		if stmt.Operation == parser.OpStartFilter {
+			return nil
+		}
 
 		// Only NormalOperation statements carry actionable information.
 		// ATL / LIT / other statements are sub-expressions referenced by NO; skip them.
@@ -51,10 +82,11 @@ func ParseFilters(plan *parser.Plan) []string {
 		}
 		leftName := parts[0]
 		op := strings.ToLower(strings.TrimSpace(parts[1]))
+		// "not K" splits as ["", "not", "K"]
 		rightName := parts[2]
 
 		switch op {
-		case "=", "==":
+		case "=", "==", "!=", "<", "<=", ">", ">=":
 			// Resolve the two operands to find which is the column and which is the literal.
 			leftStmt := plan.StatementMap[leftName]
 			rightStmt := plan.StatementMap[rightName]
@@ -63,32 +95,18 @@ func ParseFilters(plan *parser.Plan) []string {
 			}
 
 			var colName, colVal string
-
-			// isDirectColOp checks that s is a direct column access on the filtered
-			// table — its source must be the StartFilter statement itself.
-			// Relational accesses like category[0].name have an intermediate ATR/ART
-			// in the source chain (ARF → ATR → ART → SFT), so their source is NOT
-			// SFT and they correctly fall through to the default case, which returns
-			// nil and forces in-memory evaluation.
-			isDirectColOp := func(s *parser.Statement) bool {
-				if s.Operation != parser.OpAccessList && s.Operation != parser.OpAccessField {
-					return false
-				}
-				if len(s.Sources) == 0 {
-					return false
-				}
-				srcStmt := plan.StatementMap[s.Sources[0].SourceValue]
-				return srcStmt != nil && srcStmt.Operation == parser.OpStartFilter
-			}
+			var ok bool
 
 			switch {
 			case isDirectColOp(leftStmt) && rightStmt.Operation == parser.OpLiteral:
 				colName = leftStmt.Meta["name"]
-				colVal = rightStmt.Expressions.(string)
+				colVal, ok = rightStmt.Expressions.(string)
 			case isDirectColOp(rightStmt) && leftStmt.Operation == parser.OpLiteral:
 				// val = col  (reversed — treat same as col = val)
+				// val < col is col > val, so range operators are flipped.
 				colName = rightStmt.Meta["name"]
-				colVal = leftStmt.Expressions.(string)
+				colVal, ok = leftStmt.Expressions.(string)
+				op = flipRangeOp(op)
 			default:
 				// Operands are not a simple col/literal pair (e.g. col = col,
 				// relational access like category[0].name, or a sub-expression).
@@ -96,21 +114,42 @@ func ParseFilters(plan *parser.Plan) []string {
 				return nil
 			}
 
-			if colName == "" {
+			if colName == "" || !ok || !database.IsColumnIndexed(dbName, tableName, colName) {
 				return nil
 			}
 
-			// Strip surrounding quotes added by the lexer context-value substitution.
-			v := strings.TrimSpace(colVal)
-			if n := len(v); n >= 2 &&
-				((v[0] == '"' && v[n-1] == '"') || (v[0] == '\'' && v[n-1] == '\'')) {
-				v = v[1 : n-1]
+			if op == "=" || op == "==" {
+				op = ""
 			}
-			filters = append(filters, colName+":"+v)
+			filters = append(filters, colName+op+":"+unquote(colVal))
+
+		case "in":
+			// col in ("a", "b") — the right side must be a literal list;
+			// membership in a sub-query result is evaluated in memory.
+			leftStmt := plan.StatementMap[leftName]
+			rightStmt := plan.StatementMap[rightName]
+			if leftStmt == nil || rightStmt == nil || !isDirectColOp(leftStmt) ||
+				rightStmt.Operation != parser.OpLiteral {
+				return nil
+			}
+			colName := leftStmt.Meta["name"]
+			values, ok := rightStmt.Expressions.([]string)
+			if colName == "" || !ok || !database.IsColumnIndexed(dbName, tableName, colName) {
+				return nil
+			}
+			list := make([]string, len(values))
+			for i, v := range values {
+				list[i] = unquote(v)
+			}
+			encoded, err := json.Marshal(list)
+			if err != nil {
+				return nil
+			}
+			filters = append(filters, colName+" in:"+string(encoded))
 
 		case "and", "or":
 			// Logical combinator — emit as RPN operator.
-			// Both operands must themselves be NO statements (equality or combinator results)
+			// Both operands must themselves be NO statements (comparison or combinator results)
 			// to be valid for pushdown. If either is an unknown/complex type, bail.
 			leftStmt := plan.StatementMap[leftName]
 			rightStmt := plan.StatementMap[rightName]
@@ -123,9 +162,17 @@ func ParseFilters(plan *parser.Plan) []string {
 			}
 			filters = append(filters, op)
 
+		case "not":
+			// Unary negation of the preceding expression ("not K" has no left operand).
+			rightStmt := plan.StatementMap[rightName]
+			if rightStmt == nil || rightStmt.Operation != parser.OpNormalOperation {
+				return nil
+			}
+			filters = append(filters, op)
+
 		default:
-			// Any other operator (!=, <, >, >=, <=, in, …) cannot be satisfied
-			// by a simple index lookup — abort pushdown for the whole filter.
+			// Any other operator (arithmetic, …) cannot be satisfied
+			// by an index lookup or range scan — abort pushdown for the whole filter.
 			return nil
 		}
 	}
@@ -135,3 +182,38 @@ func ParseFilters(plan *parser.Plan) []string {
 	}
 	return filters
 }
+
+// isPushableOp reports whether a filter operator can be answered from the index,
+// either directly or as a combinator of index lookups.
+func isPushableOp(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<", "<=", ">", ">=", "in", "and", "or", "not":
+		return true
+	}
+	return false
+}
+
+// flipRangeOp mirrors a comparison so that "val op col" can be emitted as "col op' val".
+func flipRangeOp(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// unquote strips surrounding quotes added by the lexer context-value substitution.
+func unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if n := len(v); n >= 2 &&
+		((v[0] == '"' && v[n-1] == '"') || (v[0] == '\'' && v[n-1] == '\'')) {
+		v = v[1 : n-1]
+	}
+	return v
+}
@@ -2,6 +2,7 @@ package optimizer
 
 import (
 	"fmt"
+	"onql/database"
 	"onql/dsl/parser"
 	"strconv"
 	"strings"
@@ -83,6 +84,10 @@ func (opt *Optimizer) OptimizeFilterSlice(stmts []*parser.Statement, index int)
 	canPushDown := true
 	for j := index + 1; j < len(stmts); j++ {
 		if stmts[j].Operation == parser.OpStartFilter {
+			// A sub-query filter inside this one makes ParseFilters return nil.
+			if nesting > 0 {
+				canPushDown = false
+			}
 			nesting++
 		} else if stmts[j].Operation == parser.OpEndFilter {
 			nesting--
@@ -99,20 +104,25 @@ func (opt *Optimizer) OptimizeFilterSlice(stmts []*parser.Statement, index int)
 			if stmts[j].Operation == parser.OpAggregateReduce {
 				canPushDown = false
 			}
-			// Relational/nested access (e.g. category[0].name) inside
-			// the filter means ParseFilters will return nil at runtime.
+			// Relational/nested access (e.g. category[0].name) or a
+			// sub-query (e.g. price in db.table.col) inside the filter means ParseFilters will return nil at runtime.
 			// We must not push LIMIT/OFFSET down in that case, or the
 			// slice would apply to unfiltered data.
 			if stmts[j].Operation == parser.OpAccessField ||
+				stmts[j].Operation == parser.OpAccessTable ||
 				stmts[j].Operation == parser.OpAccessRelatedTable ||
 				stmts[j].Operation == parser.OpAccessRow {
 				canPushDown = false
 			}
+			// A column without a usable index is filtered in memory.
+			if stmts[j].Operation == parser.OpAccessList && !isIndexedCol(stmts[index], stmts[j].Meta["name"]) {
+				canPushDown = false
+			}
 			if stmts[j].Operation == parser.OpNormalOperation {
 				parts := strings.Split(stmts[j].Expressions.(string), " ")
 				if len(parts) >= 3 {
 					op := strings.ToLower(strings.TrimSpace(parts[1]))
-					if op != "=" && op != "==" && op != "and" && op != "or" {
+					if !isPushableOp(op) {
 						canPushDown = false
 					}
 				}
@@ -143,7 +153,7 @@ func (opt *Optimizer) OptimizeFilterSlice(stmts []*parser.Statement, index int)
 func (opt *Optimizer) OptimizeSortSlice(stmts []*parser.Statement, index int) int {
 	sortStmt := stmts[index+1]
 	aggr, ok := sortStmt.Expressions.(parser.Aggr)
-	if ok && (aggr.Name == "_asc" || aggr.Name == "_desc") {
+	if ok && (aggr.Name == "_asc" || aggr.Name == "_desc") && isIndexedCol(stmts[index], aggr.Args[0]) {
 		if index+2 < len(stmts) {
 			sliceStmt := stmts[index+2]
 			if sliceStmt.Operation == parser.OpSlice {
@@ -173,6 +183,10 @@ func (opt *Optimizer) OptimizeFilterSortSlice(stmts []*parser.Statement, index i
 	canPushDown := true
 	for j := index + 1; j < len(stmts); j++ {
 		if stmts[j].Operation == parser.OpStartFilter {
+			// A sub-query filter inside this one makes ParseFilters return nil.
+			if nesting > 0 {
+				canPushDown = false
+			}
 			nesting++
 		} else if stmts[j].Operation == parser.OpEndFilter {
 			nesting--
@@ -185,15 +199,20 @@ func (opt *Optimizer) OptimizeFilterSortSlice(stmts []*parser.Statement, index i
 				canPushDown = false
 			}
 			if stmts[j].Operation == parser.OpAccessField ||
+				stmts[j].Operation == parser.OpAccessTable ||
 				stmts[j].Operation == parser.OpAccessRelatedTable ||
 				stmts[j].Operation == parser.OpAccessRow {
 				canPushDown = false
 			}
+			// A column without a usable index is filtered in memory.
+			if stmts[j].Operation == parser.OpAccessList && !isIndexedCol(stmts[index], stmts[j].Meta["name"]) {
+				canPushDown = false
+			}
 			if stmts[j].Operation == parser.OpNormalOperation {
 				parts := strings.Split(stmts[j].Expressions.(string), " ")
 				if len(parts) >= 3 {
 					op := strings.ToLower(strings.TrimSpace(parts[1]))
-					if op != "=" && op != "==" && op != "and" && op != "or" {
+					if !isPushableOp(op) {
 						canPushDown = false
 					}
 				}
@@ -210,7 +229,7 @@ func (opt *Optimizer) OptimizeFilterSortSlice(stmts []*parser.Statement, index i
 		sortStmt := stmts[endFilterIdx+1]
 		if sortStmt.Operation == parser.OpAggregateReduce {
 			aggr, ok := sortStmt.Expressions.(parser.Aggr)
-			if ok && (aggr.Name == "_asc" || aggr.Name == "_desc") {
+			if ok && (aggr.Name == "_asc" || aggr.Name == "_desc") && isIndexedCol(stmts[index], aggr.Args[0]) {
 				// Check for Slice after Sort
 				if endFilterIdx+2 < len(stmts) {
 					sliceStmt := stmts[endFilterIdx+2]
@@ -241,6 +260,11 @@ func (opt *Optimizer) OptimizeFilterSortSlice(stmts []*parser.Statement, index i
 	return nil
 }
 
+// isIndexedCol reports whether the index of a column of the accessed table can answer queries.
+func isIndexedCol(tableStmt *parser.Statement, col string) bool {
+	return database.IsColumnIndexed(tableStmt.Meta["db"], tableStmt.Meta["table"], col)
+}
+
 func parseSliceExpression(expr any) (offset int64, limit int64, ok bool) {
 	sliceStr, isStr := expr.(string)
 	if !isStr {
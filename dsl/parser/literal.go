@@ -1,6 +1,9 @@
 package parser
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 func (plan *Plan) ParseLiteral(stmt *Statement) error {
 	// Implement literal parsing logic here
@@ -14,3 +17,66 @@ func (plan *Plan) ParseLiteral(stmt *Statement) error {
 	stmt.Meta = map[string]string{"type": TokenNames[token.Type]}
 	return nil
 }
+
+// parseLiteralList parses a parenthesised list of literals such as ("a","b") or (1,2,3)
+// into a single LIT statement whose Expressions is a []string and whose type is
+// ARRAY_OF_STRING or ARRAY_OF_NUMBER. The opening parenthesis is already consumed.
+// A single literal is only a list right after "in", so (5) + 1 stays a number.
+// Reports false without consuming anything if the parenthesis holds something else.
+func (plan *Plan) parseLiteralList() (bool, error) {
+	start := plan.lexer.pos
+	afterIn := false
+	if prev := plan.lexer.Seek(start-2, false); prev != nil && prev.Type == TOKEN_IN {
+		afterIn = true
+	}
+
+	values := []string{}
+	litType := -1
+	end := start
+	for {
+		tok := plan.lexer.Seek(end, false)
+		if tok == nil || (tok.Type != TOKEN_STRING && tok.Type != TOKEN_NUMBER) {
+			return false, nil
+		}
+		if litType == -1 {
+			litType = tok.Type
+		} else if litType != tok.Type {
+			return false, fmt.Errorf("literal list mixes strings and numbers at position %d", tok.Pos)
+		}
+		values = append(values, tok.Value)
+
+		sep := plan.lexer.Seek(end+1, false)
+		if sep == nil {
+			return false, nil
+		}
+		end += 2
+		if sep.Type == TOKEN_RPAREN {
+			break
+		}
+		if sep.Type != TOKEN_COMMA {
+			return false, nil
+		}
+	}
+	if len(values) < 2 && !afterIn {
+		return false, nil
+	}
+
+	// Consume the literals, the commas and the closing parenthesis
+	for i := start; i < end; i++ {
+		plan.lexer.Next(true)
+	}
+
+	stmt := &Statement{
+		Operation:   OpLiteral,
+		Sources:     make([]Source, 5),
+		Expressions: values,
+		Meta:        map[string]string{"type": "ARRAY_OF_" + TokenNames[litType]},
+	}
+	name, err := NumberToColumn(len(plan.Statements) + 1)
+	if err != nil {
+		return false, err
+	}
+	stmt.Name = name
+	plan.AddStatement(stmt)
+	return true, nil
+}
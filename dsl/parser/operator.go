@@ -102,6 +102,10 @@ func (plan *Plan) ParseParenthesis() error {
 	if token.Type != TOKEN_LPAREN {
 		return fmt.Errorf("expect ( but got %s", token.Value)
 	}
+	// ("a", "b") is a literal list, not a grouped expression
+	if ok, err := plan.parseLiteralList(); ok || err != nil {
+		return err
+	}
 	for {
 		token = plan.lexer.Next(false)
 		if token.Type == TOKEN_RPAREN {
@@ -42,8 +42,11 @@ For more details see: https://mariadb.com/bsl11/
 package engine
 
 import (
+	"bytes"
 	"errors"
+	"io"
 	"onql/common"
+	"sync"
 	"time"
 
 	badger "github.com/dgraph-io/badger/v3"
@@ -121,6 +124,18 @@ func (db *DB) BatchSet(keys, values [][]byte) error {
 	})
 }
 
+// BatchDelete removes multiple keys in a single transaction.
+func (db *DB) BatchDelete(keys [][]byte) error {
+	return db.badgerDB.Update(func(txn *badger.Txn) error {
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // IteratePrefix iterates over all keys with a specific prefix.
 // The provided function fn is called for each matching key-value pair.
 // Iteration stops if fn returns an error.
@@ -188,6 +203,84 @@ func (db *DB) IteratePrefixWithLimit(prefix []byte, offset, limit int, reverse b
 	})
 }
 
+// IterateRange iterates over keys in the half-open range [start, end).
+// Keys are visited in ascending order, or descending order if reverse is true.
+// Iteration stops if fn returns an error.
+func (db *DB) IterateRange(start, end []byte, reverse bool, fn func(k, v []byte) error) error {
+	return db.badgerDB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = reverse
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		inRange := func(k []byte) bool {
+			return bytes.Compare(k, start) >= 0 && bytes.Compare(k, end) < 0
+		}
+
+		// In reverse mode Seek lands on the last key <= end, which is excluded.
+		seekKey := start
+		if reverse {
+			seekKey = end
+		}
+		for it.Seek(seekKey); it.Valid(); it.Next() {
+			item := it.Item()
+			k := item.Key()
+			if !inRange(k) {
+				if reverse && bytes.Equal(k, end) {
+					continue
+				}
+				break
+			}
+			err := item.Value(func(v []byte) error {
+				return fn(k, v)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Backup writes every key to w in Badger's backup format.
+// snapshotTaken is called as soon as the read snapshot is fixed; writes made
+// after that are not part of the backup.
+func (db *DB) Backup(w io.Writer, snapshotTaken func()) error {
+	var once sync.Once
+	defer once.Do(snapshotTaken)
+
+	stream := db.badgerDB.NewStream()
+	stream.LogPrefix = "DB.Backup"
+	// A single producer reads everything through one transaction, i.e. one
+	// snapshot, which is open by the time the first key is chosen.
+	stream.NumGo = 1
+	stream.ChooseKey = func(*badger.Item) bool {
+		once.Do(snapshotTaken)
+		return true
+	}
+	_, err := stream.Backup(w, 0)
+	return err
+}
+
+// Restore loads a file written by Backup. No other writes may run meanwhile.
+func (db *DB) Restore(r io.Reader) error {
+	return db.badgerDB.Load(r, 256)
+}
+
+// CollectGarbage runs value log garbage collection until no value log file is
+// worth rewriting, reclaiming the space of deleted values right away.
+func (db *DB) CollectGarbage() error {
+	for {
+		err := db.badgerDB.RunValueLogGC(0.5)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
 // RunGC runs value log garbage collection periodically.
 // It runs every 5 minutes and attempts to reclaim space if the value log
 // has at least 0.7 discard ratio.
@@ -6,6 +6,7 @@ require (
 	github.com/dgraph-io/badger/v3 v3.2103.5
 	github.com/google/uuid v1.6.0
 	github.com/timtadh/lexmachine v0.2.3
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974
 )
 
 require (
@@ -23,6 +24,5 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/timtadh/data-structures v0.6.1 // indirect
 	go.opencensus.io v0.22.5 // indirect
-	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
 	golang.org/x/sys v0.0.0-20221010170243-090e33056c14 // indirect
 )
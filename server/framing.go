@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Framing modes. A client that sends binaryHandshake as its very first byte
+// talks in length-prefixed binary frames; the server answers with the same
+// byte. Any other first byte starts the first message in delimiter mode.
+//
+// A binary frame is a 9 byte header followed by RID, target and payload:
+//
+//	flags      uint8
+//	ridLen     uint16, big endian
+//	targetLen  uint16, big endian
+//	payloadLen uint32, big endian
+const (
+	binaryHandshake byte = 0x02
+	frameHeaderSize      = 9
+
+	// FlagPush marks a frame the server sends outside of request/response,
+	// such as a subscription update.
+	FlagPush byte = 0x01
+)
+
+// frame is one message on the wire, independent of the framing mode.
+type frame struct {
+	rid     string
+	target  string
+	payload string
+	flags   byte
+}
+
+// requestError is a malformed or oversized message. It is reported to the
+// client and the connection keeps reading.
+type requestError struct {
+	rid, target string
+	msg         string
+}
+
+func (e *requestError) Error() string { return e.msg }
+
+// frameConn reads requests and writes responses in one framing mode.
+// write is not safe for concurrent use.
+type frameConn interface {
+	read() (frame, error)
+	write(f frame) error
+}
+
+// newFrameConn negotiates the framing mode from the first byte the client sends.
+func newFrameConn(r *bufio.Reader, w io.Writer, maxSize int) (frameConn, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != binaryHandshake {
+		return &delimiterConn{r: r, w: w, maxSize: maxSize}, nil
+	}
+	r.Discard(1)
+	if _, err := w.Write([]byte{binaryHandshake}); err != nil {
+		return nil, err
+	}
+	return &binaryConn{r: r, w: w, maxSize: maxSize}, nil
+}
+
+// delimiterConn is the original framing: RID\x1Etarget\x1Epayload\x04.
+type delimiterConn struct {
+	r       *bufio.Reader
+	w       io.Writer
+	maxSize int
+}
+
+func (c *delimiterConn) read() (frame, error) {
+	message, tooLarge, err := readDelimited(c.r, endOfMessage[0], c.maxSize)
+	if err != nil {
+		return frame{}, err
+	}
+	if tooLarge {
+		return frame{}, &requestError{msg: fmt.Sprintf("message exceeds %d bytes", c.maxSize)}
+	}
+
+	return parseMessage(message)
+}
+
+// parseMessage splits a message in the format RID\x1Etarget\x1Edata.
+func parseMessage(message string) (frame, error) {
+	parts := strings.SplitN(message, msgDelimiter, 3)
+	if len(parts) < 3 {
+		return frame{}, &requestError{msg: fmt.Sprintf("invalid message format, expected: RID%starget%sdata", msgDelimiter, msgDelimiter)}
+	}
+	return frame{rid: parts[0], target: parts[1], payload: parts[2]}, nil
+}
+
+func (c *delimiterConn) write(f frame) error {
+	var msg string
+	if f.rid == "" && f.target == "" {
+		// Errors for messages that could not be parsed carry no RID
+		msg = f.payload + endOfMessage
+	} else {
+		msg = f.rid + msgDelimiter + f.target + msgDelimiter + f.payload + endOfMessage
+	}
+	_, err := c.w.Write([]byte(msg))
+	return err
+}
+
+// readDelimited reads up to and excluding delim. A message longer than
+// maxSize is skipped up to the delimiter and reported with tooLarge.
+func readDelimited(r *bufio.Reader, delim byte, maxSize int) (string, bool, error) {
+	var buf []byte
+	tooLarge := false
+	for {
+		chunk, err := r.ReadSlice(delim)
+		if !tooLarge {
+			buf = append(buf, chunk...)
+			if maxSize > 0 && len(buf) > maxSize+1 {
+				tooLarge, buf = true, nil
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if tooLarge {
+			return "", true, nil
+		}
+		return string(buf[:len(buf)-1]), false, nil
+	}
+}
+
+// binaryConn reads and writes length-prefixed frames, so payloads may contain any byte.
+type binaryConn struct {
+	r       *bufio.Reader
+	w       io.Writer
+	maxSize int
+}
+
+func (c *binaryConn) read() (frame, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return frame{}, err
+	}
+	flags := header[0]
+	ridLen := int(binary.BigEndian.Uint16(header[1:3]))
+	targetLen := int(binary.BigEndian.Uint16(header[3:5]))
+	payloadLen := int64(binary.BigEndian.Uint32(header[5:9]))
+
+	names := make([]byte, ridLen+targetLen)
+	if _, err := io.ReadFull(c.r, names); err != nil {
+		return frame{}, err
+	}
+	f := frame{rid: string(names[:ridLen]), target: string(names[ridLen:]), flags: flags}
+
+	if c.maxSize > 0 && payloadLen > int64(c.maxSize) {
+		// The length is known, so the payload can be skipped and the stream stays in sync
+		if _, err := io.CopyN(io.Discard, c.r, payloadLen); err != nil {
+			return frame{}, err
+		}
+		return frame{}, &requestError{rid: f.rid, target: f.target, msg: fmt.Sprintf("payload exceeds %d bytes", c.maxSize)}
+	}
+
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return frame{}, err
+	}
+	f.payload = string(payload)
+	return f, nil
+}
+
+func (c *binaryConn) write(f frame) error {
+	if len(f.rid) > 0xFFFF || len(f.target) > 0xFFFF {
+		return fmt.Errorf("rid or target too long")
+	}
+	buf := make([]byte, frameHeaderSize, frameHeaderSize+len(f.rid)+len(f.target)+len(f.payload))
+	buf[0] = f.flags
+	binary.BigEndian.PutUint16(buf[1:3], uint16(len(f.rid)))
+	binary.BigEndian.PutUint16(buf[3:5], uint16(len(f.target)))
+	binary.BigEndian.PutUint32(buf[5:9], uint32(len(f.payload)))
+	buf = append(buf, f.rid...)
+	buf = append(buf, f.target...)
+	buf = append(buf, f.payload...)
+	_, err := c.w.Write(buf)
+	return err
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"onql/api"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// requestIDHeader carries the request ID; it is echoed on every response and
+// generated when the client sends none.
+const requestIDHeader = "X-Request-ID"
+
+// Targets that only make sense on a persistent connection.
+var connectionTargets = map[string]bool{
+	"auth":        true,
+	"cancel":      true,
+	"cursor":      true,
+	"subscribe":   true,
+	"unsubscribe": true,
+}
+
+// startHTTP serves the HTTP gateway on port, with the same TLS settings as
+// the TCP server when tlsConfig is set.
+func startHTTP(port string, tlsConfig *tls.Config) {
+	listener, err := listen(port, tlsConfig)
+	if err != nil {
+		log.Fatal("Error starting HTTP server:", err)
+	}
+
+	srv := &http.Server{
+		Handler:           http.HandlerFunc(handleHTTP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Println("🌐 HTTP gateway started on port", port)
+	if err := srv.Serve(listener); err != nil {
+		log.Fatal("HTTP server stopped:", err)
+	}
+}
+
+// handleHTTP maps an HTTP request to a target and payload and runs it through
+// api.HandleRequest like a TCP message:
+//
+//	POST /<target>              body is the payload
+//	GET  /schema[/db[/table]]   ["desc", db, table]
+//	GET  /stats?action=&limit=  {"action": ..., "limit": ...}
+//
+// Each request gets its own connection ID, so it can authenticate with HTTP
+// Basic credentials or a TLS client certificate bound to a user.
+func handleHTTP(w http.ResponseWriter, r *http.Request) {
+	rid := r.Header.Get(requestIDHeader)
+	if rid == "" {
+		rid = uuid.NewString()
+	}
+	w.Header().Set(requestIDHeader, rid)
+	w.Header().Set("Content-Type", "application/json")
+
+	target, payload, status := httpPayload(w, r)
+	if status != http.StatusOK {
+		writeHTTP(w, status, errorBody(http.StatusText(status)))
+		return
+	}
+	log.Printf("🌐 Received: %s %s %s", rid, target, loggedPayload(target, payload))
+
+	connID := uuid.NewString()
+	defer api.CloseConnection(connID)
+
+	var subject string
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		subject = r.TLS.PeerCertificates[0].Subject.String()
+	}
+
+	if user, password, ok := r.BasicAuth(); ok {
+		creds, _ := json.Marshal(map[string]string{"user": user, "password": password})
+		resp := api.HandleRequest(&api.Message{ID: connID, Target: "auth", RID: rid, Payload: string(creds), Type: "request"})
+		if status := responseStatus(resp); status != http.StatusOK {
+			writeHTTP(w, status, resp)
+			return
+		}
+	}
+
+	resp := api.HandleRequest(&api.Message{
+		ID:            connID,
+		Target:        target,
+		RID:           rid,
+		Payload:       payload,
+		Type:          "request",
+		ClientSubject: subject,
+		Ctx:           r.Context(), // cancelled when the client goes away
+	})
+	writeHTTP(w, responseStatus(resp), resp)
+}
+
+// httpPayload returns the target and payload of r, or the status to fail with.
+func httpPayload(w http.ResponseWriter, r *http.Request) (string, string, int) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	target := parts[0]
+	if target == "" || connectionTargets[target] {
+		return "", "", http.StatusNotFound
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		if len(parts) != 1 {
+			return "", "", http.StatusNotFound
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxFrameSize)))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return "", "", http.StatusRequestEntityTooLarge
+			}
+			return "", "", http.StatusBadRequest
+		}
+		return target, string(body), http.StatusOK
+
+	case http.MethodGet:
+		switch {
+		case target == "schema" && len(parts) <= 3:
+			command := append([]string{"desc"}, parts[1:]...)
+			payload, _ := json.Marshal(command)
+			return target, string(payload), http.StatusOK
+		case target == "stats" && len(parts) == 1:
+			req := make(map[string]string)
+			for _, key := range []string{"action", "limit"} {
+				if v := r.URL.Query().Get(key); v != "" {
+					req[key] = v
+				}
+			}
+			payload, _ := json.Marshal(req)
+			return target, string(payload), http.StatusOK
+		}
+		return "", "", http.StatusNotFound
+	}
+
+	w.Header().Set("Allow", "GET, POST")
+	return "", "", http.StatusMethodNotAllowed
+}
+
+// statusClientClosed is the non-standard status of a request cancelled by its
+// client.
+const statusClientClosed = 499
+
+// codeStatus maps the error codes of API responses to HTTP statuses. Other
+// errors are answered with 400.
+var codeStatus = map[string]int{
+	api.CodeInvalidRequest:  http.StatusBadRequest,
+	api.CodeUnauthorized:    http.StatusUnauthorized,
+	api.CodeForbidden:       http.StatusForbidden,
+	api.CodeNotFound:        http.StatusNotFound,
+	api.CodeConflict:        http.StatusConflict,
+	api.CodeVersionConflict: http.StatusConflict,
+	api.CodeChangesTrimmed:  http.StatusGone,
+	api.CodeRowLimit:        http.StatusUnprocessableEntity,
+	api.CodeMemoryLimit:     http.StatusUnprocessableEntity,
+	api.CodeCancelled:       statusClientClosed,
+	api.CodeFailed:          http.StatusInternalServerError,
+	api.CodeTimeout:         http.StatusGatewayTimeout,
+}
+
+// responseStatus derives the HTTP status from the error code of an API response.
+func responseStatus(resp string) int {
+	var body any
+	if err := json.Unmarshal([]byte(resp), &body); err != nil {
+		return http.StatusInternalServerError
+	}
+	m, _ := body.(map[string]any)
+	if msg, _ := m["error"].(string); msg == "" {
+		return http.StatusOK
+	}
+	code, _ := m["code"].(string)
+	if status, ok := codeStatus[code]; ok {
+		return status
+	}
+	return http.StatusBadRequest
+}
+
+// writeHTTP writes an API response with the given status.
+func writeHTTP(w http.ResponseWriter, status int, body string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="onql"`)
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+}
+
+// errorBody formats msg like an API error response.
+func errorBody(msg string) string {
+	data, _ := json.Marshal(map[string]string{"error": msg})
+	return string(data)
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"onql/api"
+	"testing"
+)
+
+func TestResponseStatus(t *testing.T) {
+	tests := []struct {
+		code string
+		want int
+	}{
+		{api.CodeInvalidRequest, http.StatusBadRequest},
+		{api.CodeUnauthorized, http.StatusUnauthorized},
+		{api.CodeForbidden, http.StatusForbidden},
+		{api.CodeNotFound, http.StatusNotFound},
+		{api.CodeConflict, http.StatusConflict},
+		{api.CodeVersionConflict, http.StatusConflict},
+		{api.CodeChangesTrimmed, http.StatusGone},
+		{api.CodeRowLimit, http.StatusUnprocessableEntity},
+		{api.CodeMemoryLimit, http.StatusUnprocessableEntity},
+		{api.CodeCancelled, statusClientClosed},
+		{api.CodeTimeout, http.StatusGatewayTimeout},
+		{api.CodeFailed, http.StatusInternalServerError},
+		{"", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(map[string]any{"data": nil, "error": "failed", "code": tt.code})
+		if got := responseStatus(string(body)); got != tt.want {
+			t.Errorf("code %q: status %d, want %d", tt.code, got, tt.want)
+		}
+	}
+
+	if got := responseStatus(`{"data": [], "error": ""}`); got != http.StatusOK {
+		t.Errorf("success: status %d, want %d", got, http.StatusOK)
+	}
+	if got := responseStatus("not json"); got != http.StatusInternalServerError {
+		t.Errorf("bad body: status %d, want %d", got, http.StatusInternalServerError)
+	}
+}
@@ -2,13 +2,14 @@ package server
 
 import (
 	"bufio"
-	"fmt"
+	"crypto/tls"
+	"encoding/json"
 	"log"
 	"net"
 	"onql/api"
 	"onql/config"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -20,25 +21,69 @@ const (
 
 // Response handler registry
 type responseHandlers struct {
-	handlers map[string]func(string)
+	handlers map[string]func(frame)
 	mu       sync.RWMutex
 }
 
 var handlers = &responseHandlers{
-	handlers: make(map[string]func(string)),
+	handlers: make(map[string]func(frame)),
 }
 
-// Setup starts the TCP server
+// handshakeTimeout bounds the TLS handshake, so a client that connects and
+// stays silent does not hold a connection.
+const handshakeTimeout = 10 * time.Second
+
+// firstByteWait bounds the wait for the framing byte, from config; 0 waits
+// as long as the client likes.
+var firstByteWait time.Duration
+
+// secretTargets carry passwords or secrets in their payload.
+var secretTargets = map[string]bool{
+	"auth":     true,
+	"user":     true,
+	"role":     true,
+	"protocol": true,
+}
+
+// loggedPayload returns payload as it may be logged: withheld for targets
+// that carry passwords.
+func loggedPayload(target, payload string) string {
+	if secretTargets[target] {
+		return "(payload withheld)"
+	}
+	return payload
+}
+
+// maxFrameSize is the largest message payload accepted, from config.
+var maxFrameSize int
+
+// Setup starts the TCP server, and the HTTP gateway and WebSocket listener if configured
 func Setup(cfg *config.Config) {
 	port := cfg.Port
+	maxFrameSize = cfg.MaxFrameSize
+	firstByteWait = cfg.FirstByteWait
 
-	listener, err := net.Listen("tcp", ":"+port)
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		log.Fatal("Error configuring TLS:", err)
+	}
+
+	listener, err := listen(port, tlsConfig)
 	if err != nil {
 		log.Fatal("Error starting TCP server:", err)
 	}
 
-	// Wire up stats
+	// Wire up stats, subscription pushes and streamed results
 	api.GetConnectionCount = GetConnectionCount
+	api.Push = Push
+	api.Stream = Stream
+
+	if cfg.HTTPPort != "" {
+		go startHTTP(cfg.HTTPPort, tlsConfig)
+	}
+	if cfg.WSPort != "" {
+		go startWebSocket(cfg.WSPort, cfg.WSOrigins, tlsConfig)
+	}
 
 	defer listener.Close()
 	log.Println("🚀 Server started on port", port)
@@ -53,6 +98,18 @@ func Setup(cfg *config.Config) {
 	}
 }
 
+// listen opens a TCP listener on port, serving TLS if tlsConfig is set.
+func listen(port string, tlsConfig *tls.Config) (net.Listener, error) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	return listener, nil
+}
+
 // GetConnectionCount returns number of active connections
 func GetConnectionCount() int {
 	handlers.mu.RLock()
@@ -60,25 +117,77 @@ func GetConnectionCount() int {
 	return len(handlers.handlers)
 }
 
+// Push sends a message to a connection outside of request/response, framed
+// like a response. It reports false if the connection is closed.
+func Push(connID, rid, target, payload string) bool {
+	return send(connID, frame{rid: rid, target: target, payload: payload, flags: FlagPush})
+}
+
+// Stream sends one of several response frames for a request; the final one is
+// the response itself. It reports false if the connection is closed.
+func Stream(connID, rid, target, payload string) bool {
+	return send(connID, frame{rid: rid, target: target, payload: payload})
+}
+
+func send(connID string, f frame) bool {
+	handlers.mu.RLock()
+	sendResponse, ok := handlers.handlers[connID]
+	handlers.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	sendResponse(f)
+	return true
+}
+
 func handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	reader := bufio.NewReader(conn)
 	connID := uuid.NewString()
 
-	log.Printf("📡 New connection: %s", connID)
+	// The client certificate subject identifies the peer to the API
+	var subject string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		var err error
+		tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if subject, err = clientSubject(tlsConn); err != nil {
+			log.Printf("TLS handshake failed: %v", err)
+			return
+		}
+		tlsConn.SetDeadline(time.Time{})
+	}
+	if firstByteWait > 0 {
+		conn.SetReadDeadline(time.Now().Add(firstByteWait))
+	}
+
+	reader := bufio.NewReader(conn)
+	log.Printf("📡 New connection: %s %s", connID, subject)
 
+	fc, err := newFrameConn(reader, conn, maxFrameSize)
+	if err != nil {
+		log.Printf("Connection closed: %s", connID)
+		return
+	}
+	if firstByteWait > 0 {
+		conn.SetReadDeadline(time.Time{})
+	}
+
+	serveConnection(connID, subject, fc)
+}
+
+// serveConnection reads requests from fc until the connection fails, handling
+// each in its own goroutine. Responses and pushes are written one at a time.
+func serveConnection(connID, subject string, fc frameConn) {
 	// Per-connection write mutex — prevents concurrent goroutines from
-	// interleaving binary frames on the same conn.Write.
+	// interleaving frames on the same conn.Write.
 	var writeMu sync.Mutex
 
 	// Response handler for this connection
-	sendResponse := func(response string) {
+	sendResponse := func(f frame) {
 		writeMu.Lock()
 		defer writeMu.Unlock()
 
-		response += endOfMessage
-		if _, err := conn.Write([]byte(response)); err != nil {
+		if err := fc.write(f); err != nil {
 			log.Println("Write failed:", err)
 		}
 	}
@@ -91,50 +200,44 @@ func handleConnection(conn net.Conn) {
 		handlers.mu.Lock()
 		delete(handlers.handlers, connID)
 		handlers.mu.Unlock()
+		api.CloseConnection(connID)
 	}()
 
 	for {
-		message, err := reader.ReadString(endOfMessage[0])
+		f, err := fc.read()
+		if reqErr, ok := err.(*requestError); ok {
+			log.Printf("Invalid message: %v", reqErr)
+			payload, _ := json.Marshal(map[string]string{"error": reqErr.msg, "code": api.CodeInvalidRequest})
+			sendResponse(frame{rid: reqErr.rid, target: reqErr.target, payload: string(payload)})
+			continue
+		}
 		if err != nil {
 			log.Printf("Connection closed: %s", connID)
 			return
 		}
 
-		query := strings.TrimSuffix(message, endOfMessage)
-		log.Printf("📨 Received: %s", query)
+		log.Printf("📨 Received: %s %s %s", f.rid, f.target, loggedPayload(f.target, f.payload))
 
 		// Handle request in parallel (each request in its own goroutine)
-		go handleRequest(query, connID, sendResponse)
+		go handleRequest(f, connID, subject, sendResponse)
 	}
 }
 
-func handleRequest(query, connID string, sendResponse func(string)) {
-	// Parse message format: RID\x1Etarget\x1Edata
-	parts := strings.Split(query, msgDelimiter)
-
-	if len(parts) < 3 {
-		log.Printf("Invalid message format: %s", query)
-		sendResponse(fmt.Sprintf(`{"error":"invalid message format, expected: RID%starget%sdata"}`, msgDelimiter, msgDelimiter))
-		return
-	}
-
-	rid := parts[0]
-	target := parts[1]
-	payload := parts[2]
-
+func handleRequest(f frame, connID, subject string, sendResponse func(frame)) {
 	// Create API message
 	msg := api.Message{
-		ID:      connID,
-		Target:  target,
-		RID:     rid,
-		Payload: payload,
-		Type:    "request",
+		ID:            connID,
+		Target:        f.target,
+		RID:           f.rid,
+		Payload:       f.payload,
+		Type:          "request",
+		ClientSubject: subject,
 	}
 
 	// Handle request through API
 	response := api.HandleRequest(&msg)
 
 	// Send response with RID for client to match
-	responseMsg := fmt.Sprintf("%s%s%s%s%s", rid, msgDelimiter, target, msgDelimiter, response)
-	sendResponse(responseMsg)
+	sendResponse(frame{rid: f.rid, target: f.target, payload: response})
+	msg.Replied()
 }
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"onql/config"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// certStore holds the server certificate and client CA pool currently in use.
+// They are read again from disk on SIGHUP, so certificates can be rotated
+// without a restart; connections already open keep their session.
+type certStore struct {
+	certFile, keyFile, clientCAFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+}
+
+// newTLSConfig loads the certificates configured in cfg and returns a TLS
+// configuration that always serves the latest ones, or nil if TLS is off.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		return nil, nil
+	}
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, fmt.Errorf("TLS needs both a certificate and a key")
+	}
+
+	store := &certStore{certFile: cfg.TLSCertFile, keyFile: cfg.TLSKeyFile, clientCAFile: cfg.TLSClientCAFile}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	go store.reloadOnSignal()
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.Certificates = []tls.Certificate{*store.cert}
+		if store.clientCA != nil {
+			// Mutual TLS: clients must present a certificate signed by the CA
+			c.ClientCAs = store.clientCA
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return c, nil
+	}
+	return base, nil
+}
+
+// load reads the certificate, key and client CA from disk. On error the
+// previous ones stay in use.
+func (s *certStore) load() error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if s.clientCAFile != "" {
+		pem, err := os.ReadFile(s.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("load TLS client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("load TLS client CA: no certificates in %s", s.clientCAFile)
+		}
+	}
+
+	s.mu.Lock()
+	s.cert, s.clientCA = &cert, pool
+	s.mu.Unlock()
+	return nil
+}
+
+// reloadOnSignal reloads the certificates whenever the process receives SIGHUP.
+func (s *certStore) reloadOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		if err := s.load(); err != nil {
+			log.Println("TLS reload failed, keeping the current certificates:", err)
+			continue
+		}
+		log.Println("🔐 TLS certificates reloaded")
+	}
+}
+
+// clientSubject completes the TLS handshake of conn, if it is a TLS
+// connection, and returns the subject of the verified client certificate.
+func clientSubject(conn *tls.Conn) (string, error) {
+	if err := conn.Handshake(); err != nil {
+		return "", err
+	}
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return "", nil
+	}
+	return state.PeerCertificates[0].Subject.String(), nil
+}
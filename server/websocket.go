@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+// startWebSocket serves WebSocket connections on port, with the same TLS
+// settings as the TCP server when tlsConfig is set. Browsers may only connect
+// from the origins listed in origins.
+func startWebSocket(port string, origins []string, tlsConfig *tls.Config) {
+	listener, err := listen(port, tlsConfig)
+	if err != nil {
+		log.Fatal("Error starting WebSocket server:", err)
+	}
+
+	srv := &http.Server{
+		Handler:           websocket.Server{Handler: handleWebSocket, Handshake: checkOrigin(origins)},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Println("🔌 WebSocket server started on port", port)
+	if err := srv.Serve(listener); err != nil {
+		log.Fatal("WebSocket server stopped:", err)
+	}
+}
+
+// checkOrigin rejects handshakes from browser pages whose origin is not in
+// allowed ("*" allows any), so a page the user visits cannot drive the
+// database through their browser (cross-site WebSocket hijacking). Clients
+// that send no Origin header, i.e. anything but a browser, are accepted.
+func checkOrigin(allowed []string) func(*websocket.Config, *http.Request) error {
+	return func(config *websocket.Config, r *http.Request) error {
+		origin, err := websocket.Origin(config, r)
+		if err != nil {
+			return err
+		}
+		config.Origin = origin
+		if origin == nil {
+			return nil
+		}
+		name := origin.Scheme + "://" + origin.Host
+		for _, a := range allowed {
+			if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), name) {
+				return nil
+			}
+		}
+		log.Printf("WebSocket origin rejected: %s", name)
+		return fmt.Errorf("origin %s not allowed", name)
+	}
+}
+
+func handleWebSocket(ws *websocket.Conn) {
+	ws.MaxPayloadBytes = maxFrameSize
+	connID := uuid.NewString()
+
+	var subject string
+	if state := ws.Request().TLS; state != nil && len(state.PeerCertificates) > 0 {
+		subject = state.PeerCertificates[0].Subject.String()
+	}
+
+	log.Printf("📡 New WebSocket connection: %s %s", connID, subject)
+	serveConnection(connID, subject, &wsConn{ws: ws})
+}
+
+// wsMessage is the content and frame type of one WebSocket frame.
+type wsMessage struct {
+	data        string
+	payloadType byte
+}
+
+var wsCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		m := v.(wsMessage)
+		return []byte(m.data), m.payloadType, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		m := v.(*wsMessage)
+		m.data, m.payloadType = string(data), payloadType
+		return nil
+	},
+}
+
+// wsConn carries one RID\x1Etarget\x1Epayload message per text or binary
+// frame; a trailing \x04 is optional. Responses and pushes use the frame type
+// of the latest request.
+type wsConn struct {
+	ws     *websocket.Conn
+	binary atomic.Bool
+}
+
+func (c *wsConn) read() (frame, error) {
+	var m wsMessage
+	err := wsCodec.Receive(c.ws, &m)
+	if err == websocket.ErrFrameTooLarge {
+		return frame{}, &requestError{msg: fmt.Sprintf("message exceeds %d bytes", c.ws.MaxPayloadBytes)}
+	}
+	if err != nil {
+		return frame{}, err
+	}
+	c.binary.Store(m.payloadType == websocket.BinaryFrame)
+	return parseMessage(strings.TrimSuffix(m.data, endOfMessage))
+}
+
+func (c *wsConn) write(f frame) error {
+	m := wsMessage{data: f.payload, payloadType: websocket.TextFrame}
+	if f.rid != "" || f.target != "" {
+		// Errors for messages that could not be parsed carry no RID
+		m.data = f.rid + msgDelimiter + f.target + msgDelimiter + f.payload
+	}
+	if c.binary.Load() {
+		m.payloadType = websocket.BinaryFrame
+	}
+	return wsCodec.Send(c.ws, m)
+}
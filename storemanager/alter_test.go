@@ -9,7 +9,7 @@ import (
 func TestAlterTable(t *testing.T) {
 	engine := NewMockEngine()
 	cfg := &config.Config{FlushInterval: 100 * time.Millisecond}
-	sm := New(engine, cfg)
+	sm := newTestStore(t, engine, cfg)
 	defer sm.Close()
 
 	// Setup: Create DB and Table
@@ -72,11 +72,11 @@ func TestAlterTable(t *testing.T) {
 	// Verify Index Access (should still work via ID)
 	// We need to know the ID of "years" (which was "age")
 	colID := tbl.Columns["years"].ID
-	// Index Key: IDX:dbID:tblID:colID:30:1
+	// Index Key: IDX:dbID:tblID:colID:<encoded 30>:1
 	// Check if key exists in engine (flush first?)
 	sm.Flush()
 
-	idxKey := IndexKey(dbID, tbl.ID, colID, "30", "1")
+	idxKey := IndexKey(dbID, tbl.ID, colID, EncodeIndexValue(TypeNumber, 30), "1")
 	if _, err := engine.Get(idxKey); err != nil {
 		t.Errorf("Index for renamed column not found: %v", err)
 	}
@@ -94,6 +94,9 @@ func TestAlterTable(t *testing.T) {
 	if tbl.Columns["years"].Type != TypeString {
 		t.Errorf("Column type not updated")
 	}
+	if _, err := engine.Get(idxKey); err == nil {
+		t.Errorf("Number-encoded index entry survived type change")
+	}
 
 	// 4. Drop Column
 	err = sm.AlterTable(dbName, tableName, map[string]interface{}{
@@ -0,0 +1,128 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"fmt"
+	"io"
+	"onql/common"
+)
+
+// Backup flushes the buffer and writes a consistent snapshot of the whole
+// store to w: schema (META:), protocols (PROTO:), sequences (SEQ:), rows and
+// indexes. Flushes and schema changes wait until the engine has fixed its
+// snapshot; writes keep landing in the buffer meanwhile and are not included.
+func (sm *StoreManager) Backup(w io.Writer) error {
+	sm.schema.Mu.RLock()
+	sm.flushMutex.Lock()
+	release := func() {
+		sm.flushMutex.Unlock()
+		sm.schema.Mu.RUnlock()
+	}
+
+	if err := sm.flushLocked(); err != nil {
+		release()
+		return err
+	}
+	return sm.engine.Backup(w, release)
+}
+
+// Restore loads a backup written by Backup into an empty store and reloads
+// the schema, protocols and users from it.
+func (sm *StoreManager) Restore(r io.Reader) error {
+	// No writes may run while the engine is loaded
+	sm.migrationLock.Lock()
+	defer sm.migrationLock.Unlock()
+
+	if err := sm.Flush(); err != nil {
+		return err
+	}
+
+	sm.schema.Mu.Lock()
+	empty := len(sm.schema.Databases) == 0
+	if empty {
+		err := sm.engine.IteratePrefixWithLimit([]byte("DATA:"), 0, 1, false, func(k, v []byte) error {
+			empty = false
+			return nil
+		})
+		if err != nil {
+			sm.schema.Mu.Unlock()
+			return err
+		}
+	}
+	if !empty {
+		sm.schema.Mu.Unlock()
+		return fmt.Errorf("%w: restore needs an empty store", common.ErrInvalidInput)
+	}
+
+	err := sm.engine.Restore(r)
+	sm.schema.Databases = make(map[string]*Database)
+	sm.schema.Protocols = make(map[string]*ProtocolRecord)
+	sm.schema.ProtocolLookup = make(map[string]*ProtocolRecord)
+	sm.schema.Mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := sm.LoadSchema(); err != nil {
+		return err
+	}
+	if err := sm.LoadProtocols(); err != nil {
+		return err
+	}
+	if err := sm.LoadUsers(); err != nil {
+		return err
+	}
+	if err := sm.loadChangeSeq(); err != nil {
+		return err
+	}
+	// A backup taken by an older version may use an older index key format
+	if err := sm.migrateIndexKeys(); err != nil {
+		return err
+	}
+	sm.resumeIndexBuilds()
+	select {
+	case sm.purgeWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
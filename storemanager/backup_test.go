@@ -0,0 +1,59 @@
+package storemanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"onql/common"
+	"onql/config"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	src := newTestStore(t, NewMockEngine(), &config.Config{FlushInterval: time.Hour})
+	defer src.Close()
+
+	src.CreateDatabase("shop")
+	src.CreateTable("shop", Table{
+		Name: "items",
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":   {Name: "id", Type: TypeString, Indexed: true},
+			"name": {Name: "name", Type: TypeString, Indexed: true},
+		},
+	})
+	for _, id := range []string{"a", "b"} {
+		src.Insert("shop", "items", Row{Data: map[string]interface{}{"id": id, "name": "n-" + id}})
+	}
+
+	// Buffered rows must be part of the backup
+	var buf bytes.Buffer
+	if err := src.Backup(&buf); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	dst := newTestStore(t, NewMockEngine(), &config.Config{FlushInterval: time.Hour})
+	defer dst.Close()
+	if err := dst.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if _, _, err := dst.GetTableSchema("shop", "items"); err != nil {
+		t.Fatalf("schema not restored: %v", err)
+	}
+	row, err := dst.Get("shop", "items", "b")
+	if err != nil || row.Data["name"] != "n-b" {
+		t.Fatalf("row not restored: %v %v", row, err)
+	}
+	pks, err := dst.GetPkByIndex(context.Background(), "shop", "items", "name", "n-a")
+	if err != nil || len(pks) != 1 || pks[0] != "a" {
+		t.Fatalf("index not restored: %v %v", pks, err)
+	}
+
+	// Restoring over existing data is refused
+	err = src.Restore(bytes.NewReader(buf.Bytes()))
+	if !errors.Is(err, common.ErrInvalidInput) {
+		t.Fatalf("restore into non-empty store: got %v", err)
+	}
+}
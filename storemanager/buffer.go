@@ -42,6 +42,7 @@ For more details see: https://mariadb.com/bsl11/
 package storemanager
 
 import (
+	"onql/logger"
 	"sync"
 )
 
@@ -51,11 +52,20 @@ type BufferEntry struct {
 	IsDeleted bool
 }
 
+// BufferOp is a keyed BufferEntry as applied to the buffer and recorded in the WAL.
+type BufferOp struct {
+	Key       string
+	Value     []byte
+	IsDeleted bool
+}
+
 // Buffer manages in-memory data before flushing to the underlying storage engine.
 // It acts as a write-back cache to improve write performance.
+// When a WAL is attached, every change is logged before it becomes visible.
 type Buffer struct {
 	data map[string]BufferEntry
 	mu   sync.RWMutex
+	wal  *WAL
 }
 
 // NewBuffer creates and initializes a new Buffer instance.
@@ -67,18 +77,74 @@ func NewBuffer() *Buffer {
 
 // Put adds or updates a value in the buffer.
 // It marks the entry as not deleted.
-func (b *Buffer) Put(key string, value []byte) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	b.data[key] = BufferEntry{Value: value, IsDeleted: false}
+func (b *Buffer) Put(key string, value []byte) error {
+	return b.Apply([]BufferOp{{Key: key, Value: value}})
 }
 
 // Delete marks a key for deletion in the buffer.
 // The actual deletion from storage happens during flush.
-func (b *Buffer) Delete(key string) {
+func (b *Buffer) Delete(key string) error {
+	return b.Apply([]BufferOp{{Key: key, IsDeleted: true}})
+}
+
+// Apply records a batch of operations in the WAL as a single frame and then
+// applies them to the buffer. The batch is either replayed whole after a crash
+// or not at all. Apply returns once the frame is durable per the WAL sync mode.
+func (b *Buffer) Apply(ops []BufferOp) error {
+	return b.ApplyIf(ops, nil)
+}
+
+// ApplyIf behaves like Apply but first runs check while the buffer lock is held.
+// check reads the buffer through view; if it returns an error nothing is
+// logged or applied. A nil check always succeeds.
+func (b *Buffer) ApplyIf(ops []BufferOp, check func(view BufferView) error) error {
+	return b.ApplyStamped(ops, check, nil)
+}
+
+// ApplyStamped behaves like ApplyIf and appends the operations returned by
+// stamp to the batch. stamp runs under the buffer lock once check passed, so
+// batches are stamped in the order in which they become visible.
+func (b *Buffer) ApplyStamped(ops []BufferOp, check func(view BufferView) error, stamp func() []BufferOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
 	b.mu.Lock()
-	defer b.mu.Unlock()
-	b.data[key] = BufferEntry{IsDeleted: true}
+	if check != nil {
+		if err := check(BufferView{b}); err != nil {
+			b.mu.Unlock()
+			return err
+		}
+	}
+	if stamp != nil {
+		ops = append(ops[:len(ops):len(ops)], stamp()...)
+	}
+	var lsn uint64
+	if b.wal != nil {
+		var err error
+		if lsn, err = b.wal.Append(ops); err != nil {
+			b.mu.Unlock()
+			return err
+		}
+	}
+	b.applyLocked(ops)
+	b.mu.Unlock()
+
+	if b.wal != nil {
+		return b.wal.WaitDurable(lsn)
+	}
+	return nil
+}
+
+// applyLocked writes ops into the in-memory map. Caller must hold b.mu.
+func (b *Buffer) applyLocked(ops []BufferOp) {
+	for _, op := range ops {
+		if op.IsDeleted {
+			b.data[op.Key] = BufferEntry{IsDeleted: true}
+		} else {
+			b.data[op.Key] = BufferEntry{Value: op.Value, IsDeleted: false}
+		}
+	}
 }
 
 // Get retrieves a value from the buffer if it exists.
@@ -87,6 +153,11 @@ func (b *Buffer) Delete(key string) {
 func (b *Buffer) Get(key string) ([]byte, bool, bool) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
+	return b.getLocked(key)
+}
+
+// getLocked is Get for callers that already hold b.mu.
+func (b *Buffer) getLocked(key string) ([]byte, bool, bool) {
 	entry, exists := b.data[key]
 	if !exists {
 		return nil, false, false
@@ -97,17 +168,63 @@ func (b *Buffer) Get(key string) ([]byte, bool, bool) {
 	return entry.Value, true, false // Found and valid
 }
 
+// BufferView reads a buffer whose lock is already held, as passed to ApplyIf checks.
+type BufferView struct {
+	b *Buffer
+}
+
+// Get has the same semantics as Buffer.Get.
+func (v BufferView) Get(key string) ([]byte, bool, bool) {
+	return v.b.getLocked(key)
+}
+
+// Range calls fn for every buffered entry, deleted or not, with a key in [start, end).
+func (v BufferView) Range(start, end string, fn func(key string, entry BufferEntry)) {
+	for k, e := range v.b.data {
+		if k >= start && k < end {
+			fn(k, e)
+		}
+	}
+}
+
 // FlushAndClear returns the current buffered data and resets the buffer.
 // This operation is thread-safe and atomic with respect to other buffer operations.
-func (b *Buffer) FlushAndClear() map[string]BufferEntry {
+// With a WAL attached it also seals the active segment and returns its number,
+// so the caller can truncate the log once the returned data is persisted.
+func (b *Buffer) FlushAndClear() (map[string]BufferEntry, uint64) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	if len(b.data) == 0 {
-		return nil
+		return nil, 0
+	}
+
+	var sealed uint64
+	if b.wal != nil {
+		var err error
+		if sealed, err = b.wal.Rotate(); err != nil {
+			// Keep logging into the current segment; it will be sealed by a later flush.
+			logger.Error("WAL rotation failed: %v", err)
+			sealed = 0
+		}
 	}
 
 	oldData := b.data
 	b.data = make(map[string]BufferEntry)
-	return oldData
+	return oldData, sealed
+}
+
+// Restore puts data returned by FlushAndClear back into the buffer after a failed flush.
+// Keys written since the flush keep their newer entry. The restored writes stay covered
+// by the sealed WAL segments, so the next successful flush persists them before it
+// truncates those segments.
+func (b *Buffer) Restore(data map[string]BufferEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for k, e := range data {
+		if _, ok := b.data[k]; !ok {
+			b.data[k] = e
+		}
+	}
 }
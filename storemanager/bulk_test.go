@@ -0,0 +1,95 @@
+package storemanager
+
+import (
+	"errors"
+	"onql/common"
+	"onql/config"
+	"testing"
+	"time"
+)
+
+func TestInsertMany(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	dbName := "bulkdb"
+	tableName := "users"
+	sm.CreateDatabase(dbName)
+	err := sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":    {Name: "id", Type: TypeString, Indexed: true},
+			"email": {Name: "email", Type: TypeString, Indexed: true, Unique: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	row := func(id, email string) Row {
+		return Row{Data: map[string]interface{}{"id": id, "email": email}}
+	}
+	exists := func(id string) bool {
+		_, err := sm.Get(dbName, tableName, id)
+		return err == nil
+	}
+
+	errs := sm.InsertMany(dbName, tableName, []Row{row("u1", "a@x"), row("u2", "b@x")}, true)
+	if len(errs) != 2 || errs[0] != nil || errs[1] != nil || !exists("u1") || !exists("u2") {
+		t.Fatalf("clean batch: got %v", errs)
+	}
+
+	// Unordered: duplicate keys (also within the batch) and unique values fail alone
+	errs = sm.InsertMany(dbName, tableName, []Row{
+		row("u1", "c@x"), // existing key
+		row("u3", "d@x"),
+		row("u3", "e@x"), // key repeated in the batch
+		row("u4", "b@x"), // taken unique value
+		row("u5", "f@x"),
+	}, false)
+	if len(errs) != 5 {
+		t.Fatalf("unordered batch: got %d results", len(errs))
+	}
+	for i, wantErr := range []bool{true, false, true, true, false} {
+		if (errs[i] != nil) != wantErr || (wantErr && !errors.Is(errs[i], common.ErrDuplicate)) {
+			t.Errorf("unordered row %d: got %v", i, errs[i])
+		}
+	}
+	if !exists("u3") || exists("u4") || !exists("u5") {
+		t.Errorf("unordered batch wrote the wrong rows")
+	}
+
+	// Ordered: stops at the first failure, keeping the rows before it
+	errs = sm.InsertMany(dbName, tableName, []Row{row("u6", "g@x"), row("u7", "g@x"), row("u8", "h@x")}, true)
+	if len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], common.ErrDuplicate) {
+		t.Fatalf("ordered batch: got %v", errs)
+	}
+	if !exists("u6") || exists("u7") || exists("u8") {
+		t.Errorf("ordered batch wrote the wrong rows")
+	}
+}
+
+func TestReserveSequence(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	sm.CreateDatabase("seqdb")
+	sm.CreateTable("seqdb", Table{
+		Name:    "items",
+		PK:      "id",
+		Columns: map[string]*Column{"id": {Name: "id", Type: TypeNumber}},
+	})
+
+	if first, err := sm.ReserveSequence("seqdb", "items", "id", 100); err != nil || first != 1 {
+		t.Fatalf("first block: got %d, %v", first, err)
+	}
+	if next, err := sm.NextSequence("seqdb", "items", "id"); err != nil || next != 101 {
+		t.Errorf("after block: got %d, %v", next, err)
+	}
+	if _, err := sm.ReserveSequence("seqdb", "items", "id", 0); !errors.Is(err, common.ErrInvalidInput) {
+		t.Errorf("empty block: got %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"onql/logger"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// changeTrimInterval is how often change records past their retention are deleted.
+const changeTrimInterval = time.Minute
+
+// Operations recorded in the change log.
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change is a committed row mutation as recorded in the change log.
+type Change struct {
+	Seq    uint64                 `json:"seq,omitempty"` // taken from the key, not stored
+	Time   int64                  `json:"ts"`            // commit time, unix milliseconds
+	DB     string                 `json:"db"`
+	Table  string                 `json:"table"`
+	PK     string                 `json:"pk"`
+	Op     string                 `json:"op"`
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+}
+
+// changeStamp encodes changes and returns the stamp for Buffer.ApplyStamped
+// that assigns their sequence numbers, or nil if nothing is to be recorded.
+func (sm *StoreManager) changeStamp(changes []*Change) (func() []BufferOp, error) {
+	now := time.Now().UnixMilli()
+	for _, c := range changes {
+		c.Time = now
+	}
+	if !sm.config.ChangeLog || len(changes) == 0 {
+		return nil, nil
+	}
+
+	values := make([][]byte, len(changes))
+	for i, c := range changes {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = data
+	}
+
+	return func() []BufferOp {
+		ops := make([]BufferOp, len(values))
+		for i, v := range values {
+			sm.changeSeq++
+			changes[i].Seq = sm.changeSeq
+			ops[i] = BufferOp{Key: string(ChangeKey(sm.changeSeq)), Value: v}
+		}
+		return ops
+	}, nil
+}
+
+// SetChangeListener registers fn to be called with the changes of every
+// committed write, after they became visible. Seq is only set when the change
+// log is enabled. fn runs on the writer's goroutine and must not block.
+// A nil fn removes the listener.
+func (sm *StoreManager) SetChangeListener(fn func(changes []Change)) {
+	sm.listenerMu.Lock()
+	sm.listener = fn
+	sm.listenerMu.Unlock()
+}
+
+// notifyChanges passes committed changes to the change listener.
+func (sm *StoreManager) notifyChanges(changes []*Change) {
+	sm.listenerMu.RLock()
+	fn := sm.listener
+	sm.listenerMu.RUnlock()
+	if fn == nil || len(changes) == 0 {
+		return
+	}
+
+	committed := make([]Change, len(changes))
+	for i, c := range changes {
+		committed[i] = *c
+	}
+	fn(committed)
+}
+
+// loadChangeSeq continues numbering after the newest record in the engine.
+// The buffer must be empty.
+func (sm *StoreManager) loadChangeSeq() error {
+	var seq uint64
+	err := sm.engine.IteratePrefixWithLimit([]byte("CDC:"), 0, 1, true, func(k, v []byte) error {
+		var err error
+		seq, err = changeKeySeq(string(k))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	sm.buffer.mu.Lock()
+	sm.changeSeq = seq
+	sm.buffer.mu.Unlock()
+	return nil
+}
+
+// changeKeySeq extracts the sequence number from a ChangeKey.
+func changeKeySeq(key string) (uint64, error) {
+	if len(key) < len("CDC:") {
+		return 0, fmt.Errorf("invalid change key %q", key)
+	}
+	return strconv.ParseUint(key[len("CDC:"):], 10, 64)
+}
+
+// Changes returns up to limit change records with a sequence number above
+// after, oldest first. If dbName or tableName is set only changes of that
+// database or table are returned. last is the highest sequence number
+// examined; passing it as after continues where this call stopped.
+// It fails with common.ErrChangesTrimmed if records after after were already
+// removed by the retention settings.
+func (sm *StoreManager) Changes(after uint64, limit int, dbName, tableName string) (changes []Change, last uint64, err error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	if err := sm.checkTrimmed(after); err != nil {
+		return nil, 0, err
+	}
+
+	start, end := string(ChangeKey(after+1)), "CDC;"
+	last = after
+	found := make(map[uint64]Change)
+	keep := func(key string, val []byte) error {
+		seq, err := changeKeySeq(key)
+		if err != nil {
+			return err
+		}
+		if _, ok := found[seq]; ok {
+			return nil
+		}
+		if seq > last {
+			last = seq
+		}
+		var c Change
+		if err := json.Unmarshal(val, &c); err != nil {
+			return err
+		}
+		if (dbName != "" && c.DB != dbName) || (tableName != "" && c.Table != tableName) {
+			return nil
+		}
+		c.Seq = seq
+		found[seq] = c
+		return nil
+	}
+
+	// A flush takes records out of the buffer before they reach the engine, so
+	// none may run between reading the two.
+	sm.flushMutex.Lock()
+	defer sm.flushMutex.Unlock()
+
+	sm.buffer.mu.RLock()
+	for k, v := range sm.buffer.data {
+		if k >= start && k < end && !v.IsDeleted {
+			if err := keep(k, v.Value); err != nil {
+				sm.buffer.mu.RUnlock()
+				return nil, 0, err
+			}
+		}
+	}
+	sm.buffer.mu.RUnlock()
+
+	// Buffered records are newer than those in the engine, so the engine
+	// scan can stop once it has found enough.
+	fromEngine := 0
+	err = sm.engine.IterateRange([]byte(start), []byte(end), false, func(k, v []byte) error {
+		before := len(found)
+		if err := keep(string(k), v); err != nil {
+			return err
+		}
+		if len(found) > before {
+			fromEngine++
+		}
+		if fromEngine >= limit {
+			return common.ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil && err != common.ErrStopIteration {
+		return nil, 0, err
+	}
+	// A trim sets the marker before deleting records, so one that removed
+	// records during the scan shows here
+	if err := sm.checkTrimmed(after); err != nil {
+		return nil, 0, err
+	}
+
+	changes = make([]Change, 0, len(found))
+	for _, c := range found {
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Seq < changes[j].Seq })
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	if len(changes) == limit {
+		last = changes[limit-1].Seq
+	}
+	return changes, last, nil
+}
+
+// checkTrimmed fails with common.ErrChangesTrimmed if records after after
+// were removed.
+func (sm *StoreManager) checkTrimmed(after uint64) error {
+	trimmed, err := sm.engine.Get(ChangeTrimKey())
+	if err == common.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if t, _ := strconv.ParseUint(string(trimmed), 10, 64); after < t {
+		return fmt.Errorf("%w: records up to %d were removed, resume after %d", common.ErrChangesTrimmed, t, t)
+	}
+	return nil
+}
+
+// changeTrimLoop deletes change records past their retention in the background.
+func (sm *StoreManager) changeTrimLoop() {
+	defer sm.wg.Done()
+	ticker := time.NewTicker(changeTrimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sm.done:
+			return
+		case <-ticker.C:
+			if err := sm.trimChanges(); err != nil {
+				logger.Error("Change log trim failed: %v", err)
+			}
+		}
+	}
+}
+
+// trimChanges deletes the change records that are older than the retention
+// period or beyond the maximum count. The newest record is always kept so
+// numbering continues after a restart.
+func (sm *StoreManager) trimChanges() error {
+	retention, maxCount := sm.config.ChangeRetention, sm.config.ChangeMaxCount
+	if retention <= 0 && maxCount <= 0 {
+		return nil
+	}
+
+	// Only the engine is trimmed; records still buffered are the newest ones.
+	if err := sm.Flush(); err != nil {
+		return err
+	}
+	sm.buffer.mu.RLock()
+	newest := sm.changeSeq
+	sm.buffer.mu.RUnlock()
+
+	var keepFrom uint64 // lowest sequence number kept by the count limit
+	if maxCount > 0 && newest > uint64(maxCount) {
+		keepFrom = newest - uint64(maxCount) + 1
+	}
+	cutoff := time.Now().Add(-retention).UnixMilli()
+
+	for {
+		var batch [][]byte
+		var upTo uint64
+		err := sm.engine.IteratePrefixWithLimit([]byte("CDC:"), 0, purgeBatch, false, func(k, v []byte) error {
+			seq, err := changeKeySeq(string(k))
+			if err != nil {
+				return err
+			}
+			if seq >= newest {
+				return common.ErrStopIteration
+			}
+			if seq >= keepFrom {
+				var c Change
+				if err := json.Unmarshal(v, &c); err != nil {
+					return err
+				}
+				if retention <= 0 || c.Time >= cutoff {
+					return common.ErrStopIteration
+				}
+			}
+			batch = append(batch, append([]byte(nil), k...))
+			upTo = seq
+			return nil
+		})
+		if err != nil && err != common.ErrStopIteration {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// Readers must learn about the gap before the records disappear
+		if err := sm.engine.Set(ChangeTrimKey(), []byte(strconv.FormatUint(upTo, 10))); err != nil {
+			return err
+		}
+		if err := sm.engine.BatchDelete(batch); err != nil {
+			return err
+		}
+		if len(batch) < purgeBatch {
+			return nil
+		}
+	}
+}
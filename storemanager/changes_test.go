@@ -0,0 +1,193 @@
+package storemanager
+
+import (
+	"errors"
+	"onql/common"
+	"onql/config"
+	"testing"
+	"time"
+)
+
+func TestChangeLog(t *testing.T) {
+	sm := newTestStore(t, NewMockEngine(), &config.Config{FlushInterval: time.Hour, ChangeLog: true, ChangeMaxCount: 2})
+	defer sm.Close()
+
+	sm.CreateDatabase("shop")
+	for _, name := range []string{"items", "orders"} {
+		sm.CreateTable("shop", Table{
+			Name: name,
+			PK:   "id",
+			Columns: map[string]*Column{
+				"id":  {Name: "id", Type: TypeString, Indexed: true},
+				"qty": {Name: "qty", Type: TypeNumber, Indexed: true},
+			},
+		})
+	}
+
+	var notified []Change
+	sm.SetChangeListener(func(changes []Change) {
+		notified = append(notified, changes...)
+	})
+
+	sm.Insert("shop", "items", Row{Data: map[string]interface{}{"id": "a", "qty": 1.0}})
+	sm.Update("shop", "items", "a", Row{Data: map[string]interface{}{"id": "a", "qty": 2.0}})
+	sm.Flush()
+	tx := sm.Begin()
+	tx.Insert("shop", "orders", Row{Data: map[string]interface{}{"id": "o1", "qty": 2.0}})
+	tx.Delete("shop", "items", "a")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if len(notified) != 4 || notified[3].Seq != 4 || notified[3].Op != ChangeDelete {
+		t.Errorf("listener got %+v", notified)
+	}
+
+	// Half flushed, half buffered
+	changes, last, err := sm.Changes(0, 0, "", "")
+	if err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+	want := []string{"items:insert", "items:update", "orders:insert", "items:delete"}
+	if len(changes) != len(want) || last != 4 {
+		t.Fatalf("got %d changes, last %d: %+v", len(changes), last, changes)
+	}
+	for i, c := range changes {
+		if c.Seq != uint64(i+1) || c.Table+":"+c.Op != want[i] {
+			t.Errorf("change %d = %d %s:%s, want %s", i, c.Seq, c.Table, c.Op, want[i])
+		}
+	}
+	if changes[1].Before["qty"] != 1.0 || changes[1].After["qty"] != 2.0 {
+		t.Errorf("update images = %v / %v", changes[1].Before, changes[1].After)
+	}
+	if changes[3].Before["qty"] != 2.0 || changes[3].After != nil {
+		t.Errorf("delete images = %v / %v", changes[3].Before, changes[3].After)
+	}
+
+	// Resume and filter
+	changes, last, _ = sm.Changes(1, 1, "shop", "items")
+	if len(changes) != 1 || changes[0].Seq != 2 || last != 2 {
+		t.Errorf("resume after 1 = %+v, last %d", changes, last)
+	}
+	changes, last, _ = sm.Changes(2, 0, "shop", "items")
+	if len(changes) != 1 || changes[0].Seq != 4 || last != 4 {
+		t.Errorf("resume after 2 = %+v, last %d", changes, last)
+	}
+
+	// Only the last two records are retained
+	if err := sm.trimChanges(); err != nil {
+		t.Fatalf("trimChanges failed: %v", err)
+	}
+	if _, _, err := sm.Changes(1, 0, "", ""); !errors.Is(err, common.ErrChangesTrimmed) {
+		t.Errorf("reading trimmed records: got %v", err)
+	}
+	changes, _, err = sm.Changes(2, 0, "", "")
+	if err != nil || len(changes) != 2 {
+		t.Errorf("after trim: %+v %v", changes, err)
+	}
+
+	// Numbering continues after a restart
+	if err := sm.loadChangeSeq(); err != nil || sm.changeSeq != 4 {
+		t.Errorf("loadChangeSeq = %d, %v", sm.changeSeq, err)
+	}
+}
+
+// trimmingEngine runs trim before a range scan, like a trim racing a reader.
+type trimmingEngine struct {
+	*MockEngine
+	trim func()
+}
+
+func (e *trimmingEngine) IterateRange(start, end []byte, reverse bool, fn func(k, v []byte) error) error {
+	if e.trim != nil {
+		e.trim()
+	}
+	return e.MockEngine.IterateRange(start, end, reverse, fn)
+}
+
+func TestChangesTrimmedDuringScan(t *testing.T) {
+	engine := &trimmingEngine{MockEngine: NewMockEngine()}
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour, ChangeLog: true, ChangeMaxCount: 1})
+	defer sm.Close()
+	sm.CreateDatabase("shop")
+	sm.CreateTable("shop", Table{
+		Name:    "items",
+		PK:      "id",
+		Columns: map[string]*Column{"id": {Name: "id", Type: TypeString}},
+	})
+	for _, id := range []string{"a", "b", "c"} {
+		sm.Insert("shop", "items", Row{Data: map[string]interface{}{"id": id}})
+	}
+	sm.Flush()
+
+	// What trimChanges does to the engine once it has flushed
+	engine.trim = func() {
+		engine.trim = nil
+		engine.Set(ChangeTrimKey(), []byte("2"))
+		engine.BatchDelete([][]byte{ChangeKey(1), ChangeKey(2)})
+	}
+	if changes, _, err := sm.Changes(0, 0, "", ""); !errors.Is(err, common.ErrChangesTrimmed) {
+		t.Errorf("records trimmed during the scan: got %+v, %v", changes, err)
+	}
+}
+
+// pausingEngine holds the next batch write until release is closed.
+type pausingEngine struct {
+	*MockEngine
+	entered, release chan struct{}
+}
+
+func (e *pausingEngine) BatchSet(keys, values [][]byte) error {
+	if e.release != nil {
+		close(e.entered)
+		<-e.release
+		e.release = nil
+	}
+	return e.MockEngine.BatchSet(keys, values)
+}
+
+func TestChangesDuringFlush(t *testing.T) {
+	engine := &pausingEngine{MockEngine: NewMockEngine()}
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour, ChangeLog: true})
+	defer sm.Close()
+	sm.CreateDatabase("shop")
+	sm.CreateTable("shop", Table{
+		Name:    "items",
+		PK:      "id",
+		Columns: map[string]*Column{"id": {Name: "id", Type: TypeString}},
+	})
+	insert := func(id string) {
+		sm.Insert("shop", "items", Row{Data: map[string]interface{}{"id": id}})
+	}
+	insert("a")
+	insert("b")
+
+	// The flush has taken records 1 and 2 out of the buffer but not yet
+	// written them when record 3 is buffered and the feed is read
+	engine.entered, engine.release = make(chan struct{}), make(chan struct{})
+	release := engine.release
+	flushed := make(chan error)
+	go func() { flushed <- sm.Flush() }()
+	<-engine.entered
+	insert("c")
+
+	type result struct {
+		changes []Change
+		err     error
+	}
+	read := make(chan result)
+	go func() {
+		changes, _, err := sm.Changes(0, 0, "", "")
+		read <- result{changes, err}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	r := <-read
+	if err := <-flushed; err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if r.err != nil || len(r.changes) != 3 {
+		t.Errorf("changes read during a flush: got %+v, %v", r.changes, r.err)
+	}
+}
@@ -0,0 +1,337 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"onql/common"
+	"onql/logger"
+)
+
+// errIndexJobStopped ends a background index job when the store is closed.
+// A build that did not finish is resumed on the next start.
+var errIndexJobStopped = errors.New("store closed")
+
+// BuildColumnIndex starts building the single-column index of colName in the
+// background. Writes keep the index up to date while existing rows are
+// backfilled, and queries use it once the build completes.
+func (sm *StoreManager) BuildColumnIndex(dbName, tableName, colName string) error {
+	dbID, table, col, err := sm.lookupColumn(dbName, tableName, colName)
+	if err != nil {
+		return err
+	}
+	if col.maintainsIndex() {
+		return fmt.Errorf("%w: column %s is already indexed", common.ErrInvalidInput, colName)
+	}
+	return sm.startIndexJob(colName, col.ID, func() error {
+		return sm.buildColumnIndex(dbID, table.ID, col.ID)
+	})
+}
+
+// DropColumnIndex stops queries and writes from using the single-column index
+// of colName and deletes its entries in the background.
+func (sm *StoreManager) DropColumnIndex(dbName, tableName, colName string) error {
+	dbID, table, col, err := sm.lookupColumn(dbName, tableName, colName)
+	if err != nil {
+		return err
+	}
+	if !col.maintainsIndex() {
+		return fmt.Errorf("%w: column %s is not indexed", common.ErrInvalidInput, colName)
+	}
+	if col.Unique {
+		return fmt.Errorf("%w: column %s is unique and needs its index", common.ErrInvalidInput, colName)
+	}
+	return sm.startIndexJob(colName, col.ID, func() error {
+		return sm.dropColumnIndex(dbID, table.ID, col.ID)
+	})
+}
+
+// resumeIndexBuilds restarts builds interrupted by a shutdown.
+func (sm *StoreManager) resumeIndexBuilds() {
+	type pending struct{ dbID, tableID, colID, name string }
+	var builds []pending
+
+	sm.schema.Mu.RLock()
+	for _, db := range sm.schema.Databases {
+		for _, table := range db.Tables {
+			for _, col := range table.Columns {
+				if col.IndexBuilding {
+					builds = append(builds, pending{db.ID, table.ID, col.ID, col.Name})
+				}
+			}
+		}
+	}
+	sm.schema.Mu.RUnlock()
+
+	for _, b := range builds {
+		b := b
+		logger.Info("Resuming index build for column %s", b.name)
+		sm.startIndexJob(b.name, b.colID, func() error {
+			return sm.buildColumnIndex(b.dbID, b.tableID, b.colID)
+		})
+	}
+}
+
+func (sm *StoreManager) lookupColumn(dbName, tableName, colName string) (string, *Table, *Column, error) {
+	dbID, table, err := sm.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	sm.schema.Mu.RLock()
+	defer sm.schema.Mu.RUnlock()
+	col, ok := table.Columns[colName]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("%w: column %s not found", common.ErrInvalidInput, colName)
+	}
+	return dbID, table, col, nil
+}
+
+// startIndexJob runs job in the background unless one is already running for the column.
+func (sm *StoreManager) startIndexJob(colName, colID string, job func() error) error {
+	sm.indexJobsMu.Lock()
+	defer sm.indexJobsMu.Unlock()
+	if sm.indexJobs[colID] {
+		return fmt.Errorf("%w: an index job is already running for column %s", common.ErrInvalidInput, colName)
+	}
+	if sm.indexJobs == nil {
+		sm.indexJobs = make(map[string]bool)
+	}
+	sm.indexJobs[colID] = true
+
+	sm.wg.Add(1)
+	go func() {
+		defer sm.wg.Done()
+		err := job()
+		if err != nil && err != errIndexJobStopped {
+			logger.Error("Index job for column %s failed: %v", colName, err)
+		}
+
+		sm.indexJobsMu.Lock()
+		delete(sm.indexJobs, colID)
+		sm.indexJobsMu.Unlock()
+	}()
+	return nil
+}
+
+// setIndexState changes the index flags of a column and persists its table.
+// Taking migrationLock waits for in-flight writes, so every write either sees
+// the old flags for all its index entries or the new ones.
+// It returns common.ErrNotFound if the column no longer exists.
+func (sm *StoreManager) setIndexState(dbID, tableID, colID string, indexed, building bool) error {
+	sm.migrationLock.Lock()
+	defer sm.migrationLock.Unlock()
+	sm.schema.Mu.Lock()
+	defer sm.schema.Mu.Unlock()
+
+	table, col := sm.columnByID(dbID, tableID, colID)
+	if col == nil {
+		return common.ErrNotFound
+	}
+	col.Indexed = indexed
+	col.IndexBuilding = building
+
+	data, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	if err := sm.engine.Set(MetaTableKey(dbID, tableID), data); err != nil {
+		return err
+	}
+	go sm.UpdateDefaultProtocol()
+	return nil
+}
+
+// columnByID finds a column by its IDs. Caller must hold schema.Mu.
+func (sm *StoreManager) columnByID(dbID, tableID, colID string) (*Table, *Column) {
+	table := sm.tableByID(dbID, tableID)
+	if table == nil {
+		return nil, nil
+	}
+	for _, col := range table.Columns {
+		if col.ID == colID {
+			return table, col
+		}
+	}
+	return table, nil
+}
+
+// buildColumnIndex backfills the index of a column from its rows.
+func (sm *StoreManager) buildColumnIndex(dbID, tableID, colID string) error {
+	// 1. Remove entries left behind by an earlier drop. Nothing writes them
+	// while the column is not indexed; flushing moves buffered ones to the engine.
+	if err := sm.Flush(); err != nil {
+		return err
+	}
+	if err := sm.deletePrefix(IndexPrefix(dbID, tableID, colID)); err != nil {
+		return err
+	}
+
+	// 2. From here on, writes maintain the index
+	if err := sm.setIndexState(dbID, tableID, colID, false, true); err != nil {
+		if err == common.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	// 3. Backfill the rows that existed before
+	pks, err := sm.tablePks(context.Background(), dbID, tableID)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(pks); start += indexRebuildBatch {
+		end := start + indexRebuildBatch
+		if end > len(pks) {
+			end = len(pks)
+		}
+		for {
+			select {
+			case <-sm.done:
+				return errIndexJobStopped
+			default:
+			}
+			err := sm.backfillIndex(dbID, tableID, colID, pks[start:end])
+			if err == common.ErrNotFound {
+				return nil // column dropped meanwhile
+			}
+			if err != common.ErrConflict {
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	// 4. Let queries use it
+	err = sm.setIndexState(dbID, tableID, colID, true, false)
+	if err == common.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// backfillIndex writes the index entries of a batch of rows. It returns
+// common.ErrConflict, writing nothing, if any of the rows changed after it was
+// read; the write that changed it maintained the index itself, so the batch is
+// simply read again.
+func (sm *StoreManager) backfillIndex(dbID, tableID, colID string, pks []string) error {
+	// Like a write: no schema migration may rename or retype the column meanwhile
+	sm.migrationLock.RLock()
+	defer sm.migrationLock.RUnlock()
+
+	sm.schema.Mu.RLock()
+	_, col := sm.columnByID(dbID, tableID, colID)
+	var colName string
+	var colType DataType
+	if col != nil {
+		colName, colType = col.Name, col.Type
+	}
+	sm.schema.Mu.RUnlock()
+	if col == nil {
+		return common.ErrNotFound
+	}
+
+	rows := make(map[string][]byte, len(pks))
+	ops := make([]BufferOp, 0, len(pks))
+	for _, pk := range pks {
+		dataKey := string(DataKey(dbID, tableID, pk))
+		val, err := sm.readKey(dataKey)
+		if err == common.ErrNotFound {
+			continue // deleted meanwhile
+		}
+		if err != nil {
+			return err
+		}
+		row, err := decodeRow(val)
+		if err != nil {
+			logger.Warn("Skipping undecodable row %s while building index: %v", dataKey, err)
+			continue
+		}
+		v, ok := row.Data[colName]
+		if !ok {
+			continue
+		}
+		rows[dataKey] = val
+		idxKey := string(IndexKey(dbID, tableID, colID, EncodeIndexValue(colType, v), pk))
+		ops = append(ops, BufferOp{Key: idxKey, Value: []byte(pk)})
+	}
+
+	sm.flushMutex.Lock()
+	defer sm.flushMutex.Unlock()
+
+	return sm.buffer.ApplyIf(ops, func(view BufferView) error {
+		for key, seen := range rows {
+			val, exists, isDeleted := view.Get(key)
+			if !exists {
+				var err error
+				val, err = sm.engine.Get([]byte(key))
+				if err != nil && err != common.ErrNotFound {
+					return err
+				}
+			} else if isDeleted {
+				val = nil
+			}
+			if !bytes.Equal(val, seen) {
+				return common.ErrConflict
+			}
+		}
+		return nil
+	})
+}
+
+// dropColumnIndex stops maintaining the index of a column and deletes its entries.
+func (sm *StoreManager) dropColumnIndex(dbID, tableID, colID string) error {
+	if err := sm.setIndexState(dbID, tableID, colID, false, false); err != nil && err != common.ErrNotFound {
+		return err
+	}
+
+	// Flush first so buffered entries cannot land after the delete
+	if err := sm.Flush(); err != nil {
+		return err
+	}
+	return sm.deletePrefix(IndexPrefix(dbID, tableID, colID))
+}
@@ -0,0 +1,91 @@
+package storemanager
+
+import (
+	"context"
+	"onql/config"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestColumnIndexBuildAndDrop(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	dbName := "lazydb"
+	tableName := "docs"
+	sm.CreateDatabase(dbName)
+	err := sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":   {Name: "id", Type: TypeString, Indexed: true},
+			"kind": {Name: "kind", Type: TypeString},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	dbID, table, _ := sm.GetTableSchema(dbName, tableName)
+	prefix := IndexPrefix(dbID, table.ID, table.Columns["kind"].ID)
+
+	for _, id := range []string{"d1", "d2", "d3"} {
+		sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": id, "kind": "memo"}})
+	}
+	sm.Flush()
+
+	if keys, _ := engine.snapshot(prefix, false); len(keys) != 0 {
+		t.Fatalf("unindexed column has index entries: %q", keys)
+	}
+	// Lookups still work by reading the rows
+	pks, err := sm.GetPkByIndex(context.Background(), dbName, tableName, "kind", "memo")
+	sort.Strings(pks)
+	if err != nil || !reflect.DeepEqual(pks, []string{"d1", "d2", "d3"}) {
+		t.Errorf("lookup on unindexed column = %v (%v)", pks, err)
+	}
+
+	waitIndexed := func(want bool) {
+		t.Helper()
+		for i := 0; i < 200; i++ {
+			sm.schema.Mu.RLock()
+			col := table.Columns["kind"]
+			done := col.Indexed == want && !col.IndexBuilding
+			sm.schema.Mu.RUnlock()
+			if done {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("index job did not finish")
+	}
+
+	if err := sm.BuildColumnIndex(dbName, tableName, "kind"); err != nil {
+		t.Fatalf("BuildColumnIndex failed: %v", err)
+	}
+	sm.Update(dbName, tableName, "d2", Row{Data: map[string]interface{}{"id": "d2", "kind": "draft"}})
+	waitIndexed(true)
+
+	pks, _ = sm.GetPkByIndex(context.Background(), dbName, tableName, "kind", "memo")
+	sort.Strings(pks)
+	if !reflect.DeepEqual(pks, []string{"d1", "d3"}) {
+		t.Errorf("lookup after build = %v", pks)
+	}
+	pks, _ = sm.GetPkByIndex(context.Background(), dbName, tableName, "kind", "draft")
+	if !reflect.DeepEqual(pks, []string{"d2"}) {
+		t.Errorf("lookup of value written during build = %v", pks)
+	}
+
+	if err := sm.DropColumnIndex(dbName, tableName, "kind"); err != nil {
+		t.Fatalf("DropColumnIndex failed: %v", err)
+	}
+	waitIndexed(false)
+	for i := 0; i < 200; i++ {
+		if keys, _ := engine.snapshot(prefix, false); len(keys) == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("entries of dropped index left behind")
+}
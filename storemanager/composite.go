@@ -0,0 +1,295 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"context"
+	"fmt"
+	"onql/common"
+	"onql/logger"
+	"sort"
+	"strings"
+)
+
+// encodeIndexTuple encodes the values of idx's columns in row data.
+// Missing columns encode as null so every row has exactly one entry.
+func encodeIndexTuple(table *Table, idx *Index, data map[string]interface{}) string {
+	var b strings.Builder
+	for _, name := range idx.Columns {
+		var colType DataType
+		if col, ok := table.Columns[name]; ok {
+			colType = col.Type
+		}
+		b.WriteString(EncodeIndexValue(colType, data[name]))
+	}
+	return b.String()
+}
+
+// compositeIndexOps builds the buffer operations that move the composite index
+// entries of pk from oldData to newData. Pass nil oldData for an insert and
+// nil newData for a delete.
+func compositeIndexOps(dbID string, table *Table, pk string, oldData, newData map[string]interface{}) []BufferOp {
+	var ops []BufferOp
+	for _, idx := range table.Indexes {
+		var oldVal, newVal string
+		if oldData != nil {
+			oldVal = encodeIndexTuple(table, idx, oldData)
+		}
+		if newData != nil {
+			newVal = encodeIndexTuple(table, idx, newData)
+		}
+		if oldVal == newVal {
+			continue
+		}
+		if oldData != nil {
+			ops = append(ops, BufferOp{Key: string(CompositeIndexKey(dbID, table.ID, idx.ID, oldVal, pk)), IsDeleted: true})
+		}
+		if newData != nil {
+			ops = append(ops, BufferOp{Key: string(CompositeIndexKey(dbID, table.ID, idx.ID, newVal, pk)), Value: []byte(pk)})
+		}
+	}
+	return ops
+}
+
+// validateIndex checks a composite index definition against the table columns.
+func validateIndex(table *Table, idx *Index) error {
+	if idx.Name == "" {
+		return fmt.Errorf("%w: index name is required", common.ErrInvalidInput)
+	}
+	if len(idx.Columns) < 2 {
+		return fmt.Errorf("%w: index %s needs at least two columns; single columns are always indexed", common.ErrInvalidInput, idx.Name)
+	}
+	seen := make(map[string]bool, len(idx.Columns))
+	for _, name := range idx.Columns {
+		if _, ok := table.Columns[name]; !ok {
+			return fmt.Errorf("%w: index %s: column %s does not exist", common.ErrInvalidInput, idx.Name, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: index %s: column %s listed twice", common.ErrInvalidInput, idx.Name, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// buildCompositeIndex drops the engine entries of idx and regenerates them from
+// the rows stored in the engine. Like rebuildIndexes, the caller must flush first
+// and block concurrent writes.
+func (sm *StoreManager) buildCompositeIndex(dbID string, table *Table, idx *Index) error {
+	if err := sm.deletePrefix(CompositeIndexPrefix(dbID, table.ID, idx.ID)); err != nil {
+		return err
+	}
+
+	prefix := DataKey(dbID, table.ID, "")
+	var keys, values [][]byte
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		err := sm.engine.BatchSet(keys, values)
+		keys, values = nil, nil
+		return err
+	}
+
+	err := sm.engine.IteratePrefix(prefix, func(k, v []byte) error {
+		pk := strings.TrimPrefix(string(k), string(prefix))
+		row, err := decodeRow(v)
+		if err != nil {
+			logger.Warn("Skipping undecodable row %s while building index %s: %v", k, idx.Name, err)
+			return nil
+		}
+		keys = append(keys, CompositeIndexKey(dbID, table.ID, idx.ID, encodeIndexTuple(table, idx, row.Data), pk))
+		values = append(values, []byte(pk))
+		if len(keys) >= indexRebuildBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// GetPksByCompositeIndex answers an AND-only filter, optionally sorted by sortCol,
+// with a single scan of a composite index. An index fits when equality filters
+// cover a leading prefix of its columns and the next column carries a range filter
+// or is sortCol; at least two columns must be used. Filters the index does not
+// cover are checked against each row. Reports false if no index fits, in which
+// case the caller should fall back to the single-column indexes.
+func (sm *StoreManager) GetPksByCompositeIndex(ctx context.Context, dbName, tableName string, filters []string, sortCol string, offset, limit int, reverse bool) ([]string, bool, error) {
+	dbID, table, err := sm.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(table.Indexes) == 0 {
+		return nil, false, nil
+	}
+
+	// 1. Split the conjunction into equality, range and other conditions
+	type leaf struct{ tok, col, op, val string }
+	var leaves []leaf
+	ands := 0
+	for _, tok := range filters {
+		tok = strings.TrimSpace(tok)
+		switch strings.ToLower(tok) {
+		case "and":
+			ands++
+			continue
+		case "or", "not":
+			return nil, false, nil
+		}
+		col, op, val, err := ParseFilterToken(tok)
+		if err != nil {
+			return nil, false, err
+		}
+		leaves = append(leaves, leaf{tok, col, op, val})
+	}
+	if len(leaves) == 0 || ands != len(leaves)-1 {
+		return nil, false, nil
+	}
+
+	eq := make(map[string]string)
+	ranges := make(map[string][]IndexBound)
+	for _, l := range leaves {
+		switch {
+		case l.op == "":
+			if _, dup := eq[l.col]; !dup {
+				eq[l.col] = l.val
+			}
+		case IsRangeOp(l.op):
+			ranges[l.col] = append(ranges[l.col], IndexBound{Op: l.op, Value: l.val})
+		}
+	}
+
+	// 2. Pick the index using the most columns, then the longest equality prefix
+	names := make([]string, 0, len(table.Indexes))
+	for name := range table.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var best *Index
+	bestEq, bestUsed := 0, 0
+	var bestNext string
+	for _, name := range names {
+		idx := table.Indexes[name]
+		k := 0
+		for k < len(idx.Columns) {
+			if _, ok := eq[idx.Columns[k]]; !ok {
+				break
+			}
+			k++
+		}
+		used := k
+		next := ""
+		if k < len(idx.Columns) {
+			next = idx.Columns[k]
+			if _, ok := ranges[next]; ok || next == sortCol {
+				used++
+			}
+		}
+		if sortCol != "" && next != sortCol {
+			continue // the scan would not come out in sort order
+		}
+		if used < 2 {
+			continue
+		}
+		if used > bestUsed || (used == bestUsed && k > bestEq) {
+			best, bestEq, bestUsed, bestNext = idx, k, used, next
+		}
+	}
+	if best == nil {
+		return nil, false, nil
+	}
+
+	// 3. Seek to the equality prefix and bound the next column
+	prefix := string(CompositeIndexPrefix(dbID, table.ID, best.ID))
+	covered := make(map[string]bool)
+	for _, name := range best.Columns[:bestEq] {
+		prefix += EncodeIndexValue(table.Columns[name].Type, eq[name])
+		covered[name+":"+eq[name]] = true
+	}
+	start, end := prefix, prefixEnd(prefix)
+	if bounds, ok := ranges[bestNext]; ok && bestNext != "" {
+		start, end, err = indexRange([]byte(prefix), table.Columns[bestNext].Type, bounds)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// 4. Anything the scan does not enforce is checked against the row
+	var rest []string
+	for _, l := range leaves {
+		if (l.op == "" && covered[l.col+":"+l.val]) || (IsRangeOp(l.op) && l.col == bestNext) {
+			continue
+		}
+		rest = append(rest, l.tok)
+	}
+	for i := 1; i < len(rest); i++ {
+		rest = append(rest, "and")
+	}
+
+	pks := make([]string, 0)
+	if start >= end {
+		return pks, true, nil
+	}
+	skipped := 0
+	err = sm.scanIndex(ctx, []byte(start), []byte(end), reverse, func(pk string) bool {
+		if len(rest) > 0 {
+			row, err := sm.Get(dbName, tableName, pk)
+			if err != nil || !matchRPNFilters(table, row.Data, rest) {
+				return false
+			}
+		}
+		if skipped < offset {
+			skipped++
+			return false
+		}
+		pks = append(pks, pk)
+		return limit > 0 && len(pks) >= limit
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return pks, true, nil
+}
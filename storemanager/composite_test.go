@@ -0,0 +1,82 @@
+package storemanager
+
+import (
+	"context"
+	"onql/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompositeIndex(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	dbName := "cidxdb"
+	tableName := "events"
+	sm.CreateDatabase(dbName)
+	err := sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":         {Name: "id", Type: TypeString, Indexed: true},
+			"tenant_id":  {Name: "tenant_id", Type: TypeString, Indexed: true},
+			"created_at": {Name: "created_at", Type: TypeNumber, Indexed: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	rows := []map[string]interface{}{
+		{"id": "e1", "tenant_id": "t1", "created_at": 30},
+		{"id": "e2", "tenant_id": "t1", "created_at": 10},
+		{"id": "e3", "tenant_id": "t2", "created_at": 20},
+	}
+	for _, r := range rows {
+		sm.Insert(dbName, tableName, Row{Data: r})
+	}
+	sm.Flush()
+
+	// Built from existing rows
+	err = sm.AlterTable(dbName, tableName, map[string]interface{}{
+		"addIndex": map[string]interface{}{"name": "tenant_created", "columns": []interface{}{"tenant_id", "created_at"}},
+	})
+	if err != nil {
+		t.Fatalf("addIndex failed: %v", err)
+	}
+
+	// Maintained by writes that are still buffered
+	sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "e4", "tenant_id": "t1", "created_at": 20}})
+	sm.Update(dbName, tableName, "e1", Row{Data: map[string]interface{}{"id": "e1", "tenant_id": "t1", "created_at": 5}})
+	sm.Delete(dbName, tableName, "e2")
+
+	pks, ok, err := sm.GetPksByCompositeIndex(context.Background(), dbName, tableName, []string{"tenant_id:t1", "created_at>:0", "and"}, "", 0, 0, false)
+	if err != nil || !ok || !reflect.DeepEqual(pks, []string{"e1", "e4"}) {
+		t.Errorf("range scan = %v, %v (%v)", pks, ok, err)
+	}
+	pks, ok, _ = sm.GetPksByCompositeIndex(context.Background(), dbName, tableName, []string{"tenant_id:t1"}, "created_at", 0, 1, true)
+	if !ok || !reflect.DeepEqual(pks, []string{"e4"}) {
+		t.Errorf("sorted scan = %v, %v", pks, ok)
+	}
+	pks, ok, _ = sm.GetPksByCompositeIndex(context.Background(), dbName, tableName, []string{"tenant_id:t1", "created_at:20", "and", "id!=:e4", "and"}, "", 0, 0, false)
+	if !ok || len(pks) != 0 {
+		t.Errorf("residual filter scan = %v, %v", pks, ok)
+	}
+	if _, ok, _ := sm.GetPksByCompositeIndex(context.Background(), dbName, tableName, []string{"tenant_id:t1", "created_at:20", "or"}, "", 0, 0, false); ok {
+		t.Errorf("an OR filter must not use the composite index")
+	}
+
+	if err := sm.AlterTable(dbName, tableName, map[string]interface{}{"dropColumn": map[string]interface{}{"name": "created_at"}}); err == nil {
+		t.Errorf("dropping an indexed column should fail")
+	}
+	_, table, _ := sm.GetTableSchema(dbName, tableName)
+	idxID := table.Indexes["tenant_created"].ID
+	if err := sm.AlterTable(dbName, tableName, map[string]interface{}{"dropIndex": map[string]interface{}{"name": "tenant_created"}}); err != nil {
+		t.Fatalf("dropIndex failed: %v", err)
+	}
+	if keys, _ := engine.snapshot([]byte("CIDX:"), false); len(keys) != 0 {
+		t.Errorf("entries of dropped index %s left behind: %q", idxID, keys)
+	}
+}
@@ -0,0 +1,368 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"sort"
+	"strings"
+)
+
+// Filter tokens are produced by the DSL optimizer in RPN order. Each
+// expression token has the form <col><op>:<value>, where op is one of:
+//
+//	""    equality            status:active
+//	"!="  not equal           status!=:active
+//	"<"   less than           amount<:100
+//	"<="  less or equal       amount<=:100
+//	">"   greater than        amount>:100
+//	">="  greater or equal    amount>=:100
+//	" in" membership          status in:["active","trial"]
+//
+// The value of an "in" token is a JSON array of strings. Column names never
+// contain the operator characters or spaces, so the first ':' always ends the
+// column/operator part. Combinators are "and", "or" and the unary "not".
+
+// IndexBound is one side of a range predicate on an indexed column.
+type IndexBound struct {
+	Op    string // "<", "<=", ">" or ">="
+	Value string
+}
+
+// ParseFilterToken splits an RPN expression token into column, operator and value.
+func ParseFilterToken(tok string) (col, op, val string, err error) {
+	idx := strings.Index(tok, ":")
+	if idx < 0 {
+		return "", "", "", fmt.Errorf("%w: bad filter token %q; expected 'col:val'", common.ErrInvalidInput, tok)
+	}
+	head := strings.TrimSpace(tok[:idx])
+	if sp := strings.LastIndex(head, " "); sp >= 0 {
+		col, op = head[:sp], head[sp+1:]
+	} else {
+		col = strings.TrimRight(head, "<>=!")
+		op = head[len(col):]
+	}
+	switch op {
+	case "", "!=", "<", "<=", ">", ">=", "in":
+	default:
+		return "", "", "", fmt.Errorf("%w: bad filter operator %q in token %q", common.ErrInvalidInput, op, tok)
+	}
+	return strings.TrimSpace(col), op, strings.TrimSpace(tok[idx+1:]), nil
+}
+
+// ParseFilterList decodes the value of an "in" token.
+func ParseFilterList(val string) ([]string, error) {
+	var values []string
+	if err := json.Unmarshal([]byte(val), &values); err != nil {
+		return nil, fmt.Errorf("%w: bad filter list %q: %v", common.ErrInvalidInput, val, err)
+	}
+	return values, nil
+}
+
+// IsRangeOp reports whether op is a range operator understood by GetPksByIndexRange.
+func IsRangeOp(op string) bool {
+	return op == "<" || op == "<=" || op == ">" || op == ">="
+}
+
+// GetPksByIndexRange returns the PKs whose indexed column value satisfies all bounds,
+// in index order. Bounds are combined with AND, so a lower and an upper bound form a
+// between. Values are compared in the column's index encoding: numerically for number
+// and timestamp columns, bytewise for strings. A range never crosses value kinds, so
+// amount>:100 does not match non-numeric values stored in a number column.
+func (sm *StoreManager) GetPksByIndexRange(ctx context.Context, dbName, tableName, colName string, bounds []IndexBound) ([]string, error) {
+	dbID, table, err := sm.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	colDef, ok := table.Columns[colName]
+	if !ok {
+		return nil, fmt.Errorf("column %s %w", colName, common.ErrNotFound)
+	}
+	if !colDef.Indexed {
+		filters := make([]string, 0, 2*len(bounds))
+		for i, b := range bounds {
+			filters = append(filters, colName+b.Op+":"+b.Value)
+			if i > 0 {
+				filters = append(filters, "and")
+			}
+		}
+		return sm.scanPks(ctx, dbName, tableName, dbID, table, filters)
+	}
+
+	prefix := IndexPrefix(dbID, table.ID, colDef.ID)
+	start, end, err := indexRange(prefix, colDef.Type, bounds)
+	if err != nil {
+		return nil, err
+	}
+
+	pks := make([]string, 0)
+	if start >= end {
+		return pks, nil
+	}
+	err = sm.scanIndex(ctx, []byte(start), []byte(end), false, func(pk string) bool {
+		pks = append(pks, pk)
+		return false
+	})
+	return pks, err
+}
+
+// indexRange converts bounds into a half-open key range [start, end) under prefix.
+// An empty range is returned as start >= end.
+func indexRange(prefix []byte, colType DataType, bounds []IndexBound) (start, end string, err error) {
+	p := string(prefix)
+	start, end = p, prefixEnd(p)
+
+	var tag byte
+	for _, b := range bounds {
+		enc := EncodeIndexValue(colType, b.Value)
+		if tag == 0 {
+			tag = enc[0]
+		} else if tag != enc[0] {
+			return "", "", nil // bounds of different kinds never overlap
+		}
+
+		// Keys continue after the value with ":" + pk (or the next value of a
+		// composite index), so every key with this value sorts at or after
+		// prefix+value and before prefix+value+";".
+		switch b.Op {
+		case ">":
+			start = maxString(start, p+enc+";")
+		case ">=":
+			start = maxString(start, p+enc)
+		case "<":
+			end = minString(end, p+enc)
+		case "<=":
+			end = minString(end, p+enc+";")
+		default:
+			return "", "", fmt.Errorf("%w: unsupported range operator %q", common.ErrInvalidInput, b.Op)
+		}
+	}
+
+	// Stay within the value kind of the bounds
+	if tag != 0 {
+		start = maxString(start, p+string([]byte{tag}))
+		end = minString(end, p+string([]byte{tag + 1}))
+	}
+	return start, end, nil
+}
+
+// prefixEnd returns a key greater than every index key starting with prefix.
+// Under an index prefix, keys continue with a value tag (0x01-0x04) or with the
+// ':' before the pk, all of which sort below ';'.
+func prefixEnd(prefix string) string {
+	return prefix + ";"
+}
+
+func maxString(a, b string) string {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minString(a, b string) string {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// scanIndex visits the PKs of index entries with keys in [start, end) in key
+// order (descending if reverse), merging buffered entries over the engine.
+// visit returns true to stop the scan; it also stops with ctx's error once ctx is done.
+func (sm *StoreManager) scanIndex(ctx context.Context, start, end []byte, reverse bool, visit func(pk string) bool) error {
+	startStr, endStr := string(start), string(end)
+
+	// 1. Buffered index entries take precedence over the engine.
+	// They are few, so sort them and merge them into the engine scan below.
+	type bufferedEntry struct{ key, pk string }
+	var buffered []bufferedEntry
+	overridden := make(map[string]struct{})
+
+	sm.buffer.mu.RLock()
+	for k, v := range sm.buffer.data {
+		if k >= startStr && k < endStr {
+			overridden[k] = struct{}{}
+			if !v.IsDeleted {
+				buffered = append(buffered, bufferedEntry{key: k, pk: string(v.Value)})
+			}
+		}
+	}
+	sm.buffer.mu.RUnlock()
+
+	before := func(a, b string) bool {
+		if reverse {
+			return a > b
+		}
+		return a < b
+	}
+	sort.Slice(buffered, func(i, j int) bool { return before(buffered[i].key, buffered[j].key) })
+
+	// 2. Merge the engine scan with the buffered entries
+	i := 0
+	err := sm.engine.IterateRange(start, end, reverse, func(k, v []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := string(k)
+		for ; i < len(buffered) && before(buffered[i].key, key); i++ {
+			if visit(buffered[i].pk) {
+				return common.ErrStopIteration
+			}
+		}
+		if _, ok := overridden[key]; ok {
+			return nil
+		}
+		if visit(string(v)) {
+			return common.ErrStopIteration
+		}
+		return nil
+	})
+	if err == common.ErrStopIteration {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for ; i < len(buffered); i++ {
+		if visit(buffered[i].pk) {
+			break
+		}
+	}
+	return nil
+}
+
+// matchRPNFilters evaluates RPN filter tokens against a row.
+// Values are compared in the column's index encoding so the result agrees
+// with index lookups and range scans.
+func matchRPNFilters(table *Table, row map[string]interface{}, filters []string) bool {
+	// Stack stores boolean results of conditions
+	// filters: ["col:val", "col>:val", "and", "not"]
+
+	stack := make([]bool, 0)
+
+	for _, tok := range filters {
+		tokLower := strings.ToLower(strings.TrimSpace(tok))
+		if tokLower == "not" {
+			if len(stack) < 1 {
+				return false
+			}
+			stack[len(stack)-1] = !stack[len(stack)-1]
+			continue
+		}
+		if tokLower == "and" || tokLower == "or" {
+			if len(stack) < 2 {
+				return false
+			}
+			v2 := stack[len(stack)-1]
+			v1 := stack[len(stack)-2]
+			stack = stack[:len(stack)-2]
+			if tokLower == "and" {
+				stack = append(stack, v1 && v2)
+			} else {
+				stack = append(stack, v1 || v2)
+			}
+			continue
+		}
+
+		col, op, val, err := ParseFilterToken(tok)
+		if err != nil {
+			return false
+		}
+		rowVal, ok := row[col]
+		if !ok {
+			// A row without the column has no index entry, so it is only
+			// matched by a negation (set difference against all rows).
+			stack = append(stack, op == "!=")
+			continue
+		}
+
+		var colType DataType
+		if colDef, ok := table.Columns[col]; ok {
+			colType = colDef.Type
+		}
+		a := EncodeIndexValue(colType, rowVal)
+
+		var result bool
+		if op == "in" {
+			values, err := ParseFilterList(val)
+			if err != nil {
+				return false
+			}
+			for _, v := range values {
+				if a == EncodeIndexValue(colType, v) {
+					result = true
+					break
+				}
+			}
+			stack = append(stack, result)
+			continue
+		}
+
+		b := EncodeIndexValue(colType, val)
+		switch op {
+		case "":
+			result = a == b
+		case "!=":
+			result = a != b
+		case "<":
+			result = a[0] == b[0] && a < b
+		case "<=":
+			result = a[0] == b[0] && a <= b
+		case ">":
+			result = a[0] == b[0] && a > b
+		case ">=":
+			result = a[0] == b[0] && a >= b
+		}
+		stack = append(stack, result)
+	}
+
+	if len(stack) != 1 {
+		return false
+	}
+	return stack[0]
+}
@@ -0,0 +1,184 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"onql/common"
+	"onql/logger"
+	"strings"
+)
+
+// indexFormatVersion is the current index key encoding (see EncodeIndexValue).
+// Version 1 was the original "%v" text encoding, which sorted numbers lexicographically.
+// Version 2 encoded numeric timestamps as numbers, apart from RFC3339 ones.
+const indexFormatVersion = "3"
+
+// indexRebuildBatch bounds the number of keys written per engine transaction.
+const indexRebuildBatch = 1000
+
+// migrateIndexKeys rewrites every IDX: key to the current encoding once.
+// It rebuilds each index from the row data, so it is safe to rerun after a
+// crash part-way through; the format marker is only written at the end.
+// Must run before the StoreManager accepts writes.
+func (sm *StoreManager) migrateIndexKeys() error {
+	version, err := sm.engine.Get(IndexFormatKey())
+	if err == nil && string(version) == indexFormatVersion {
+		return nil
+	}
+	if err != nil && err != common.ErrNotFound {
+		return err
+	}
+
+	// Rebuild from what is on disk
+	if err := sm.Flush(); err != nil {
+		return err
+	}
+
+	sm.schema.Mu.RLock()
+	defer sm.schema.Mu.RUnlock()
+
+	tables := 0
+	for _, db := range sm.schema.Databases {
+		for _, table := range db.Tables {
+			var cols []*Column
+			for _, col := range table.Columns {
+				if col.maintainsIndex() {
+					cols = append(cols, col)
+				}
+			}
+			if len(cols) == 0 && len(table.Indexes) == 0 {
+				continue
+			}
+			if len(cols) > 0 {
+				if err := sm.rebuildIndexes(db.ID, table, cols); err != nil {
+					return err
+				}
+			}
+			for _, idx := range table.Indexes {
+				if err := sm.buildCompositeIndex(db.ID, table, idx); err != nil {
+					return err
+				}
+			}
+			tables++
+		}
+	}
+	if tables > 0 {
+		logger.Info("Migrated index keys of %d tables to format %s", tables, indexFormatVersion)
+	}
+
+	return sm.engine.Set(IndexFormatKey(), []byte(indexFormatVersion))
+}
+
+// rebuildIndexes drops the engine index entries of cols and regenerates them
+// from the rows stored in the engine. The caller must make sure the buffer
+// holds nothing for the table (flush first) and that no writes run concurrently.
+func (sm *StoreManager) rebuildIndexes(dbID string, table *Table, cols []*Column) error {
+	// 1. Drop existing entries
+	for _, col := range cols {
+		if err := sm.deletePrefix(IndexPrefix(dbID, table.ID, col.ID)); err != nil {
+			return err
+		}
+	}
+
+	// 2. Regenerate from rows
+	prefix := DataKey(dbID, table.ID, "")
+	var keys, values [][]byte
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		err := sm.engine.BatchSet(keys, values)
+		keys, values = nil, nil
+		return err
+	}
+
+	err := sm.engine.IteratePrefix(prefix, func(k, v []byte) error {
+		pk := strings.TrimPrefix(string(k), string(prefix))
+		row, err := decodeRow(v)
+		if err != nil {
+			logger.Warn("Skipping undecodable row %s while rebuilding indexes: %v", k, err)
+			return nil
+		}
+		for _, col := range cols {
+			val, ok := row.Data[col.Name]
+			if !ok {
+				continue
+			}
+			keys = append(keys, IndexKey(dbID, table.ID, col.ID, EncodeIndexValue(col.Type, val), pk))
+			values = append(values, []byte(pk))
+		}
+		if len(keys) >= indexRebuildBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// deletePrefix deletes every engine key starting with prefix, purgeBatch keys
+// at a time.
+func (sm *StoreManager) deletePrefix(prefix []byte) error {
+	var stale [][]byte
+	flush := func() error {
+		if len(stale) == 0 {
+			return nil
+		}
+		err := sm.engine.BatchDelete(stale)
+		stale = nil
+		return err
+	}
+
+	err := sm.engine.IteratePrefix(prefix, func(k, v []byte) error {
+		stale = append(stale, append([]byte(nil), k...))
+		if len(stale) >= purgeBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
@@ -42,9 +42,11 @@ For more details see: https://mariadb.com/bsl11/
 package storemanager
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"onql/common"
+	"onql/logger"
 	"sort"
 	"strconv"
 	"strings"
@@ -52,21 +54,31 @@ import (
 
 // NextSequence increments and returns the next value for a column sequence.
 func (sm *StoreManager) NextSequence(dbName, tableName, colName string) (int, error) {
+	return sm.ReserveSequence(dbName, tableName, colName, 1)
+}
+
+// ReserveSequence advances a column sequence by n and returns the first of the
+// n values reserved.
+func (sm *StoreManager) ReserveSequence(dbName, tableName, colName string, n int) (int, error) {
+	if n < 1 {
+		return 0, fmt.Errorf("%w: cannot reserve %d sequence values", common.ErrInvalidInput, n)
+	}
+
 	sm.schema.Mu.RLock()
 	db, ok := sm.schema.Databases[dbName]
 	if !ok {
 		sm.schema.Mu.RUnlock()
-		return 0, fmt.Errorf("database %s not found", dbName)
+		return 0, fmt.Errorf("database %s %w", dbName, common.ErrNotFound)
 	}
 	table, ok := db.Tables[tableName]
 	if !ok {
 		sm.schema.Mu.RUnlock()
-		return 0, fmt.Errorf("table %s not found", tableName)
+		return 0, fmt.Errorf("table %s %w", tableName, common.ErrNotFound)
 	}
 	col, ok := table.Columns[colName]
 	if !ok {
 		sm.schema.Mu.RUnlock()
-		return 0, fmt.Errorf("column %s not found", colName)
+		return 0, fmt.Errorf("column %s %w", colName, common.ErrNotFound)
 	}
 	sm.schema.Mu.RUnlock() // unlock early as we use IDs now
 
@@ -97,12 +109,27 @@ func (sm *StoreManager) NextSequence(dbName, tableName, colName string) (int, er
 		}
 	}
 
-	next := current + 1
-	if err := sm.engine.Set(key, []byte(strconv.Itoa(next))); err != nil {
+	last := current + n
+	if err := sm.engine.Set(key, []byte(strconv.Itoa(last))); err != nil {
 		return 0, err
 	}
 
-	return next, nil
+	return current + 1, nil
+}
+
+// keyReader resolves a key to its current value.
+// It returns common.ErrNotFound if the key is absent or marked as deleted.
+type keyReader func(key string) ([]byte, error)
+
+// readKey looks a key up in the write buffer first and falls back to the engine.
+func (sm *StoreManager) readKey(key string) ([]byte, error) {
+	if val, exists, isDeleted := sm.buffer.Get(key); exists {
+		if isDeleted {
+			return nil, common.ErrNotFound
+		}
+		return val, nil
+	}
+	return sm.engine.Get([]byte(key))
 }
 
 // Insert adds a new row to the specified table.
@@ -113,55 +140,128 @@ func (sm *StoreManager) Insert(dbName, tableName string, row Row) error {
 	sm.migrationLock.RLock()
 	defer sm.migrationLock.RUnlock()
 
-	dbID, table, err := sm.GetTableSchema(dbName, tableName)
+	ops, change, err := sm.insertOps(sm.readKey, dbName, tableName, row)
 	if err != nil {
 		return err
 	}
 
+	// Apply row and indices to the buffer as one WAL batch
+	return sm.applyWrite(ops, change)
+}
+
+// insertOps builds the buffer operations for inserting row, reading existing state through read.
+// It also returns the record of the change for the change log.
+func (sm *StoreManager) insertOps(read keyReader, dbName, tableName string, row Row) ([]BufferOp, *Change, error) {
+	dbID, table, err := sm.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	pkVal, ok := row.Data[table.PK]
 	if !ok {
-		return fmt.Errorf("primary key %s missing", table.PK)
+		return nil, nil, fmt.Errorf("%w: primary key %s missing", common.ErrInvalidInput, table.PK)
 	}
 	pkStr := fmt.Sprintf("%v", pkVal)
 
-	// 2. Check if exists (Buffer or Disk)
+	// 1. Check if exists (Buffer or Disk)
 	dataKey := string(DataKey(dbID, table.ID, pkStr))
-	if _, exists, isDeleted := sm.buffer.Get(dataKey); exists {
-		if !isDeleted {
-			return common.ErrDuplicate
-		}
-	} else {
-		// key not in buffer, check disk
-		_, err := sm.engine.Get([]byte(dataKey))
-		if err == nil {
-			return common.ErrDuplicate
-		}
-		if err != common.ErrNotFound {
-			return err
-		}
+	if _, err := read(dataKey); err == nil {
+		return nil, nil, common.ErrDuplicate
+	} else if err != common.ErrNotFound {
+		return nil, nil, err
 	}
 
-	// 3. Serialize
-	dataBytes, err := json.Marshal(row.Data)
+	// 2. Serialize
+	dataBytes, err := encodeRow(Row{Data: row.Data, Version: 1})
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// 4. Update Buffer
-	sm.buffer.Put(dataKey, dataBytes)
+	// 3. Stage row
+	ops := []BufferOp{{Key: dataKey, Value: dataBytes}}
 
-	// 5. Update Indices
+	// 4. Stage Indices
 	for colName, colDef := range table.Columns {
-		if colDef.Indexed {
+		if colDef.maintainsIndex() {
 			if val, ok := row.Data[colName]; ok {
-				valStr := fmt.Sprintf("%v", val)
+				valStr := EncodeIndexValue(colDef.Type, val)
 				idxKey := string(IndexKey(dbID, table.ID, colDef.ID, valStr, pkStr))
-				sm.buffer.Put(idxKey, []byte(pkStr)) // Value is PK
+				ops = append(ops, BufferOp{Key: idxKey, Value: []byte(pkStr)}) // Value is PK
 			}
 		}
 	}
+	ops = append(ops, compositeIndexOps(dbID, table, pkStr, nil, row.Data)...)
 
-	return nil
+	change := &Change{DB: dbName, Table: tableName, PK: pkStr, Op: ChangeInsert, After: row.Data}
+	return ops, change, nil
+}
+
+// InsertMany adds rows to a table, writing every row that can be inserted as
+// one WAL batch. It returns the error of each row, nil for rows written.
+// If ordered is set it stops at the first failing row: the rows before it are
+// written, the rows after it are not, and the result ends with its error.
+func (sm *StoreManager) InsertMany(dbName, tableName string, rows []Row, ordered bool) []error {
+	sm.migrationLock.RLock()
+	defer sm.migrationLock.RUnlock()
+
+	// Rows see the earlier rows of the batch, so repeated keys are duplicates
+	batch := make(map[string][]byte)
+	read := func(key string) ([]byte, error) {
+		if val, ok := batch[key]; ok {
+			return val, nil
+		}
+		return sm.readKey(key)
+	}
+
+	type rowWrite struct {
+		index  int
+		ops    []BufferOp
+		change *Change
+	}
+	var writes []rowWrite
+	var ops []BufferOp
+	var changes []*Change
+
+	errs := make([]error, 0, len(rows))
+	for i, row := range rows {
+		rowOps, change, err := sm.insertOps(read, dbName, tableName, row)
+		errs = append(errs, err)
+		if err != nil {
+			if ordered {
+				break
+			}
+			continue
+		}
+		batch[rowOps[0].Key] = rowOps[0].Value
+		writes = append(writes, rowWrite{index: i, ops: rowOps, change: change})
+		ops = append(ops, rowOps...)
+		changes = append(changes, change)
+	}
+	if len(writes) == 0 {
+		return errs
+	}
+
+	err := sm.applyWrite(ops, changes...)
+	if err == nil {
+		return errs
+	}
+	if !errors.Is(err, common.ErrDuplicate) {
+		for _, w := range writes {
+			errs[w.index] = err
+		}
+		return errs
+	}
+
+	// A unique column rejected the batch: write row by row to find the rows at fault
+	for _, w := range writes {
+		if err := sm.applyWrite(w.ops, w.change); err != nil {
+			errs[w.index] = err
+			if ordered {
+				return errs[:w.index+1]
+			}
+		}
+	}
+	return errs
 }
 
 // Get retrieves a row by its primary key.
@@ -172,35 +272,25 @@ func (sm *StoreManager) Get(dbName, tableName, pk string) (*Row, error) {
 	sm.migrationLock.RLock()
 	defer sm.migrationLock.RUnlock()
 
+	return sm.getRow(sm.readKey, dbName, tableName, pk)
+}
+
+// getRow reads and decodes a row through read.
+func (sm *StoreManager) getRow(read keyReader, dbName, tableName, pk string) (*Row, error) {
 	dbID, table, err := sm.GetTableSchema(dbName, tableName)
 	if err != nil {
 		return nil, err
 	}
 
-	dataKey := string(DataKey(dbID, table.ID, pk))
-
-	// Check Buffer
-	if val, exists, isDeleted := sm.buffer.Get(dataKey); exists {
-		if isDeleted {
-			return nil, common.ErrNotFound
-		}
-		var data map[string]interface{}
-		if err := json.Unmarshal(val, &data); err != nil {
-			return nil, err
-		}
-		return &Row{Data: data}, nil
-	}
-
-	// Check Disk
-	val, err := sm.engine.Get([]byte(dataKey))
+	val, err := read(string(DataKey(dbID, table.ID, pk)))
 	if err != nil {
 		return nil, err
 	}
-	var data map[string]interface{}
-	if err := json.Unmarshal(val, &data); err != nil {
+	row, err := decodeRow(val)
+	if err != nil {
 		return nil, err
 	}
-	return &Row{Data: data}, nil
+	return &row, nil
 }
 
 // Update modifies an existing row.
@@ -211,49 +301,63 @@ func (sm *StoreManager) Update(dbName, tableName, pk string, newRow Row) error {
 	sm.migrationLock.RLock()
 	defer sm.migrationLock.RUnlock()
 
-	// 1. Get old row to update indices
-	oldRow, err := sm.Get(dbName, tableName, pk)
+	ops, change, err := sm.updateOps(sm.readKey, dbName, tableName, pk, newRow)
 	if err != nil {
 		return err
 	}
 
+	// Apply row and indices to the buffer as one WAL batch
+	return sm.applyWrite(ops, change)
+}
+
+// updateOps builds the buffer operations for replacing the row at pk with newRow,
+// and the record of the change for the change log.
+func (sm *StoreManager) updateOps(read keyReader, dbName, tableName, pk string, newRow Row) ([]BufferOp, *Change, error) {
+	// 1. Get old row to update indices
+	oldRow, err := sm.getRow(read, dbName, tableName, pk)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	dbID, table, err := sm.GetTableSchema(dbName, tableName)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// 2. Serialize new data
-	dataBytes, err := json.Marshal(newRow.Data)
+	// 2. Serialize new data as the next version
+	dataBytes, err := encodeRow(Row{Data: newRow.Data, Version: oldRow.Version + 1})
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// 3. Update Buffer
+	// 3. Stage row
 	dataKey := string(DataKey(dbID, table.ID, pk))
-	sm.buffer.Put(dataKey, dataBytes)
+	ops := []BufferOp{{Key: dataKey, Value: dataBytes}}
 
-	// 4. Update Indices
+	// 4. Stage Indices
 	for colName, colDef := range table.Columns {
-		if colDef.Indexed {
+		if colDef.maintainsIndex() {
 			oldVal := oldRow.Data[colName]
 			newVal := newRow.Data[colName]
 
-			oldValStr := fmt.Sprintf("%v", oldVal)
-			newValStr := fmt.Sprintf("%v", newVal)
+			oldValStr := EncodeIndexValue(colDef.Type, oldVal)
+			newValStr := EncodeIndexValue(colDef.Type, newVal)
 
 			if oldValStr != newValStr {
 				// Remove old index
 				oldIdxKey := string(IndexKey(dbID, table.ID, colDef.ID, oldValStr, pk))
-				sm.buffer.Delete(oldIdxKey)
+				ops = append(ops, BufferOp{Key: oldIdxKey, IsDeleted: true})
 
 				// Add new index
 				newIdxKey := string(IndexKey(dbID, table.ID, colDef.ID, newValStr, pk))
-				sm.buffer.Put(newIdxKey, []byte(pk))
+				ops = append(ops, BufferOp{Key: newIdxKey, Value: []byte(pk)})
 			}
 		}
 	}
+	ops = append(ops, compositeIndexOps(dbID, table, pk, oldRow.Data, newRow.Data)...)
 
-	return nil
+	change := &Change{DB: dbName, Table: tableName, PK: pk, Op: ChangeUpdate, Before: oldRow.Data, After: newRow.Data}
+	return ops, change, nil
 }
 
 // Delete removes a row by its primary key.
@@ -263,33 +367,47 @@ func (sm *StoreManager) Delete(dbName, tableName, pk string) error {
 	sm.migrationLock.RLock()
 	defer sm.migrationLock.RUnlock()
 
+	ops, change, err := sm.deleteOps(sm.readKey, dbName, tableName, pk)
+	if err != nil {
+		return err
+	}
+
+	// Apply to the buffer as one WAL batch
+	return sm.applyWrite(ops, change)
+}
+
+// deleteOps builds the buffer operations for deleting the row at pk,
+// and the record of the change for the change log.
+func (sm *StoreManager) deleteOps(read keyReader, dbName, tableName, pk string) ([]BufferOp, *Change, error) {
 	// 1. Get old row to remove indices
-	oldRow, err := sm.Get(dbName, tableName, pk)
+	oldRow, err := sm.getRow(read, dbName, tableName, pk)
 	if err != nil {
-		return err // Already doesn't exist?
+		return nil, nil, err // Already doesn't exist?
 	}
 
 	dbID, table, err := sm.GetTableSchema(dbName, tableName)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// 2. Mark as deleted in Buffer
+	// 2. Mark row as deleted
 	dataKey := string(DataKey(dbID, table.ID, pk))
-	sm.buffer.Delete(dataKey)
+	ops := []BufferOp{{Key: dataKey, IsDeleted: true}}
 
 	// 3. Remove Indices
 	for colName, colDef := range table.Columns {
-		if colDef.Indexed {
+		if colDef.maintainsIndex() {
 			if val, ok := oldRow.Data[colName]; ok {
-				valStr := fmt.Sprintf("%v", val)
+				valStr := EncodeIndexValue(colDef.Type, val)
 				idxKey := string(IndexKey(dbID, table.ID, colDef.ID, valStr, pk))
-				sm.buffer.Delete(idxKey)
+				ops = append(ops, BufferOp{Key: idxKey, IsDeleted: true})
 			}
 		}
 	}
+	ops = append(ops, compositeIndexOps(dbID, table, pk, oldRow.Data, nil)...)
 
-	return nil
+	change := &Change{DB: dbName, Table: tableName, PK: pk, Op: ChangeDelete, Before: oldRow.Data}
+	return ops, change, nil
 }
 
 // Flush writes all buffered data (inserts, updates, deletes) to the underlying storage engine.
@@ -297,11 +415,17 @@ func (sm *StoreManager) Delete(dbName, tableName, pk string) error {
 func (sm *StoreManager) Flush() error {
 	sm.flushMutex.Lock()
 	defer sm.flushMutex.Unlock()
+	return sm.flushLocked()
+}
 
-	data := sm.buffer.FlushAndClear()
+// flushLocked is Flush for callers that already hold flushMutex.
+func (sm *StoreManager) flushLocked() error {
+	data, sealed := sm.buffer.FlushAndClear()
 	if data == nil {
 		return nil
 	}
+	// Counted once the engine writes are over, failed or not
+	defer sm.flushGen.Add(1)
 
 	var keys, values [][]byte
 	var deleteKeys [][]byte
@@ -318,26 +442,33 @@ func (sm *StoreManager) Flush() error {
 	// Batch Set
 	if len(keys) > 0 {
 		if err := sm.engine.BatchSet(keys, values); err != nil {
-			// In a real system, we might want to retry or put back in buffer
+			sm.buffer.Restore(data)
 			return err
 		}
 	}
 
-	// Batch Delete (Engine interface needs BatchDelete or we loop)
-	// Assuming Engine has Delete, we can loop or add BatchDelete.
-	// For now, loop.
-	for _, k := range deleteKeys {
-		if err := sm.engine.Delete(k); err != nil {
+	// Batch Delete
+	if len(deleteKeys) > 0 {
+		if err := sm.engine.BatchDelete(deleteKeys); err != nil {
+			sm.buffer.Restore(data)
 			return err
 		}
 	}
 
+	// Everything logged up to the sealed segment is now on disk. A failed flush
+	// restores its data above, so a later flush never truncates unwritten records.
+	if sealed > 0 {
+		if err := sm.buffer.wal.Truncate(sealed); err != nil {
+			logger.Error("WAL truncate failed: %v", err)
+		}
+	}
+
 	return nil
 }
 
 // GetPkByIndex retrieves the primary keys of rows using an indexed column value.
 // It checks both the buffer and the disk for the index entries.
-func (sm *StoreManager) GetPkByIndex(dbName, tableName, colName, value string) ([]string, error) {
+func (sm *StoreManager) GetPkByIndex(ctx context.Context, dbName, tableName, colName, value string) ([]string, error) {
 	dbID, table, err := sm.GetTableSchema(dbName, tableName)
 	if err != nil {
 		return nil, err
@@ -345,10 +476,15 @@ func (sm *StoreManager) GetPkByIndex(dbName, tableName, colName, value string) (
 
 	colDef, ok := table.Columns[colName]
 	if !ok {
-		return nil, fmt.Errorf("column %s not found", colName)
+		return nil, fmt.Errorf("column %s %w", colName, common.ErrNotFound)
+	}
+
+	if !colDef.Indexed {
+		return sm.scanPks(ctx, dbName, tableName, dbID, table, []string{colName + ":" + value})
 	}
 
-	prefix := fmt.Sprintf("IDX:%s:%s:%s:%s:", dbID, table.ID, colDef.ID, value)
+	// value arrives as text from the query layer; encode it like the stored column value.
+	prefix := string(IndexKey(dbID, table.ID, colDef.ID, EncodeIndexValue(colDef.Type, value), ""))
 	prefixBytes := []byte(prefix)
 
 	var foundPKs []string
@@ -370,6 +506,9 @@ func (sm *StoreManager) GetPkByIndex(dbName, tableName, colName, value string) (
 
 	// Check Disk
 	err = sm.engine.IteratePrefix(prefixBytes, func(k, v []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		// Check if deleted in buffer
 		// The index key in buffer might be marked deleted, but we need the PK to check data key?
 		// Actually, if index entry is deleted in buffer, we shouldn't return it.
@@ -398,7 +537,7 @@ func (sm *StoreManager) GetPkByIndex(dbName, tableName, colName, value string) (
 
 // GetAllPksWithLimits retrieves primary keys for a table with offset and limit, considering optional ordering.
 // For now, it defaults to PK order. If reverse is true, it iterates in reverse order.
-func (sm *StoreManager) GetAllPksWithLimits(dbName, tableName string, offset, limit int, reverse bool) ([]string, error) {
+func (sm *StoreManager) GetAllPksWithLimits(ctx context.Context, dbName, tableName string, offset, limit int, reverse bool) ([]string, error) {
 	dbID, table, err := sm.GetTableSchema(dbName, tableName)
 	if err != nil {
 		return nil, err
@@ -480,6 +619,9 @@ func (sm *StoreManager) GetAllPksWithLimits(dbName, tableName string, offset, li
 
 	err = sm.engine.IteratePrefixWithLimit(prefix, 0, 0, reverse, func(k, v []byte) error {
 		// We use 0,0 for inner limit because we must manually skip due to masking (seenPKs)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		if limit > 0 && currentDiskCount >= remainingLimit {
 			return common.ErrStopIteration
@@ -511,14 +653,18 @@ func (sm *StoreManager) GetAllPksWithLimits(dbName, tableName string, offset, li
 }
 
 // GetAllPks retrieves all primary keys for a given table.
-func (sm *StoreManager) GetAllPks(dbName, tableName string) ([]string, error) {
+func (sm *StoreManager) GetAllPks(ctx context.Context, dbName, tableName string) ([]string, error) {
 	dbID, table, err := sm.GetTableSchema(dbName, tableName)
 	if err != nil {
 		return nil, err
 	}
+	return sm.tablePks(ctx, dbID, table.ID)
+}
 
+// tablePks lists the primary keys of a table by its IDs, merging the buffer over the engine.
+func (sm *StoreManager) tablePks(ctx context.Context, dbID, tableID string) ([]string, error) {
 	// Iterate over DATA:dbID:tableID:
-	prefix := DataKey(dbID, table.ID, "")
+	prefix := DataKey(dbID, tableID, "")
 	prefixStr := string(prefix)
 
 	var pks []string
@@ -542,7 +688,10 @@ func (sm *StoreManager) GetAllPks(dbName, tableName string) ([]string, error) {
 	sm.buffer.mu.RUnlock()
 
 	// Disk
-	err = sm.engine.IteratePrefix(prefix, func(k, v []byte) error {
+	err := sm.engine.IteratePrefix(prefix, func(k, v []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		pk := string(k[len(prefix):])
 		// If explicitly deleted in buffer (and thus in seenPKs), skip
 		// If added in buffer (and thus in seenPKs), skip (already added)
@@ -559,19 +708,65 @@ func (sm *StoreManager) GetAllPks(dbName, tableName string) ([]string, error) {
 }
 
 // GetDataByPKs retrieves multiple rows by their primary keys.
-func (sm *StoreManager) GetDataByPKs(dbName, tableName string, pks []string) ([]map[string]interface{}, error) {
+func (sm *StoreManager) GetDataByPKs(ctx context.Context, dbName, tableName string, pks []string) ([]map[string]interface{}, error) {
 	var results []map[string]interface{}
+	err := sm.EachRowByPKs(ctx, dbName, tableName, pks, func(row *Row) error {
+		results = append(results, row.Data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// EachRowByPKs calls fn with the row of each PK that exists, in order, as it
+// is read. It stops with the error of fn, or with ctx's error once ctx is done,
+// so callers can bound what they load without reading every row first.
+func (sm *StoreManager) EachRowByPKs(ctx context.Context, dbName, tableName string, pks []string, fn func(row *Row) error) error {
 	for _, pk := range pks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		row, err := sm.Get(dbName, tableName, pk)
 		if err != nil {
 			if err == common.ErrNotFound {
 				continue
 			}
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPks returns the PKs of rows matching the RPN filters by reading every row.
+// It answers lookups on columns without a usable index.
+func (sm *StoreManager) scanPks(ctx context.Context, dbName, tableName, dbID string, table *Table, filters []string) ([]string, error) {
+	pks, err := sm.tablePks(ctx, dbID, table.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]string, 0)
+	for _, pk := range pks {
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
-		results = append(results, row.Data)
+		row, err := sm.Get(dbName, tableName, pk)
+		if err == common.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if matchRPNFilters(table, row.Data, filters) {
+			matched = append(matched, pk)
+		}
 	}
-	return results, nil
+	return matched, nil
 }
 
 // GetTableSchema retrieves the schema for a specific table.
@@ -582,23 +777,24 @@ func (sm *StoreManager) GetTableSchema(dbName, tableName string) (string, *Table
 
 	db, ok := sm.schema.Databases[dbName]
 	if !ok {
-		return "", nil, fmt.Errorf("database %s not found", dbName)
+		return "", nil, fmt.Errorf("database %s %w", dbName, common.ErrNotFound)
 	}
 	table, ok := db.Tables[tableName]
 	if !ok {
-		return "", nil, fmt.Errorf("table %s not found", tableName)
+		return "", nil, fmt.Errorf("table %s %w", tableName, common.ErrNotFound)
 	}
 	return db.ID, table, nil
 }
 
 // GetPksSortedByCol retrieves PKs sorted by a column using the index.
 // It is now a wrapper around GetPksSortedByColWithFilter with nil filters.
-func (sm *StoreManager) GetPksSortedByCol(dbName, tableName, colName string, offset, limit int, reverse bool) ([]string, error) {
-	return sm.GetPksSortedByColWithFilter(dbName, tableName, colName, offset, limit, reverse, nil)
+func (sm *StoreManager) GetPksSortedByCol(ctx context.Context, dbName, tableName, colName string, offset, limit int, reverse bool) ([]string, error) {
+	return sm.GetPksSortedByColWithFilter(ctx, dbName, tableName, colName, offset, limit, reverse, nil)
 }
 
 // GetPksSortedByColWithFilter retrieves PKs sorted by a column using the index, checking filters for each candidate.
-func (sm *StoreManager) GetPksSortedByColWithFilter(dbName, tableName, colName string, offset, limit int, reverse bool, filters []string) ([]string, error) {
+// The index is walked in key order (merged with the buffer) and the scan stops once limit rows matched.
+func (sm *StoreManager) GetPksSortedByColWithFilter(ctx context.Context, dbName, tableName, colName string, offset, limit int, reverse bool, filters []string) ([]string, error) {
 	dbID, table, err := sm.GetTableSchema(dbName, tableName)
 	if err != nil {
 		return nil, err
@@ -606,147 +802,37 @@ func (sm *StoreManager) GetPksSortedByColWithFilter(dbName, tableName, colName s
 
 	colDef, ok := table.Columns[colName]
 	if !ok {
-		return nil, fmt.Errorf("column %s not found", colName)
+		return nil, fmt.Errorf("column %s %w", colName, common.ErrNotFound)
 	}
-
-	prefix := fmt.Sprintf("IDX:%s:%s:%s:", dbID, table.ID, colDef.ID)
-	prefixBytes := []byte(prefix)
-
-	// Collect valid keys from Buffer and Disk (handling deletions)
-	validKeys := make([]string, 0)
-	seen := make(map[string]struct{}) // track keys to avoid duplicates and handle buffer priority
-
-	// 1. Buffer Handling
-	sm.buffer.mu.RLock()
-	for k, v := range sm.buffer.data {
-		if strings.HasPrefix(k, prefix) {
-			if v.IsDeleted {
-				seen[k] = struct{}{} // Mark as deleted (seen but excluded)
-			} else {
-				validKeys = append(validKeys, k)
-				seen[k] = struct{}{} // Mark as valid (seen)
-			}
-		}
+	if !colDef.Indexed {
+		return nil, fmt.Errorf("%w: column %s is not indexed", common.ErrInvalidInput, colName)
 	}
-	sm.buffer.mu.RUnlock()
 
-	// 2. Disk Handling
-	err = sm.engine.IteratePrefix(prefixBytes, func(k, v []byte) error {
-		keyStr := string(k)
-		if _, ok := seen[keyStr]; !ok {
-			validKeys = append(validKeys, keyStr)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	// 3. Sort Keys
-	// Index Key: IDX:db:table:col:value:pk
-	if reverse {
-		sort.Sort(sort.Reverse(sort.StringSlice(validKeys)))
-	} else {
-		sort.Strings(validKeys)
-	}
+	prefix := IndexPrefix(dbID, table.ID, colDef.ID)
 
-	// 4. Iterate Sorted Keys, Fetch Row, Check Filter
+	// Visit candidates in index order, checking the filter for each.
+	// Returns true once enough rows matched so the scan can stop early.
 	matchedPKs := make([]string, 0)
 	skipped := 0
-
-	// We iterate ALL valid keys until we find limit matches.
-	for _, key := range validKeys {
-		if limit > 0 && len(matchedPKs) >= limit {
-			break
-		}
-
-		// Get PK
-		var pk string
-		// Check buffer first (for value)
-		if val, exists, _ := sm.buffer.Get(key); exists {
-			pk = string(val)
-		} else {
-			// Check disk
-			val, err := sm.engine.Get([]byte(key))
-			if err == nil {
-				pk = string(val)
-			} else {
-				continue // Should skip if error
-			}
-		}
-
-		// Fetch Row Data to check Filter
-		row, err := sm.Get(dbName, tableName, pk)
-		if err != nil {
-			continue
-		}
-
-		// Check Filter
-		if matchRPNFilters(row.Data, filters) {
-			if skipped < offset {
-				skipped++
-			} else {
-				matchedPKs = append(matchedPKs, pk)
-			}
-		}
-	}
-
-	return matchedPKs, nil
-}
-
-func matchRPNFilters(row map[string]interface{}, filters []string) bool {
-	// Simple RPN evaluation for AND/OR/Equals
-	// Stack stores boolean results of conditions
-	// filters: ["col:val", "col:val", "and"]
-
-	stack := make([]bool, 0)
-
-	for _, tok := range filters {
-		tokLower := strings.ToLower(tok)
-		if tokLower == "and" {
-			if len(stack) < 2 {
+	visit := func(pk string) bool {
+		if len(filters) > 0 {
+			// Fetch Row Data to check Filter
+			row, err := sm.Get(dbName, tableName, pk)
+			if err != nil || !matchRPNFilters(table, row.Data, filters) {
 				return false
 			}
-			v2 := stack[len(stack)-1]
-			v1 := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			stack = append(stack, v1 && v2)
-		} else if tokLower == "or" {
-			if len(stack) < 2 {
-				return false
-			}
-			v2 := stack[len(stack)-1]
-			v1 := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			stack = append(stack, v1 || v2)
-		} else {
-			// "col:val"
-			parts := strings.SplitN(tok, ":", 2)
-			if len(parts) != 2 {
-				return false
-			}
-			col := strings.TrimSpace(parts[0])
-			val := strings.TrimSpace(parts[1])
-
-			// Check row[col] == val
-			// Handle types loosely (fmt.Sprintf)
-			rowVal, ok := row[col]
-			if !ok {
-				stack = append(stack, false)
-				continue
-			}
-			rowValStr := fmt.Sprintf("%v", rowVal)
-
-			// Remove quotes from val if present
-			valClean := val
-			// Assuming val is already clean from parser? Yes, ParseFilters cleans quotes.
-
-			stack = append(stack, rowValStr == valClean)
 		}
+		if skipped < offset {
+			skipped++
+			return false
+		}
+		matchedPKs = append(matchedPKs, pk)
+		return limit > 0 && len(matchedPKs) >= limit
 	}
 
-	if len(stack) != 1 {
-		return false
+	// Index Key: IDX:db:table:col:value:pk, with value order-preserving encoded
+	if err := sm.scanIndex(ctx, prefix, []byte(prefixEnd(string(prefix))), reverse, visit); err != nil {
+		return nil, err
 	}
-	return stack[0]
+	return matchedPKs, nil
 }
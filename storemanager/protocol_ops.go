@@ -42,98 +42,423 @@ For more details see: https://mariadb.com/bsl11/
 package storemanager
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"onql/common"
+	"onql/logger"
 	"strings"
 )
 
-// SetProtocol stores a protocol definition.
+// protoPassEntry remembers which protocol a protopass selected, so that
+// queries do not pay for a password hash on every lookup. It is only valid
+// while the protocol still has the same SecretHash. An empty name marks a
+// protopass that matched no record without a SecretLookup.
+type protoPassEntry struct {
+	name, secretHash string
+}
+
+// maxProtoPassEntries bounds the protopass cache; it is cleared when full.
+const maxProtoPassEntries = 10000
+
+// SetProtocol stores a protocol definition under name.
 // It validates the protocol against the existing schema before storing it.
-// The protocol is cached in memory and persisted to disk.
-func (sm *StoreManager) SetProtocol(password string, protocol QueryProtocol) error {
+// The protocol is cached in memory and persisted to disk. An empty secret keeps
+// the protopass of an existing protocol.
+func (sm *StoreManager) SetProtocol(name, secret string, protocol QueryProtocol) error {
+	if name == "" {
+		return fmt.Errorf("%w: protocol name required", common.ErrInvalidInput)
+	}
+
+	var hash string
+	if secret != "" {
+		if err := sm.checkLegacySecretUnused(name, secret); err != nil {
+			return err
+		}
+		var err error
+		if hash, err = HashPassword(secret); err != nil {
+			return err
+		}
+	}
+
 	sm.schema.Mu.Lock()
 	defer sm.schema.Mu.Unlock()
 
 	// Validate protocol against schema
 	if err := sm.validateProtocol(&protocol); err != nil {
-		return fmt.Errorf("protocol validation failed: %v", err)
+		return fmt.Errorf("%w: protocol validation failed: %v", common.ErrInvalidInput, err)
 	}
 
-	// Store in memory cache
-	sm.schema.Protocols[password] = &protocol
+	rec := &ProtocolRecord{Name: name, SecretHash: hash, Protocol: protocol}
+	if hash == "" {
+		old, exists := sm.schema.Protocols[name]
+		if !exists {
+			return fmt.Errorf("%w: new protocol %s needs a secret", common.ErrInvalidInput, name)
+		}
+		rec.SecretHash, rec.SecretLookup = old.SecretHash, old.SecretLookup
+	} else {
+		rec.SecretLookup = secretLookup(sm.protoKey, secret)
+		if err := sm.checkSecretUnusedLocked(name, rec.SecretLookup); err != nil {
+			return err
+		}
+	}
 
-	// Persist to disk
-	key := ProtocolKey(password)
-	data, err := json.Marshal(protocol)
-	if err != nil {
+	if err := sm.saveProtocol(rec); err != nil {
 		return err
 	}
+	sm.putProtocolLocked(rec)
+	return nil
+}
+
+// RotateProtocolSecret replaces the protopass of a protocol; the old one stops
+// working immediately. An empty secret is replaced by a random one.
+// It returns the new secret.
+func (sm *StoreManager) RotateProtocolSecret(name, secret string) (string, error) {
+	if secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		secret = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	if err := sm.checkLegacySecretUnused(name, secret); err != nil {
+		return "", err
+	}
+	hash, err := HashPassword(secret)
+	if err != nil {
+		return "", err
+	}
 
-	return sm.engine.Set(key, data)
+	sm.schema.Mu.Lock()
+	defer sm.schema.Mu.Unlock()
+
+	old, exists := sm.schema.Protocols[name]
+	if !exists {
+		return "", fmt.Errorf("%w: protocol %s", common.ErrNotFound, name)
+	}
+	lookup := secretLookup(sm.protoKey, secret)
+	if err := sm.checkSecretUnusedLocked(name, lookup); err != nil {
+		return "", err
+	}
+	rec := &ProtocolRecord{Name: name, SecretHash: hash, SecretLookup: lookup, Protocol: old.Protocol}
+	if err := sm.saveProtocol(rec); err != nil {
+		return "", err
+	}
+	sm.putProtocolLocked(rec)
+	return secret, nil
 }
 
-// GetProtocol retrieves a protocol by its password (identifier).
-// It checks the in-memory cache first.
+// GetProtocol retrieves the protocol selected by a protopass.
 func (sm *StoreManager) GetProtocol(password string) (*QueryProtocol, error) {
+	rec, err := sm.lookupProtocol(password)
+	if err != nil {
+		return nil, err
+	}
+	return &rec.Protocol, nil
+}
+
+// GetProtocolByName retrieves a protocol by its name.
+func (sm *StoreManager) GetProtocolByName(name string) (*QueryProtocol, error) {
 	sm.schema.Mu.RLock()
 	defer sm.schema.Mu.RUnlock()
 
-	// Check cache first
-	if proto, exists := sm.schema.Protocols[password]; exists {
-		return proto, nil
+	if rec, exists := sm.schema.Protocols[name]; exists {
+		return &rec.Protocol, nil
 	}
 
 	return nil, common.ErrNotFound
 }
 
-// GetAllProtocols returns a list of all registered protocol passwords.
+// lookupProtocol finds the protocol selected by password. The record is found
+// by its SecretLookup and the protopass hashed once to verify it; verified
+// protopasses are remembered by their SHA-256 digest.
+func (sm *StoreManager) lookupProtocol(password string) (*ProtocolRecord, error) {
+	sum := sha256.Sum256([]byte(password))
+
+	sm.protoPassMu.Lock()
+	entry, cached := sm.protoPass[sum]
+	sm.protoPassMu.Unlock()
+
+	sm.schema.Mu.RLock()
+	if cached && entry.name != "" {
+		rec, exists := sm.schema.Protocols[entry.name]
+		if exists && rec.SecretHash == entry.secretHash {
+			sm.schema.Mu.RUnlock()
+			return rec, nil
+		}
+	}
+	rec := sm.schema.ProtocolLookup[secretLookup(sm.protoKey, password)]
+	sm.schema.Mu.RUnlock()
+
+	if rec != nil {
+		// Hashing is slow, so it runs without holding the schema lock
+		if !VerifyPassword(password, rec.SecretHash) {
+			return nil, common.ErrNotFound
+		}
+		sm.rememberProtoPass(sum, protoPassEntry{name: rec.Name, secretHash: rec.SecretHash})
+		return rec, nil
+	}
+	if cached && entry.name == "" {
+		return nil, common.ErrNotFound
+	}
+
+	if rec = sm.legacyProtocol(password); rec == nil {
+		sm.rememberProtoPass(sum, protoPassEntry{})
+		return nil, common.ErrNotFound
+	}
+	sm.rememberProtoPass(sum, protoPassEntry{name: rec.Name, secretHash: rec.SecretHash})
+	return rec, nil
+}
+
+// legacyProtocol hashes password against the records saved without a
+// SecretLookup and adds the lookup to the one it matches. Scans run one at a
+// time, so unknown protopasses cannot keep every core busy hashing.
+func (sm *StoreManager) legacyProtocol(password string) *ProtocolRecord {
+	sm.protoScanMu.Lock()
+	defer sm.protoScanMu.Unlock()
+
+	sm.schema.Mu.RLock()
+	var candidates []*ProtocolRecord
+	for _, rec := range sm.schema.Protocols {
+		if rec.SecretLookup == "" {
+			candidates = append(candidates, rec)
+		}
+	}
+	sm.schema.Mu.RUnlock()
+
+	for _, rec := range candidates {
+		if !VerifyPassword(password, rec.SecretHash) {
+			continue
+		}
+
+		sm.schema.Mu.Lock()
+		defer sm.schema.Mu.Unlock()
+		if sm.schema.Protocols[rec.Name] != rec {
+			return rec // replaced meanwhile; the next lookup sees the new record
+		}
+		keyed := *rec
+		keyed.SecretLookup = secretLookup(sm.protoKey, password)
+		if err := sm.saveProtocol(&keyed); err != nil {
+			logger.Error("Failed to save lookup of protocol %s: %v", rec.Name, err)
+			return rec
+		}
+		sm.putProtocolLocked(&keyed)
+		return &keyed
+	}
+	return nil
+}
+
+// rememberProtoPass caches the outcome of a protopass lookup.
+func (sm *StoreManager) rememberProtoPass(sum [32]byte, entry protoPassEntry) {
+	sm.protoPassMu.Lock()
+	defer sm.protoPassMu.Unlock()
+	if len(sm.protoPass) >= maxProtoPassEntries {
+		sm.protoPass = make(map[[32]byte]protoPassEntry)
+	}
+	sm.protoPass[sum] = entry
+}
+
+// checkSecretUnusedLocked fails if a protocol other than name is selected by
+// the protopass with the given SecretLookup, as a protopass must identify a
+// single protocol. The caller holds schema.Mu.
+func (sm *StoreManager) checkSecretUnusedLocked(name, lookup string) error {
+	if rec, taken := sm.schema.ProtocolLookup[lookup]; taken && rec.Name != name {
+		return fmt.Errorf("%w: secret is used by another protocol", common.ErrDuplicate)
+	}
+	return nil
+}
+
+// checkLegacySecretUnused is checkSecretUnusedLocked for records without a
+// SecretLookup. It hashes, so it runs before the schema lock is taken; such
+// records are never written, only loaded.
+func (sm *StoreManager) checkLegacySecretUnused(name, secret string) error {
+	if rec := sm.legacyProtocol(secret); rec != nil && rec.Name != name {
+		return fmt.Errorf("%w: secret is used by another protocol", common.ErrDuplicate)
+	}
+	return nil
+}
+
+// putProtocolLocked stores rec in the protocol caches. The caller holds schema.Mu.
+func (sm *StoreManager) putProtocolLocked(rec *ProtocolRecord) {
+	if old, exists := sm.schema.Protocols[rec.Name]; exists && old.SecretLookup != "" {
+		delete(sm.schema.ProtocolLookup, old.SecretLookup)
+	}
+	sm.schema.Protocols[rec.Name] = rec
+	if rec.SecretLookup != "" {
+		sm.schema.ProtocolLookup[rec.SecretLookup] = rec
+	}
+}
+
+// secretLookup returns the SecretLookup of a protopass under the protocol key.
+func secretLookup(key []byte, secret string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(secret))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// loadProtocolKey returns the protocol key, creating it on first use.
+func (sm *StoreManager) loadProtocolKey() ([]byte, error) {
+	key, err := sm.engine.Get([]byte(protocolKeyKey))
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, common.ErrNotFound) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, sm.engine.Set([]byte(protocolKeyKey), key)
+}
+
+// GetAllProtocols returns the names of all registered protocols.
 func (sm *StoreManager) GetAllProtocols() ([]string, error) {
 	sm.schema.Mu.RLock()
 	defer sm.schema.Mu.RUnlock()
 
-	passwords := make([]string, 0, len(sm.schema.Protocols))
-	for password := range sm.schema.Protocols {
-		passwords = append(passwords, password)
+	names := make([]string, 0, len(sm.schema.Protocols))
+	for name := range sm.schema.Protocols {
+		names = append(names, name)
 	}
 
-	return passwords, nil
+	return names, nil
 }
 
 // DeleteProtocol removes a protocol definition from both cache and disk.
-func (sm *StoreManager) DeleteProtocol(password string) error {
+func (sm *StoreManager) DeleteProtocol(name string) error {
 	sm.schema.Mu.Lock()
 	defer sm.schema.Mu.Unlock()
 
 	// Remove from cache
-	delete(sm.schema.Protocols, password)
+	if rec, exists := sm.schema.Protocols[name]; exists {
+		delete(sm.schema.ProtocolLookup, rec.SecretLookup)
+	}
+	delete(sm.schema.Protocols, name)
 
 	// Remove from disk
-	key := ProtocolKey(password)
+	key := ProtocolKey(name)
 	return sm.engine.Delete(key)
 }
 
+// saveProtocol persists a protocol record.
+func (sm *StoreManager) saveProtocol(rec *ProtocolRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return sm.engine.Set(ProtocolKey(rec.Name), data)
+}
+
 // LoadProtocols loads all protocols from disk into the in-memory cache.
 // This is typically called on startup.
 func (sm *StoreManager) LoadProtocols() error {
-	prefix := []byte("PROTO:")
+	key, err := sm.loadProtocolKey()
+	if err != nil {
+		return err
+	}
 
-	return sm.engine.IteratePrefix(prefix, func(k, v []byte) error {
-		// Extract password from key (PROTO:password)
-		parts := strings.Split(string(k), ":")
-		if len(parts) < 2 {
-			return nil
+	protocols := make(map[string]*ProtocolRecord)
+	err = sm.engine.IteratePrefix([]byte(protocolPrefix), func(k, v []byte) error {
+		var rec ProtocolRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return err
 		}
-		password := parts[1]
+		protocols[rec.Name] = &rec
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
+	if err := sm.migrateProtocolKeys(protocols, key); err != nil {
+		return err
+	}
+
+	lookup := make(map[string]*ProtocolRecord)
+	for _, rec := range protocols {
+		if rec.SecretLookup != "" {
+			lookup[rec.SecretLookup] = rec
+		}
+	}
+
+	sm.schema.Mu.Lock()
+	sm.protoKey = key
+	sm.schema.Protocols = protocols
+	sm.schema.ProtocolLookup = lookup
+	sm.schema.Mu.Unlock()
+	return nil
+}
+
+// migrateProtocolKeys moves protocols that older versions stored in clear
+// under PROTO:<password> to named records holding a hash of the password.
+// The "default" protocol keeps its name; others are named protocol-1,
+// protocol-2 and so on.
+func (sm *StoreManager) migrateProtocolKeys(protocols map[string]*ProtocolRecord, key []byte) error {
+	type legacyProtocol struct {
+		key      []byte
+		password string
+		protocol QueryProtocol
+	}
+	var legacy []legacyProtocol
+	err := sm.engine.IteratePrefix([]byte(legacyProtocolPrefix), func(k, v []byte) error {
 		var protocol QueryProtocol
 		if err := json.Unmarshal(v, &protocol); err != nil {
 			return err
 		}
-
-		sm.schema.Protocols[password] = &protocol
+		legacy = append(legacy, legacyProtocol{
+			key:      append([]byte(nil), k...),
+			password: strings.TrimPrefix(string(k), legacyProtocolPrefix),
+			protocol: protocol,
+		})
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	for _, l := range legacy {
+		// The record may have been saved by a migration interrupted before
+		// the old key was deleted.
+		migrated := false
+		for _, rec := range protocols {
+			if VerifyPassword(l.password, rec.SecretHash) {
+				migrated = true
+				break
+			}
+		}
+
+		if !migrated {
+			name := l.password
+			if _, taken := protocols[name]; name != DefaultProtocol || taken {
+				for i := 1; ; i++ {
+					name = fmt.Sprintf("protocol-%d", i)
+					if _, taken := protocols[name]; !taken {
+						break
+					}
+				}
+			}
+			hash, err := HashPassword(l.password)
+			if err != nil {
+				return err
+			}
+			rec := &ProtocolRecord{Name: name, SecretHash: hash, SecretLookup: secretLookup(key, l.password), Protocol: l.protocol}
+			if err := sm.saveProtocol(rec); err != nil {
+				return err
+			}
+			protocols[name] = rec
+			logger.Info("Migrated protocol key to protocol %s", name)
+		}
+
+		if err := sm.engine.Delete(l.key); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // validateProtocol checks if a protocol references valid database and tables.
@@ -144,7 +469,7 @@ func (sm *StoreManager) validateProtocol(protocol *QueryProtocol) error {
 		// Check if database exists
 		db, exists := sm.schema.Databases[module.Database]
 		if !exists {
-			return fmt.Errorf("database '%s' does not exist", module.Database)
+			return fmt.Errorf("%w: database '%s' does not exist", common.ErrInvalidInput, module.Database)
 		}
 
 		// Validate each entity
@@ -152,13 +477,13 @@ func (sm *StoreManager) validateProtocol(protocol *QueryProtocol) error {
 			// Check if table exists
 			table, exists := db.Tables[entity.Table]
 			if !exists {
-				return fmt.Errorf("entity '%s': table '%s' does not exist", entityName, entity.Table)
+				return fmt.Errorf("%w: entity '%s': table '%s' does not exist", common.ErrInvalidInput, entityName, entity.Table)
 			}
 
 			// Validate fields
 			for alias, actualField := range entity.Fields {
 				if _, exists := table.Columns[actualField]; !exists {
-					return fmt.Errorf("entity '%s': field '%s' (alias '%s') does not exist in table '%s'",
+					return fmt.Errorf("%w: entity '%s': field '%s' (alias '%s') does not exist in table '%s'", common.ErrInvalidInput,
 						entityName, actualField, alias, entity.Table)
 				}
 			}
@@ -177,14 +502,14 @@ func (sm *StoreManager) validateProtocol(protocol *QueryProtocol) error {
 					}
 				}
 				if !found {
-					return fmt.Errorf("entity '%s': relation '%s' references non-existent entity '%s'",
+					return fmt.Errorf("%w: entity '%s': relation '%s' references non-existent entity '%s'", common.ErrInvalidInput,
 						entityName, relName, relation.Entity)
 				}
 
 				// Validate FK fields exist
 				fkParts := strings.Split(relation.FKField, ":")
 				if len(fkParts) < 2 {
-					return fmt.Errorf("entity '%s': relation '%s' has invalid FK field format",
+					return fmt.Errorf("%w: entity '%s': relation '%s' has invalid FK field format", common.ErrInvalidInput,
 						entityName, relName)
 				}
 
@@ -193,7 +518,7 @@ func (sm *StoreManager) validateProtocol(protocol *QueryProtocol) error {
 					// Through table should be in the same DB? Or specified?
 					// Assuming same DB for now.
 					if _, exists := db.Tables[relation.Through]; !exists {
-						return fmt.Errorf("entity '%s': relation '%s' through table '%s' does not exist",
+						return fmt.Errorf("%w: entity '%s': relation '%s' through table '%s' does not exist", common.ErrInvalidInput,
 							entityName, relName, relation.Through)
 					}
 				}
@@ -224,7 +549,7 @@ func (sm *StoreManager) GetProtoContext(password, entityAlias, contextKey string
 		}
 	}
 
-	return "", fmt.Errorf("entity '%s' not found", entityAlias)
+	return "", fmt.Errorf("entity '%s' %w", entityAlias, common.ErrNotFound)
 }
 
 // ResolveEntityToTable converts an entity alias to the actual database and table names.
@@ -240,7 +565,7 @@ func (sm *StoreManager) ResolveEntityToTable(password, entityAlias string) (stri
 		}
 	}
 
-	return "", "", fmt.Errorf("entity '%s' not found in protocol", entityAlias)
+	return "", "", fmt.Errorf("entity '%s' %w in protocol", entityAlias, common.ErrNotFound)
 }
 
 // ResolveField converts an alias field name to the actual database column name.
@@ -254,19 +579,25 @@ func (sm *StoreManager) ResolveField(password, entityAlias, aliasField string) (
 		if entity, exists := module.Entities[entityAlias]; exists {
 			actualField, exists := entity.Fields[aliasField]
 			if !exists {
-				return "", fmt.Errorf("field '%s' not found in entity '%s'", aliasField, entityAlias)
+				return "", fmt.Errorf("field '%s' %w in entity '%s'", aliasField, common.ErrNotFound, entityAlias)
 			}
 			return actualField, nil
 		}
 	}
 
-	return "", fmt.Errorf("entity '%s' not found", entityAlias)
+	return "", fmt.Errorf("entity '%s' %w", entityAlias, common.ErrNotFound)
 }
 
+const (
+	protocolPrefix       = "PROTOCOL:"
+	legacyProtocolPrefix = "PROTO:" // keyed by the clear-text protopass before protocols had names
+	protocolKeyKey       = "PROTOKEY"
+)
+
 // ProtocolKey generates the storage key for a protocol.
-// Format: PROTO:<password>
-func ProtocolKey(password string) []byte {
-	return []byte(fmt.Sprintf("PROTO:%s", password))
+// Format: PROTOCOL:<name>
+func ProtocolKey(name string) []byte {
+	return []byte(protocolPrefix + name)
 }
 
 // UpdateDefaultProtocol regenerates the "default" protocol from the current schema
@@ -292,8 +623,13 @@ func (sm *StoreManager) UpdateDefaultProtocol() error {
 		}
 		protocol[dbName] = module
 	}
+	// A rotated secret is kept; the first default protocol uses its name
+	secret := ""
+	if _, exists := sm.schema.Protocols[DefaultProtocol]; !exists {
+		secret = DefaultProtocol
+	}
 	sm.schema.Mu.RUnlock()
 
 	// Now set the protocol (this will acquire Write lock on schema)
-	return sm.SetProtocol("default", protocol)
+	return sm.SetProtocol(DefaultProtocol, secret, protocol)
 }
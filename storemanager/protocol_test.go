@@ -0,0 +1,102 @@
+package storemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"onql/common"
+	"onql/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtocolSecrets(t *testing.T) {
+	engine := NewMockEngine()
+
+	// Protocols as stored by older versions
+	legacy, _ := json.Marshal(QueryProtocol{})
+	engine.Set([]byte("PROTO:default"), legacy)
+	engine.Set([]byte("PROTO:s3cret"), legacy)
+
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	if _, err := engine.Get([]byte("PROTO:s3cret")); !errors.Is(err, common.ErrNotFound) {
+		t.Errorf("legacy key not removed: %v", err)
+	}
+	names, _ := sm.GetAllProtocols()
+	if len(names) != 2 {
+		t.Fatalf("protocols after migration = %v", names)
+	}
+	for _, name := range names {
+		if name != DefaultProtocol && name != "protocol-1" {
+			t.Errorf("unexpected protocol name %s", name)
+		}
+		data, _ := engine.Get(ProtocolKey(name))
+		if strings.Contains(string(data), "s3cret") {
+			t.Errorf("protocol %s stores its secret in clear", name)
+		}
+	}
+	if _, err := sm.GetProtocol("s3cret"); err != nil {
+		t.Errorf("migrated protopass rejected: %v", err)
+	}
+
+	if err := sm.SetProtocol("shop", "", QueryProtocol{}); !errors.Is(err, common.ErrInvalidInput) {
+		t.Errorf("new protocol without secret: got %v", err)
+	}
+	if err := sm.SetProtocol("shop", "s3cret", QueryProtocol{}); !errors.Is(err, common.ErrDuplicate) {
+		t.Errorf("reused secret: got %v", err)
+	}
+
+	secret, err := sm.RotateProtocolSecret("protocol-1", "")
+	if err != nil {
+		t.Fatalf("RotateProtocolSecret failed: %v", err)
+	}
+	if _, err := sm.GetProtocol("s3cret"); !errors.Is(err, common.ErrNotFound) {
+		t.Errorf("old protopass still accepted: %v", err)
+	}
+	if _, err := sm.GetProtocol(secret); err != nil {
+		t.Errorf("new protopass rejected: %v", err)
+	}
+
+	// Secrets survive a restart
+	if err := sm.LoadProtocols(); err != nil {
+		t.Fatalf("LoadProtocols failed: %v", err)
+	}
+	if _, err := sm.GetProtocol(secret); err != nil {
+		t.Errorf("protopass rejected after reload: %v", err)
+	}
+}
+
+func TestProtocolLookupWithoutHash(t *testing.T) {
+	engine := NewMockEngine()
+
+	// A record saved before lookups existed
+	hash, _ := HashPassword("old")
+	rec, _ := json.Marshal(ProtocolRecord{Name: "old", SecretHash: hash, Protocol: QueryProtocol{}})
+	engine.Set(ProtocolKey("old"), rec)
+
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	if _, err := sm.GetProtocol("old"); err != nil {
+		t.Fatalf("legacy protopass rejected: %v", err)
+	}
+	var saved ProtocolRecord
+	data, _ := engine.Get(ProtocolKey("old"))
+	json.Unmarshal(data, &saved)
+	if saved.SecretLookup == "" {
+		t.Errorf("lookup not added to legacy record")
+	}
+
+	// With every record keyed, an unknown protopass is rejected without hashing
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if _, err := sm.GetProtocol("wrong-" + strings.Repeat("x", i)); !errors.Is(err, common.ErrNotFound) {
+			t.Fatalf("unknown protopass: got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("100 failed lookups took %v", elapsed)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"onql/logger"
+	"time"
+)
+
+const (
+	// purgeBatch is the number of keys deleted per engine transaction.
+	purgeBatch = 1000
+	// purgeRetryInterval is how often a purge that failed is attempted again.
+	purgeRetryInterval = time.Minute
+)
+
+// errPurgeStopped ends a purge when the store is closed; it resumes on the next start.
+var errPurgeStopped = errors.New("store closed")
+
+// Tombstone records a dropped table or database whose keys are still being deleted.
+type Tombstone struct {
+	DBID      string
+	TableID   string // empty for a whole database
+	Name      string // "db" or "db.table" at the time of the drop
+	DroppedAt time.Time
+	Deleted   int // keys deleted so far
+}
+
+// prefixes returns the key prefixes holding the dropped object's data.
+func (t *Tombstone) prefixes() [][]byte {
+	if t.TableID == "" {
+		return [][]byte{
+			[]byte("DATA:" + t.DBID + ":"),
+			[]byte("IDX:" + t.DBID + ":"),
+			[]byte("CIDX:" + t.DBID + ":"),
+			[]byte("SEQ:" + t.DBID + ":"),
+			[]byte("MAP:TBL:" + t.DBID + ":"),
+			[]byte("META:TBL:" + t.DBID + ":"),
+		}
+	}
+	return [][]byte{
+		DataKey(t.DBID, t.TableID, ""),
+		[]byte("IDX:" + t.DBID + ":" + t.TableID + ":"),
+		[]byte("CIDX:" + t.DBID + ":" + t.TableID + ":"),
+		[]byte("SEQ:" + t.DBID + ":" + t.TableID + ":"),
+	}
+}
+
+// addTombstone persists a tombstone for a dropped table or database and wakes the purger.
+func (sm *StoreManager) addTombstone(dbID, tableID, name string) error {
+	data, err := json.Marshal(&Tombstone{
+		DBID:      dbID,
+		TableID:   tableID,
+		Name:      name,
+		DroppedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := sm.engine.Set(TombstoneKey(dbID, tableID), data); err != nil {
+		return err
+	}
+	select {
+	case sm.purgeWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// PurgeStatus lists the dropped tables and databases whose keys are still being deleted.
+func (sm *StoreManager) PurgeStatus() ([]Tombstone, error) {
+	tombstones := make([]Tombstone, 0)
+	err := sm.engine.IteratePrefix([]byte("META:PURGE:"), func(k, v []byte) error {
+		var t Tombstone
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		tombstones = append(tombstones, t)
+		return nil
+	})
+	return tombstones, err
+}
+
+// purgeLoop deletes the keys of dropped tables and databases in the background.
+// Tombstones are persisted, so a purge interrupted by a shutdown continues on the next start.
+func (sm *StoreManager) purgeLoop() {
+	defer sm.wg.Done()
+	ticker := time.NewTicker(purgeRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := sm.purgeDropped(); err != nil && err != errPurgeStopped {
+			logger.Error("Purge of dropped data failed: %v", err)
+		}
+		select {
+		case <-sm.done:
+			return
+		case <-sm.purgeWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDropped works through all tombstones and runs value log GC if it deleted anything.
+func (sm *StoreManager) purgeDropped() error {
+	tombstones, err := sm.PurgeStatus()
+	if err != nil || len(tombstones) == 0 {
+		return err
+	}
+
+	// Writes to the dropped objects that are still buffered must reach the
+	// engine before their prefixes are deleted, or they would outlive the purge.
+	if err := sm.Flush(); err != nil {
+		return err
+	}
+
+	purged := false
+	for i := range tombstones {
+		t := &tombstones[i]
+		if sm.isLive(t) {
+			// The drop did not complete; the object is still in use
+			logger.Warn("Discarding tombstone of %s, which still exists", t.Name)
+			if err := sm.engine.Delete(TombstoneKey(t.DBID, t.TableID)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := sm.purge(t); err != nil {
+			return err
+		}
+		logger.Info("Purged %d keys of dropped %s", t.Deleted, t.Name)
+		purged = true
+	}
+
+	if purged {
+		return sm.engine.CollectGarbage()
+	}
+	return nil
+}
+
+// isLive reports whether the tombstoned table or database is still in the schema.
+func (sm *StoreManager) isLive(t *Tombstone) bool {
+	sm.schema.Mu.RLock()
+	defer sm.schema.Mu.RUnlock()
+	if t.TableID != "" {
+		return sm.tableByID(t.DBID, t.TableID) != nil
+	}
+	for _, db := range sm.schema.Databases {
+		if db.ID == t.DBID {
+			return true
+		}
+	}
+	return false
+}
+
+// purge deletes every key of a tombstoned object in batches, recording the
+// progress in the tombstone, and removes the tombstone when done.
+func (sm *StoreManager) purge(t *Tombstone) error {
+	key := TombstoneKey(t.DBID, t.TableID)
+	for _, prefix := range t.prefixes() {
+		for {
+			select {
+			case <-sm.done:
+				return errPurgeStopped
+			default:
+			}
+
+			batch := make([][]byte, 0, purgeBatch)
+			err := sm.engine.IteratePrefixWithLimit(prefix, 0, purgeBatch, false, func(k, v []byte) error {
+				batch = append(batch, append([]byte(nil), k...))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				break
+			}
+			if err := sm.engine.BatchDelete(batch); err != nil {
+				return err
+			}
+
+			t.Deleted += len(batch)
+			data, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			if err := sm.engine.Set(key, data); err != nil {
+				return err
+			}
+		}
+	}
+	return sm.engine.Delete(key)
+}
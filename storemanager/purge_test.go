@@ -0,0 +1,77 @@
+package storemanager
+
+import (
+	"onql/config"
+	"testing"
+	"time"
+)
+
+func TestPurgeDropped(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	create := func(dbName, tableName string) {
+		sm.CreateTable(dbName, Table{
+			Name: tableName,
+			PK:   "id",
+			Columns: map[string]*Column{
+				"id":   {Name: "id", Type: TypeString, Indexed: true},
+				"name": {Name: "name", Type: TypeString, Indexed: true},
+			},
+		})
+		for _, id := range []string{"a", "b", "c"} {
+			sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": id, "name": id}})
+		}
+	}
+	sm.CreateDatabase("keep")
+	sm.CreateDatabase("gone")
+	create("keep", "t1")
+	create("keep", "t2")
+	create("gone", "t3")
+	sm.Flush()
+
+	keepID, t1, _ := sm.GetTableSchema("keep", "t1")
+	_, t2, _ := sm.GetTableSchema("keep", "t2")
+	goneID, _, _ := sm.GetTableSchema("gone", "t3")
+
+	// A tombstone left by a drop that did not complete must not delete live data
+	sm.addTombstone(keepID, t2.ID, "keep.t2")
+
+	if err := sm.DropTable("keep", "t1"); err != nil {
+		t.Fatalf("DropTable failed: %v", err)
+	}
+	if err := sm.DropDatabase("gone"); err != nil {
+		t.Fatalf("DropDatabase failed: %v", err)
+	}
+
+	count := func(prefix string) int {
+		keys, _ := engine.snapshot([]byte(prefix), false)
+		return len(keys)
+	}
+	for i := 0; i < 200; i++ {
+		if pending, _ := sm.PurgeStatus(); len(pending) == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if pending, _ := sm.PurgeStatus(); len(pending) != 0 {
+		t.Fatalf("purge did not finish: %+v", pending)
+	}
+	if n := count("DATA:" + keepID + ":" + t1.ID + ":"); n != 0 {
+		t.Errorf("%d rows of dropped table left", n)
+	}
+	if n := count("IDX:" + keepID + ":" + t1.ID + ":"); n != 0 {
+		t.Errorf("%d index entries of dropped table left", n)
+	}
+	if n := count("DATA:" + goneID + ":"); n != 0 {
+		t.Errorf("%d rows of dropped database left", n)
+	}
+	if n := count("META:TBL:" + goneID + ":"); n != 0 {
+		t.Errorf("%d table definitions of dropped database left", n)
+	}
+	if n := count("DATA:" + keepID + ":" + t2.ID + ":"); n != 3 {
+		t.Errorf("live table has %d rows after purge, want 3", n)
+	}
+}
@@ -109,23 +109,33 @@ func (sm *StoreManager) CreateTable(dbName string, table Table) error {
 
 	db, exists := sm.schema.Databases[dbName]
 	if !exists {
-		return fmt.Errorf("database %s does not exist", dbName)
+		return fmt.Errorf("database %s %w", dbName, common.ErrNotFound)
 	}
 
 	if _, exists := db.Tables[table.Name]; exists {
-		return fmt.Errorf("table %s already exists", table.Name)
+		return fmt.Errorf("%w: table %s already exists", common.ErrInvalidInput, table.Name)
 	}
 
 	// Validate PK
 	if _, ok := table.Columns[table.PK]; !ok {
-		return fmt.Errorf("primary key column %s not defined", table.PK)
+		return fmt.Errorf("%w: primary key column %s not defined", common.ErrInvalidInput, table.PK)
 	}
 
 	// Generate IDs
 	table.ID = generateID()
 	for _, col := range table.Columns {
 		col.ID = generateID()
-		col.Indexed = true // Enforce indexing
+		col.IndexBuilding = false
+		if col.Unique && !col.Indexed {
+			return fmt.Errorf("%w: unique column %s must be indexed", common.ErrInvalidInput, col.Name)
+		}
+	}
+	for name, idx := range table.Indexes {
+		idx.Name = name
+		if err := validateIndex(&table, idx); err != nil {
+			return err
+		}
+		idx.ID = generateID()
 	}
 
 	db.Tables[table.Name] = &table
@@ -239,7 +249,7 @@ func (sm *StoreManager) FetchTables(dbName string) ([]string, error) {
 	defer sm.schema.Mu.RUnlock()
 	db, ok := sm.schema.Databases[dbName]
 	if !ok {
-		return nil, fmt.Errorf("database %s not found", dbName)
+		return nil, fmt.Errorf("database %s %w", dbName, common.ErrNotFound)
 	}
 	var tables []string
 	for name := range db.Tables {
@@ -295,7 +305,7 @@ func (sm *StoreManager) RenameDatabase(oldName, newName string) error {
 }
 
 // DropDatabase deletes a database and all its contents.
-// This includes deleting all tables, data, and indices associated with the database.
+// Its tables, data, and indices are deleted afterwards by the background purger.
 // WARNING: This operation is irreversible.
 func (sm *StoreManager) DropDatabase(name string) error {
 	sm.schema.Mu.Lock()
@@ -306,10 +316,10 @@ func (sm *StoreManager) DropDatabase(name string) error {
 		return common.ErrNotFound
 	}
 
-	// 1. Delete all tables
-	// We need to delete data keys too.
-	// Iterate prefix DATA:dbID: and IDX:dbID: and META:TBL:dbID:
-	// This is still heavy but necessary for cleanup.
+	// Tables, rows and indexes are deleted by the background purger
+	if err := sm.addTombstone(db.ID, "", name); err != nil {
+		return err
+	}
 
 	// Delete Map
 	if err := sm.engine.Delete(MapDBKey(name)); err != nil {
@@ -372,8 +382,7 @@ func (sm *StoreManager) RenameTable(dbName, oldName, newName string) error {
 
 // DropTable drops a table from a database.
 // It removes the table metadata and mapping.
-// Note: This currently does not delete the actual data rows or indices for efficiency,
-// but a background cleanup process should ideally handle that.
+// Rows and indices are deleted afterwards by the background purger (see purge.go).
 func (sm *StoreManager) DropTable(dbName, tableName string) error {
 	sm.schema.Mu.Lock()
 	defer sm.schema.Mu.Unlock()
@@ -387,6 +396,11 @@ func (sm *StoreManager) DropTable(dbName, tableName string) error {
 		return common.ErrNotFound
 	}
 
+	// Rows and indexes are deleted by the background purger
+	if err := sm.addTombstone(db.ID, table.ID, dbName+"."+tableName); err != nil {
+		return err
+	}
+
 	delete(db.Tables, tableName)
 
 	// Delete Map
@@ -407,7 +421,16 @@ func (sm *StoreManager) DropTable(dbName, tableName string) error {
 func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]interface{}) error {
 	// Acquire write lock for operations that modify structure
 	// (renameColumn, dropColumn need migration lock; addColumn/modifyColumn are safer)
-	if _, hasRename := changes["renameColumn"]; hasRename {
+	// A type change re-encodes the column's index, so writes must be blocked as well.
+	// Building or dropping a composite index rewrites its entries from the rows.
+	// Making a column unique checks the existing rows, which must not change meanwhile.
+	_, hasRename := changes["renameColumn"]
+	modCol, _ := changes["modifyColumn"].(map[string]interface{})
+	_, hasRetype := modCol["type"]
+	_, hasUnique := modCol["unique"]
+	_, hasAddIndex := changes["addIndex"]
+	_, hasDropIndex := changes["dropIndex"]
+	if hasRename || hasRetype || hasUnique || hasAddIndex || hasDropIndex {
 		sm.migrationLock.Lock()
 		defer sm.migrationLock.Unlock()
 	}
@@ -425,10 +448,14 @@ func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]
 	}
 
 	// Supported operations:
-	// - addColumn: { name, type, formatter, validator, indexed }
+	// - addColumn: { name, type, formatter, validator, indexed, unique }
 	// - dropColumn: { name }
-	// - modifyColumn: { name, type, formatter, validator, indexed }
+	// - modifyColumn: { name, type, formatter, validator, unique }
 	// - renameColumn: { oldName, newName }
+	// - dropIndex: { name }
+	// - addIndex: { name, columns }
+	// The single-column index of an existing column is changed in the background
+	// with BuildColumnIndex and DropColumnIndex.
 
 	// Add Column
 	if addCol, ok := changes["addColumn"]; ok {
@@ -436,7 +463,7 @@ func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]
 		colName := colMap["name"].(string)
 
 		if _, exists := table.Columns[colName]; exists {
-			return fmt.Errorf("column %s already exists", colName)
+			return fmt.Errorf("%w: column %s already exists", common.ErrInvalidInput, colName)
 		}
 
 		colTypeStr, _ := colMap["type"].(string)
@@ -446,9 +473,13 @@ func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]
 			Formatter:    getString(colMap, "formatter"),
 			Validator:    getString(colMap, "validator"),
 			DefaultValue: colMap["default"],
-			Indexed:      true, // Enforce indexing
+			Indexed:      colMap["indexed"] != false,
+			Unique:       getBool(colMap, "unique"),
 			ID:           generateID(),
 		}
+		if col.Unique && !col.Indexed {
+			return fmt.Errorf("%w: unique column %s must be indexed", common.ErrInvalidInput, colName)
+		}
 		// Parse rules
 		if col.Formatter != "" {
 			col.FormatterRules = strings.Split(col.Formatter, "|")
@@ -466,20 +497,27 @@ func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]
 		colName := colMap["name"].(string)
 
 		if colName == table.PK {
-			return fmt.Errorf("cannot drop primary key column")
+			return fmt.Errorf("%w: cannot drop primary key column", common.ErrInvalidInput)
 		}
 
 		col, exists := table.Columns[colName]
 		if !exists {
-			return fmt.Errorf("column %s does not exist", colName)
+			return fmt.Errorf("%w: column %s does not exist", common.ErrInvalidInput, colName)
+		}
+		for _, idx := range table.Indexes {
+			for _, name := range idx.Columns {
+				if name == colName {
+					return fmt.Errorf("%w: column %s is used by index %s", common.ErrInvalidInput, colName, idx.Name)
+				}
+			}
 		}
 
 		// Remove indices
-		if col.Indexed {
+		if col.maintainsIndex() {
 			// IDX:dbID:tableID:colID:
-			prefix := fmt.Sprintf("IDX:%s:%s:%s:", db.ID, table.ID, col.ID)
+			prefix := IndexPrefix(db.ID, table.ID, col.ID)
 			keysToDelete := make([][]byte, 0)
-			sm.engine.IteratePrefix([]byte(prefix), func(k, v []byte) error {
+			sm.engine.IteratePrefix(prefix, func(k, v []byte) error {
 				keysToDelete = append(keysToDelete, k)
 				return nil
 			})
@@ -498,11 +536,13 @@ func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]
 
 		existingCol, exists := table.Columns[colName]
 		if !exists {
-			return fmt.Errorf("column %s does not exist", colName)
+			return fmt.Errorf("%w: column %s does not exist", common.ErrInvalidInput, colName)
 		}
 
 		// Update properties if provided
+		retyped := false
 		if typeStr, ok := colMap["type"].(string); ok {
+			retyped = existingCol.Type != DataType(typeStr)
 			existingCol.Type = DataType(typeStr)
 		}
 		if formatter, ok := colMap["formatter"].(string); ok {
@@ -516,8 +556,32 @@ func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]
 		if _, ok := colMap["default"]; ok {
 			existingCol.DefaultValue = colMap["default"]
 		}
-		// Enforce indexing always
-		existingCol.Indexed = true
+		// Index values are encoded by type; re-encode existing entries
+		if retyped && existingCol.maintainsIndex() {
+			if err := sm.Flush(); err != nil {
+				return err
+			}
+			if err := sm.rebuildIndexes(db.ID, table, []*Column{existingCol}); err != nil {
+				return err
+			}
+		}
+
+		// Existing rows must already satisfy a new unique constraint
+		if _, ok := colMap["unique"]; ok {
+			unique := getBool(colMap, "unique")
+			if unique && !existingCol.Indexed {
+				return fmt.Errorf("%w: unique column %s must be indexed", common.ErrInvalidInput, colName)
+			}
+			if unique && !existingCol.Unique {
+				if err := sm.Flush(); err != nil {
+					return err
+				}
+				if err := sm.checkUniqueValues(db.ID, table, existingCol); err != nil {
+					return err
+				}
+			}
+			existingCol.Unique = unique
+		}
 	}
 
 	// Rename Column
@@ -528,10 +592,10 @@ func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]
 
 		col, exists := table.Columns[oldName]
 		if !exists {
-			return fmt.Errorf("column %s does not exist", oldName)
+			return fmt.Errorf("%w: column %s does not exist", common.ErrInvalidInput, oldName)
 		}
 		if _, exists := table.Columns[newName]; exists {
-			return fmt.Errorf("column %s already exists", newName)
+			return fmt.Errorf("%w: column %s already exists", common.ErrInvalidInput, newName)
 		}
 
 		// Update column name
@@ -543,10 +607,71 @@ func (sm *StoreManager) AlterTable(dbName, tableName string, changes map[string]
 		if table.PK == oldName {
 			table.PK = newName
 		}
+		for _, idx := range table.Indexes {
+			for i, name := range idx.Columns {
+				if name == oldName {
+					idx.Columns[i] = newName
+				}
+			}
+		}
 
 		// No need to migrate indices because they use Column ID, which hasn't changed!
 	}
 
+	// Drop Index
+	if dropIdx, ok := changes["dropIndex"]; ok {
+		idxMap := dropIdx.(map[string]interface{})
+		name := getString(idxMap, "name")
+
+		idx, exists := table.Indexes[name]
+		if !exists {
+			return fmt.Errorf("%w: index %s does not exist", common.ErrInvalidInput, name)
+		}
+		// Flush first so buffered entries cannot land after the delete
+		if err := sm.Flush(); err != nil {
+			return err
+		}
+		if err := sm.deletePrefix(CompositeIndexPrefix(db.ID, table.ID, idx.ID)); err != nil {
+			return err
+		}
+		delete(table.Indexes, name)
+	}
+
+	// Add Index
+	if addIdx, ok := changes["addIndex"]; ok {
+		idxMap := addIdx.(map[string]interface{})
+		idx := &Index{
+			ID:   generateID(),
+			Name: getString(idxMap, "name"),
+		}
+		switch cols := idxMap["columns"].(type) {
+		case []string:
+			idx.Columns = cols
+		case []interface{}:
+			for _, c := range cols {
+				name, _ := c.(string)
+				idx.Columns = append(idx.Columns, name)
+			}
+		}
+
+		if _, exists := table.Indexes[idx.Name]; exists {
+			return fmt.Errorf("%w: index %s already exists", common.ErrInvalidInput, idx.Name)
+		}
+		if err := validateIndex(table, idx); err != nil {
+			return err
+		}
+		if err := sm.Flush(); err != nil {
+			return err
+		}
+		if err := sm.buildCompositeIndex(db.ID, table, idx); err != nil {
+			return err
+		}
+		if table.Indexes == nil {
+			table.Indexes = make(map[string]*Index)
+		}
+		table.Indexes[idx.Name] = idx
+	}
+
 	// Persist
 	data, err := json.Marshal(table)
 	if err != nil {
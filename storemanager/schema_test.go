@@ -1,9 +1,14 @@
 package storemanager
 
 import (
-	"fmt"
+	"context"
+	"encoding/gob"
+	"io"
+	"onql/common"
 	"onql/config"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -11,6 +16,17 @@ import (
 // MockEngine implements Engine interface for testing
 type MockEngine struct {
 	data map[string][]byte
+	mu   sync.RWMutex
+}
+
+// newTestStore opens a StoreManager on eng, failing the test on error.
+func newTestStore(t *testing.T, eng Engine, cfg *config.Config) *StoreManager {
+	t.Helper()
+	sm, err := New(eng, cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return sm
 }
 
 func NewMockEngine() *MockEngine {
@@ -20,36 +36,100 @@ func NewMockEngine() *MockEngine {
 }
 
 func (m *MockEngine) Set(key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.data[string(key)] = value
 	return nil
 }
 
 func (m *MockEngine) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	val, ok := m.data[string(key)]
 	if !ok {
-		return nil, fmt.Errorf("not found")
+		return nil, common.ErrNotFound
 	}
 	return val, nil
 }
 
 func (m *MockEngine) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.data, string(key))
 	return nil
 }
 
 func (m *MockEngine) BatchSet(keys, values [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for i, k := range keys {
 		m.data[string(k)] = values[i]
 	}
 	return nil
 }
 
-func (m *MockEngine) IteratePrefix(prefix []byte, fn func(k, v []byte) error) error {
+func (m *MockEngine) BatchDelete(keys [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		delete(m.data, string(k))
+	}
+	return nil
+}
+
+func (m *MockEngine) CollectGarbage() error {
+	return nil
+}
+
+func (m *MockEngine) Backup(w io.Writer, snapshotTaken func()) error {
+	m.mu.RLock()
+	data := make(map[string][]byte, len(m.data))
 	for k, v := range m.data {
+		data[k] = v
+	}
+	m.mu.RUnlock()
+	snapshotTaken()
+	return gob.NewEncoder(w).Encode(data)
+}
+
+func (m *MockEngine) Restore(r io.Reader) error {
+	var data map[string][]byte
+	if err := gob.NewDecoder(r).Decode(&data); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, v := range data {
+		m.data[k] = v
+	}
+	return nil
+}
+
+// snapshot returns the entries under prefix in key order, like Badger's iterator.
+// It copies under the lock so callbacks may write back into the engine.
+func (m *MockEngine) snapshot(prefix []byte, reverse bool) (keys []string, values [][]byte) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for k := range m.data {
 		if strings.HasPrefix(k, string(prefix)) {
-			if err := fn([]byte(k), v); err != nil {
-				return err
-			}
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+	for _, k := range keys {
+		values = append(values, m.data[k])
+	}
+	return keys, values
+}
+
+func (m *MockEngine) IteratePrefix(prefix []byte, fn func(k, v []byte) error) error {
+	keys, values := m.snapshot(prefix, false)
+	for i, k := range keys {
+		if err := fn([]byte(k), values[i]); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -59,20 +139,31 @@ func (m *MockEngine) IteratePrefixWithLimit(prefix []byte, offset, limit int, re
 	count := 0
 	skipped := 0
 
-	// Note: Iteration order in map is random, so this mock is limited for order tests.
-	for k, v := range m.data {
-		if strings.HasPrefix(k, string(prefix)) {
-			if skipped < offset {
-				skipped++
-				continue
-			}
-			if limit > 0 && count >= limit {
-				break
-			}
-			if err := fn([]byte(k), v); err != nil {
-				return err
-			}
-			count++
+	keys, values := m.snapshot(prefix, reverse)
+	for i, k := range keys {
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if limit > 0 && count >= limit {
+			break
+		}
+		if err := fn([]byte(k), values[i]); err != nil {
+			return err
+		}
+		count++
+	}
+	return nil
+}
+
+func (m *MockEngine) IterateRange(start, end []byte, reverse bool, fn func(k, v []byte) error) error {
+	keys, values := m.snapshot(nil, reverse)
+	for i, k := range keys {
+		if k < string(start) || k >= string(end) {
+			continue
+		}
+		if err := fn([]byte(k), values[i]); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -81,7 +172,7 @@ func (m *MockEngine) IteratePrefixWithLimit(prefix []byte, offset, limit int, re
 func TestSchemaRefactoring(t *testing.T) {
 	engine := NewMockEngine()
 	cfg := &config.Config{FlushInterval: 100 * time.Millisecond}
-	sm := New(engine, cfg)
+	sm := newTestStore(t, engine, cfg)
 	defer sm.Close()
 
 	// 1. Create Database
@@ -207,7 +298,7 @@ func TestSchemaRefactoring(t *testing.T) {
 			},
 		},
 	}
-	err = sm.SetProtocol(protoPass, protocol)
+	err = sm.SetProtocol("users", protoPass, protocol)
 	if err != nil {
 		t.Fatalf("SetProtocol failed: %v", err)
 	}
@@ -235,7 +326,7 @@ func TestSchemaRefactoring(t *testing.T) {
 	}
 
 	// GetAllPks
-	pks, err := sm.GetAllPks(dbName, newTableName)
+	pks, err := sm.GetAllPks(context.Background(), dbName, newTableName)
 	if err != nil {
 		t.Fatalf("GetAllPks failed: %v", err)
 	}
@@ -252,7 +343,7 @@ func TestSchemaRefactoring(t *testing.T) {
 	}
 
 	// GetDataByPKs
-	rows, err := sm.GetDataByPKs(dbName, newTableName, []string{"u1", "u2"})
+	rows, err := sm.GetDataByPKs(context.Background(), dbName, newTableName, []string{"u1", "u2"})
 	if err != nil {
 		t.Fatalf("GetDataByPKs failed: %v", err)
 	}
@@ -262,7 +353,7 @@ func TestSchemaRefactoring(t *testing.T) {
 
 	// GetPkByIndex (Slice return)
 	// u1 -> Alice, u2 -> Bob
-	foundPKs, err := sm.GetPkByIndex(dbName, newTableName, "name", "Alice")
+	foundPKs, err := sm.GetPkByIndex(context.Background(), dbName, newTableName, "name", "Alice")
 	if err != nil {
 		t.Fatalf("GetPkByIndex failed: %v", err)
 	}
@@ -42,8 +42,14 @@ For more details see: https://mariadb.com/bsl11/
 package storemanager
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Key generation helpers
@@ -80,24 +86,252 @@ func DataKey(dbID, tableID, pk string) []byte {
 	return []byte(fmt.Sprintf("DATA:%s:%s:%s", dbID, tableID, pk))
 }
 
+// encodeRow serializes a row for its DATA key.
+// Format: <version>:<JSON of row.Data>
+func encodeRow(row Row) ([]byte, error) {
+	data, err := json.Marshal(row.Data)
+	if err != nil {
+		return nil, err
+	}
+	val := strconv.AppendUint(nil, row.Version, 10)
+	val = append(val, ':')
+	return append(val, data...), nil
+}
+
+// decodeRow parses a DATA value. Values without a version prefix are plain
+// JSON objects written before row versions and have version 0.
+func decodeRow(val []byte) (Row, error) {
+	var row Row
+	if i := bytes.IndexByte(val, ':'); i > 0 && val[0] != '{' {
+		version, err := strconv.ParseUint(string(val[:i]), 10, 64)
+		if err != nil {
+			return row, fmt.Errorf("bad row version: %v", err)
+		}
+		row.Version, val = version, val[i+1:]
+	}
+	err := json.Unmarshal(val, &row.Data)
+	return row, err
+}
+
+// IndexPrefix generates the prefix shared by all index entries of a column.
+// Format: IDX:<dbID>:<tableID>:<colID>:
+func IndexPrefix(dbID, tableID, colID string) []byte {
+	return []byte(fmt.Sprintf("IDX:%s:%s:%s:", dbID, tableID, colID))
+}
+
 // IndexKey generates the key for an index entry.
 // Format: IDX:<dbID>:<tableID>:<colID>:<value>:<pk>
+// value must come from EncodeIndexValue, which is self-delimiting and
+// order-preserving, so keys sort by typed column value and then by pk.
 func IndexKey(dbID, tableID, colID, value, pk string) []byte {
-	// Value might contain colons, so we might need to escape or just use it as is if we are careful.
-	// For simplicity, assuming value doesn't break the structure or we use a separator that is rare.
-	// A better approach is to use a binary format or length-prefixed, but string is easier for debugging.
 	return []byte(fmt.Sprintf("IDX:%s:%s:%s:%s:%s", dbID, tableID, colID, value, pk))
 }
 
 // ParseIndexKey extracts info from an index key.
-// It returns the components of the key: dbID, tableID, colID, value, and pk.
+// It returns the components of the key: dbID, tableID, colID, the encoded value, and pk.
 func ParseIndexKey(key []byte) (dbID, tableID, colID, val, pk string) {
-	parts := strings.Split(string(key), ":")
-	if len(parts) < 6 {
+	// IDX:dbID:tableID:colID:val:pk
+	parts := strings.SplitN(string(key), ":", 5)
+	if len(parts) < 5 {
 		return
 	}
-	// IDX:dbID:tableID:colID:val:pk
-	return parts[1], parts[2], parts[3], parts[4], parts[5]
+	rest := parts[4]
+	n := indexValueLen(rest)
+	if n < 0 || len(rest) <= n || rest[n] != ':' {
+		return
+	}
+	return parts[1], parts[2], parts[3], rest[:n], rest[n+1:]
+}
+
+// CompositeIndexPrefix generates the prefix shared by all entries of a composite index.
+// Format: CIDX:<dbID>:<tableID>:<indexID>:
+func CompositeIndexPrefix(dbID, tableID, indexID string) []byte {
+	return []byte(fmt.Sprintf("CIDX:%s:%s:%s:", dbID, tableID, indexID))
+}
+
+// CompositeIndexKey generates the key for a composite index entry.
+// Format: CIDX:<dbID>:<tableID>:<indexID>:<values>:<pk>
+// values is the concatenation of EncodeIndexValue for each index column. The
+// encodings are self-delimiting, so keys sort by the column tuple and then by pk.
+func CompositeIndexKey(dbID, tableID, indexID, values, pk string) []byte {
+	return []byte(fmt.Sprintf("CIDX:%s:%s:%s:%s:%s", dbID, tableID, indexID, values, pk))
+}
+
+// IndexFormatKey stores the version of the index key encoding in use.
+// Format: META:IDXFMT
+func IndexFormatKey() []byte {
+	return []byte("META:IDXFMT")
+}
+
+// TombstoneKey records a dropped table, or a dropped database if tableID is
+// empty, whose keys have not been purged yet.
+// Format: META:PURGE:<dbID>:<tableID>
+func TombstoneKey(dbID, tableID string) []byte {
+	return []byte(fmt.Sprintf("META:PURGE:%s:%s", dbID, tableID))
+}
+
+// ChangeKey generates the key of a change log record. The sequence number is
+// zero-padded so records sort in commit order.
+// Format: CDC:<seq>
+func ChangeKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("CDC:%020d", seq))
+}
+
+// ChangeTrimKey stores the highest sequence number removed from the change log.
+// Format: META:CDCTRIM
+func ChangeTrimKey() []byte {
+	return []byte("META:CDCTRIM")
+}
+
+// UserKey generates the key for storing a user account.
+// Format: USER:<name>
+func UserKey(name string) []byte {
+	return []byte(fmt.Sprintf("USER:%s", name))
+}
+
+// RoleKey generates the key for storing a role.
+// Format: ROLE:<name>
+func RoleKey(name string) []byte {
+	return []byte(fmt.Sprintf("ROLE:%s", name))
+}
+
+// Index value encoding.
+// Every encoded value starts with a type tag so that values of different
+// kinds never interleave: null < numbers < timestamps < strings.
+const (
+	indexTagNull   byte = 0x01
+	indexTagNumber byte = 0x02 // 8 bytes, sign-flipped IEEE 754
+	indexTagTime   byte = 0x03 // 8 bytes sign-flipped unix seconds + 4 bytes nanos
+	indexTagString byte = 0x04 // escaped bytes terminated by 0x00 0x01
+)
+
+// EncodeIndexValue encodes a column value for use in IndexKey.
+// Byte order of the result matches the natural order of the values:
+// numeric order for numbers, chronological order for timestamps, whether given
+// as RFC3339 strings or as Unix seconds, and byte order for everything else
+// (formatted with %v). Values that do not fit the column type fall back to the
+// string encoding.
+func EncodeIndexValue(colType DataType, val interface{}) string {
+	if val == nil {
+		return string([]byte{indexTagNull})
+	}
+
+	switch colType {
+	case TypeNumber:
+		if f, ok := indexNumber(val); ok {
+			return encodeIndexNumber(f)
+		}
+	case TypeTimestamp:
+		if f, ok := indexNumber(val); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			sec, frac := math.Modf(f)
+			return encodeIndexTime(time.Unix(int64(sec), int64(frac*1e9)))
+		}
+		if s, ok := val.(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return encodeIndexTime(t)
+			}
+		}
+	}
+
+	return encodeIndexString(fmt.Sprintf("%v", val))
+}
+
+// indexNumber converts numeric values and numeric strings to float64.
+func indexNumber(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func encodeIndexNumber(f float64) string {
+	if f == 0 {
+		f = 0 // fold -0 into +0
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		bits = ^bits // negative: invert everything so larger magnitudes sort first
+	} else {
+		bits |= 1 << 63 // positive: set the sign bit so they sort after negatives
+	}
+	b := make([]byte, 9)
+	b[0] = indexTagNumber
+	binary.BigEndian.PutUint64(b[1:], bits)
+	return string(b)
+}
+
+func encodeIndexTime(t time.Time) string {
+	b := make([]byte, 13)
+	b[0] = indexTagTime
+	binary.BigEndian.PutUint64(b[1:9], uint64(t.Unix())^(1<<63))
+	binary.BigEndian.PutUint32(b[9:], uint32(t.Nanosecond()))
+	return string(b)
+}
+
+func encodeIndexString(s string) string {
+	b := make([]byte, 0, len(s)+3)
+	b = append(b, indexTagString)
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x00 {
+			b = append(b, 0x00, 0xFF)
+		} else {
+			b = append(b, s[i])
+		}
+	}
+	return string(append(b, 0x00, 0x01))
+}
+
+// indexValueLen returns the length of the encoded value at the start of s, or -1.
+func indexValueLen(s string) int {
+	if len(s) == 0 {
+		return -1
+	}
+	switch s[0] {
+	case indexTagNull:
+		return 1
+	case indexTagNumber:
+		if len(s) < 9 {
+			return -1
+		}
+		return 9
+	case indexTagTime:
+		if len(s) < 13 {
+			return -1
+		}
+		return 13
+	case indexTagString:
+		for i := 1; i+1 < len(s); i++ {
+			if s[i] != 0x00 {
+				continue
+			}
+			if s[i+1] == 0x01 {
+				return i + 2
+			}
+			i++ // skip escaped 0x00
+		}
+	}
+	return -1
 }
 
 // SequenceKey generates the key for storing a column sequence counter.
@@ -0,0 +1,204 @@
+package storemanager
+
+import (
+	"context"
+	"onql/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIndexValueOrdering(t *testing.T) {
+	numbers := []interface{}{-1e9, -10, -2.5, 0, 1, 9, 10, 1e6, "1000001"}
+	for i := 1; i < len(numbers); i++ {
+		a := EncodeIndexValue(TypeNumber, numbers[i-1])
+		b := EncodeIndexValue(TypeNumber, numbers[i])
+		if a >= b {
+			t.Errorf("number %v should sort before %v", numbers[i-1], numbers[i])
+		}
+	}
+
+	times := []interface{}{-1.5, "1970-01-01T00:00:00Z", 0.25, "2023-12-31T23:00:00-02:00", 1704074400, "2024-01-01T02:00:00.5Z", 1704074401.0}
+	for i := 1; i < len(times); i++ {
+		if EncodeIndexValue(TypeTimestamp, times[i-1]) >= EncodeIndexValue(TypeTimestamp, times[i]) {
+			t.Errorf("timestamp %v should sort before %v", times[i-1], times[i])
+		}
+	}
+	if EncodeIndexValue(TypeTimestamp, 1704074400) != EncodeIndexValue(TypeTimestamp, "2024-01-01T02:00:00Z") {
+		t.Errorf("numeric and RFC3339 forms of one time encode differently")
+	}
+
+	strs := []string{"", "a", "a\x00", "a\x00b", "ab", "b"}
+	for i := 1; i < len(strs); i++ {
+		if EncodeIndexValue(TypeString, strs[i-1]) >= EncodeIndexValue(TypeString, strs[i]) {
+			t.Errorf("string %q should sort before %q", strs[i-1], strs[i])
+		}
+	}
+
+	key := IndexKey("d", "t", "c", EncodeIndexValue(TypeString, "x:y\x00"), "p:1")
+	if db, tbl, col, val, pk := ParseIndexKey(key); db != "d" || tbl != "t" || col != "c" || pk != "p:1" || val != EncodeIndexValue(TypeString, "x:y\x00") {
+		t.Errorf("ParseIndexKey round trip failed: %q %q %q %q %q", db, tbl, col, val, pk)
+	}
+}
+
+func TestSortedIndexScanAndMigration(t *testing.T) {
+	engine := NewMockEngine()
+	cfg := &config.Config{FlushInterval: time.Hour}
+	sm := newTestStore(t, engine, cfg)
+
+	dbName := "idxdb"
+	tableName := "prices"
+	sm.CreateDatabase(dbName)
+	sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":    {Name: "id", Type: TypeString, Indexed: true},
+			"price": {Name: "price", Type: TypeNumber, Indexed: true},
+		},
+	})
+
+	// Half on disk, half in the buffer, so the scan has to merge both.
+	for id, price := range map[string]float64{"a": 10, "b": 9, "c": -3} {
+		sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": id, "price": price}})
+	}
+	sm.Flush()
+	for id, price := range map[string]float64{"d": 100, "e": 0.5} {
+		sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": id, "price": price}})
+	}
+	sm.Update(dbName, tableName, "b", Row{Data: map[string]interface{}{"id": "b", "price": 1000}})
+
+	pks, err := sm.GetPksSortedByCol(context.Background(), dbName, tableName, "price", 0, 0, false)
+	if err != nil || !reflect.DeepEqual(pks, []string{"c", "e", "a", "d", "b"}) {
+		t.Errorf("ascending scan = %v (%v)", pks, err)
+	}
+	pks, _ = sm.GetPksSortedByCol(context.Background(), dbName, tableName, "price", 1, 2, true)
+	if !reflect.DeepEqual(pks, []string{"d", "a"}) {
+		t.Errorf("descending scan with offset/limit = %v", pks)
+	}
+	pks, _ = sm.GetPksSortedByColWithFilter(context.Background(), dbName, tableName, "price", 0, 1, false, []string{"id:a"})
+	if !reflect.DeepEqual(pks, []string{"a"}) {
+		t.Errorf("filtered scan = %v", pks)
+	}
+	sm.Close()
+
+	// Rewrite the index in the version 1 text format and restart.
+	dbID, table, _ := sm.GetTableSchema(dbName, tableName)
+	priceCol := table.Columns["price"]
+	engine.Delete(IndexFormatKey())
+	for k := range engine.data {
+		if _, _, colID, _, _ := ParseIndexKey([]byte(k)); colID == priceCol.ID {
+			delete(engine.data, k)
+		}
+	}
+	engine.Set([]byte("IDX:"+dbID+":"+table.ID+":"+priceCol.ID+":10:a"), []byte("a"))
+
+	sm2 := newTestStore(t, engine, cfg)
+	defer sm2.Close()
+
+	if _, err := engine.Get([]byte("IDX:" + dbID + ":" + table.ID + ":" + priceCol.ID + ":10:a")); err == nil {
+		t.Errorf("old format index key was not removed")
+	}
+	pks, err = sm2.GetPksSortedByCol(context.Background(), dbName, tableName, "price", 0, 0, false)
+	if err != nil || !reflect.DeepEqual(pks, []string{"c", "e", "a", "d", "b"}) {
+		t.Errorf("scan after migration = %v (%v)", pks, err)
+	}
+	if pks, _ := sm2.GetPkByIndex(context.Background(), dbName, tableName, "price", "100"); !reflect.DeepEqual(pks, []string{"d"}) {
+		t.Errorf("index lookup after migration = %v", pks)
+	}
+}
+
+func TestIndexRangeScan(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	dbName := "rangedb"
+	tableName := "prices"
+	sm.CreateDatabase(dbName)
+	sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":    {Name: "id", Type: TypeString, Indexed: true},
+			"price": {Name: "price", Type: TypeNumber, Indexed: true},
+		},
+	})
+
+	for id, price := range map[string]interface{}{"a": 10, "b": 9, "c": -3, "n": "n/a"} {
+		sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": id, "price": price}})
+	}
+	sm.Flush()
+	for id, price := range map[string]interface{}{"d": 100, "e": 9} {
+		sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": id, "price": price}})
+	}
+	sm.Delete(dbName, tableName, "a")
+
+	cases := []struct {
+		bounds []IndexBound
+		want   []string
+	}{
+		{[]IndexBound{{">", "9"}}, []string{"d"}},
+		{[]IndexBound{{">=", "9"}}, []string{"b", "e", "d"}},
+		{[]IndexBound{{"<", "9"}}, []string{"c"}},
+		{[]IndexBound{{">=", "-3"}, {"<=", "9"}}, []string{"c", "b", "e"}},
+		{[]IndexBound{{">", "0"}, {">", "50"}}, []string{"d"}},
+		{[]IndexBound{{">", "50"}, {"<", "10"}}, []string{}},
+	}
+	for _, c := range cases {
+		pks, err := sm.GetPksByIndexRange(context.Background(), dbName, tableName, "price", c.bounds)
+		if err != nil || !reflect.DeepEqual(pks, c.want) {
+			t.Errorf("range %v = %v (%v), want %v", c.bounds, pks, err, c.want)
+		}
+	}
+
+	row, _ := sm.Get(dbName, tableName, "d")
+	_, table, _ := sm.GetTableSchema(dbName, tableName)
+	if !matchRPNFilters(table, row.Data, []string{"price>=:9", "price<:1000", "and"}) {
+		t.Errorf("row %v should match the between filter", row.Data)
+	}
+	row, _ = sm.Get(dbName, tableName, "n")
+	if matchRPNFilters(table, row.Data, []string{"price>:0"}) {
+		t.Errorf("non-numeric value %v should not match a numeric range", row.Data)
+	}
+
+	// Scans and row reads stop once the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := sm.GetPksByIndexRange(ctx, dbName, tableName, "price", []IndexBound{{">", "0"}}); err != context.Canceled {
+		t.Errorf("range scan after cancel: got %v", err)
+	}
+	if _, err := sm.GetAllPks(ctx, dbName, tableName); err != context.Canceled {
+		t.Errorf("table scan after cancel: got %v", err)
+	}
+	if _, err := sm.GetDataByPKs(ctx, dbName, tableName, []string{"b"}); err != context.Canceled {
+		t.Errorf("row read after cancel: got %v", err)
+	}
+}
+
+func TestMatchRPNFiltersMembership(t *testing.T) {
+	table := &Table{Columns: map[string]*Column{
+		"status": {Name: "status", Type: TypeString},
+		"qty":    {Name: "qty", Type: TypeNumber},
+	}}
+	row := map[string]interface{}{"status": "trial", "qty": 3.0}
+
+	cases := []struct {
+		filters []string
+		want    bool
+	}{
+		{[]string{`status in:["active","trial"]`}, true},
+		{[]string{`status in:["active"]`}, false},
+		{[]string{`status in:["active"]`, "not"}, true},
+		{[]string{`qty in:["1","3"]`}, true},
+		{[]string{"status!=:trial"}, false},
+		{[]string{"qty!=:4", "status:trial", "and"}, true},
+		{[]string{"missing!=:x"}, true},
+		{[]string{"missing:x", "not"}, true},
+	}
+	for _, c := range cases {
+		if got := matchRPNFilters(table, row, c.filters); got != c.want {
+			t.Errorf("matchRPNFilters(%v) = %v, want %v", c.filters, got, c.want)
+		}
+	}
+}
@@ -42,6 +42,7 @@ For more details see: https://mariadb.com/bsl11/
 package storemanager
 
 import (
+	"fmt"
 	"onql/config"
 	"onql/logger"
 	"time"
@@ -49,8 +50,14 @@ import (
 
 // New creates a new StoreManager instance.
 // It initializes the schema, buffer, and starts the background flush routine.
-// It also loads the existing schema and protocols from the engine.
-func New(eng Engine, cfg *config.Config) *StoreManager {
+// If a WAL directory is configured, unflushed writes from a previous run are
+// replayed and persisted first. It then loads the existing schema, protocols and users from the engine
+// and upgrades index keys written by older versions. Index builds interrupted by
+// a shutdown are resumed in the background, as is the purge of dropped tables
+// and databases. With the change log enabled, old change records are trimmed
+// in the background too. It fails if the WAL cannot be opened, replayed or
+// persisted, since writes would then not survive a crash.
+func New(eng Engine, cfg *config.Config) (*StoreManager, error) {
 	if cfg.FlushInterval <= 0 {
 		cfg.FlushInterval = 500 * time.Millisecond
 	}
@@ -58,12 +65,45 @@ func New(eng Engine, cfg *config.Config) *StoreManager {
 	sm := &StoreManager{
 		engine: eng,
 		schema: &Schema{
-			Databases: make(map[string]*Database),
-			Protocols: make(map[string]*QueryProtocol), // Initialize protocol cache
+			Databases:      make(map[string]*Database),
+			Protocols:      make(map[string]*ProtocolRecord), // Initialize protocol cache
+			ProtocolLookup: make(map[string]*ProtocolRecord),
 		},
-		buffer: NewBuffer(),
-		config: cfg,
-		done:   make(chan struct{}),
+		buffer:    NewBuffer(),
+		config:    cfg,
+		done:      make(chan struct{}),
+		purgeWake: make(chan struct{}, 1),
+		users:     make(map[string]*User),
+		roles:     make(map[string]*Role),
+		protoPass: make(map[[32]byte]protoPassEntry),
+	}
+
+	// Replay the write-ahead log left behind by an unclean shutdown
+	// and persist it before anything reads from the engine.
+	if cfg.WALDir != "" {
+		wal, err := OpenWAL(cfg.WALDir, SyncMode(cfg.WALSyncMode), cfg.WALSyncInterval)
+		if err != nil {
+			return nil, fmt.Errorf("open WAL: %w", err)
+		}
+		frames, err := wal.Replay(func(ops []BufferOp) {
+			sm.buffer.applyLocked(ops)
+		})
+		if err != nil {
+			wal.Close()
+			return nil, fmt.Errorf("replay WAL: %w", err)
+		}
+		if frames > 0 {
+			logger.Info("Replayed %d WAL frames", frames)
+		}
+		sm.buffer.wal = wal
+		if err := sm.Flush(); err != nil {
+			wal.Close()
+			return nil, fmt.Errorf("flush replayed WAL: %w", err)
+		}
+		// Old segments are only dropped once everything in them is on disk.
+		if err := wal.TruncateReplayed(); err != nil {
+			logger.Error("WAL truncate failed: %v", err)
+		}
 	}
 
 	// Load schema and protocols from disk
@@ -73,19 +113,43 @@ func New(eng Engine, cfg *config.Config) *StoreManager {
 	if err := sm.LoadProtocols(); err != nil {
 		logger.Error("Failed to load protocols: %v", err)
 	}
+	if err := sm.LoadUsers(); err != nil {
+		logger.Error("Failed to load users: %v", err)
+	}
+	if err := sm.migrateIndexKeys(); err != nil {
+		logger.Error("Failed to migrate index keys: %v", err)
+	}
+	if err := sm.loadChangeSeq(); err != nil {
+		logger.Error("Failed to load change log position: %v", err)
+	}
 
 	// Start background flush
 	sm.wg.Add(1)
 	go sm.autoFlush()
+	sm.resumeIndexBuilds()
+
+	// Delete the keys of dropped tables and databases
+	sm.wg.Add(1)
+	go sm.purgeLoop()
 
-	return sm
+	if cfg.ChangeLog {
+		sm.wg.Add(1)
+		go sm.changeTrimLoop()
+	}
+
+	return sm, nil
 }
 
 // Close gracefully shuts down the StoreManager.
-// It stops the background flusher and waits for any pending operations to complete.
+// It stops the background flusher, waits for the final flush and closes the WAL.
 func (sm *StoreManager) Close() {
 	close(sm.done)
 	sm.wg.Wait()
+	if sm.buffer.wal != nil {
+		if err := sm.buffer.wal.Close(); err != nil {
+			logger.Error("Failed to close WAL: %v", err)
+		}
+	}
 }
 
 // GetEngine returns the underlying storage engine.
@@ -0,0 +1,289 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"bytes"
+	"fmt"
+	"onql/common"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Txn stages inserts, updates and deletes in a private overlay on top of the
+// write buffer and applies them all-or-nothing on Commit.
+//
+// Concurrency control is optimistic: the committed value of every key the
+// transaction reads is remembered, and Commit fails with common.ErrConflict if
+// any of them changed in the meantime. Every write reads its DataKey first, so
+// two writers touching the same row cannot both commit.
+type Txn struct {
+	sm      *StoreManager
+	mu      sync.Mutex
+	writes  map[string]BufferEntry // staged changes, newest wins
+	reads   map[string]txnRead     // committed state observed per key
+	tables  map[txnTable]string    // table layout at first use, see tableLayout
+	changes []*Change              // change log records in staging order
+	closed  bool
+}
+
+// txnRead is the committed state of a key as first observed by a transaction.
+type txnRead struct {
+	value  []byte
+	exists bool
+}
+
+// txnTable names a table touched by a transaction.
+type txnTable struct {
+	db, table string
+}
+
+// tableLayout identifies everything staged keys of a table depend on: the
+// table ID, the type of every column (index encoding), which columns keep an
+// index and the composite indexes.
+func tableLayout(table *Table) string {
+	parts := make([]string, 0, len(table.Columns)+len(table.Indexes))
+	for _, col := range table.Columns {
+		part := col.ID + "=" + string(col.Type)
+		if col.maintainsIndex() {
+			part += "+idx"
+		}
+		parts = append(parts, part)
+	}
+	for _, idx := range table.Indexes {
+		parts = append(parts, idx.ID)
+	}
+	sort.Strings(parts)
+	return table.ID + ":" + strings.Join(parts, ",")
+}
+
+// Begin starts a new transaction.
+func (sm *StoreManager) Begin() *Txn {
+	return &Txn{
+		sm:     sm,
+		writes: make(map[string]BufferEntry),
+		reads:  make(map[string]txnRead),
+		tables: make(map[txnTable]string),
+	}
+}
+
+// Insert stages a new row. Duplicate checks see the transaction's own writes.
+func (tx *Txn) Insert(dbName, tableName string, row Row) error {
+	return tx.stage(dbName, tableName, func() ([]BufferOp, *Change, error) {
+		return tx.sm.insertOps(tx.read, dbName, tableName, row)
+	})
+}
+
+// Update stages a replacement of the row at pk.
+func (tx *Txn) Update(dbName, tableName, pk string, newRow Row) error {
+	return tx.stage(dbName, tableName, func() ([]BufferOp, *Change, error) {
+		return tx.sm.updateOps(tx.read, dbName, tableName, pk, newRow)
+	})
+}
+
+// Delete stages the removal of the row at pk.
+func (tx *Txn) Delete(dbName, tableName, pk string) error {
+	return tx.stage(dbName, tableName, func() ([]BufferOp, *Change, error) {
+		return tx.sm.deleteOps(tx.read, dbName, tableName, pk)
+	})
+}
+
+// Get reads a row as the transaction sees it, including its own staged writes.
+func (tx *Txn) Get(dbName, tableName, pk string) (*Row, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.closed {
+		return nil, common.ErrTxnClosed
+	}
+
+	tx.sm.migrationLock.RLock()
+	defer tx.sm.migrationLock.RUnlock()
+
+	return tx.sm.getRow(tx.read, dbName, tableName, pk)
+}
+
+// stage builds operations with build and merges them into the overlay.
+func (tx *Txn) stage(dbName, tableName string, build func() ([]BufferOp, *Change, error)) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.closed {
+		return common.ErrTxnClosed
+	}
+
+	tx.sm.migrationLock.RLock()
+	defer tx.sm.migrationLock.RUnlock()
+
+	_, table, err := tx.sm.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return err
+	}
+	name := txnTable{dbName, tableName}
+	if layout, ok := tx.tables[name]; !ok {
+		tx.tables[name] = tableLayout(table)
+	} else if layout != tableLayout(table) {
+		return fmt.Errorf("%w: table %s.%s changed during transaction", common.ErrConflict, dbName, tableName)
+	}
+
+	ops, change, err := build()
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		tx.writes[op.Key] = BufferEntry{Value: op.Value, IsDeleted: op.IsDeleted}
+	}
+	if change != nil {
+		tx.changes = append(tx.changes, change)
+	}
+	return nil
+}
+
+// read is the transaction's keyReader: staged writes first, then committed state.
+// The first committed value seen for a key is kept and returned on later reads.
+// Caller must hold tx.mu.
+func (tx *Txn) read(key string) ([]byte, error) {
+	if entry, ok := tx.writes[key]; ok {
+		if entry.IsDeleted {
+			return nil, common.ErrNotFound
+		}
+		return entry.Value, nil
+	}
+
+	if seen, ok := tx.reads[key]; ok {
+		if !seen.exists {
+			return nil, common.ErrNotFound
+		}
+		return seen.value, nil
+	}
+
+	val, err := tx.sm.readKey(key)
+	if err != nil && err != common.ErrNotFound {
+		return nil, err
+	}
+	tx.reads[key] = txnRead{value: val, exists: err == nil}
+	return val, err
+}
+
+// Commit validates the transaction against concurrent writers and applies all
+// staged writes to the buffer as a single WAL batch. On common.ErrConflict
+// nothing is applied and the transaction is closed; the caller may retry.
+func (tx *Txn) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.closed {
+		return common.ErrTxnClosed
+	}
+	tx.closed = true
+
+	if len(tx.writes) == 0 {
+		return nil
+	}
+
+	sm := tx.sm
+	sm.migrationLock.RLock()
+	defer sm.migrationLock.RUnlock()
+
+	// A rename, drop or index change since staging would leave the overlay
+	// pointing at stale keys.
+	for name, layout := range tx.tables {
+		if _, table, err := sm.GetTableSchema(name.db, name.table); err != nil || tableLayout(table) != layout {
+			return fmt.Errorf("%w: table %s.%s changed during transaction", common.ErrConflict, name.db, name.table)
+		}
+	}
+
+	ops := make([]BufferOp, 0, len(tx.writes))
+	for key, entry := range tx.writes {
+		ops = append(ops, BufferOp{Key: key, Value: entry.Value, IsDeleted: entry.IsDeleted})
+	}
+	unique := sm.uniqueCheck(ops)
+	stamp, err := sm.changeStamp(tx.changes)
+	if err != nil {
+		return err
+	}
+
+	// Holding flushMutex keeps a concurrent flush from moving values out of
+	// the buffer while they are not yet visible in the engine.
+	sm.flushMutex.Lock()
+	err = sm.buffer.ApplyStamped(ops, func(view BufferView) error {
+		for key, seen := range tx.reads {
+			val, exists, isDeleted := view.Get(key)
+			if !exists {
+				var err error
+				val, err = sm.engine.Get([]byte(key))
+				if err != nil && err != common.ErrNotFound {
+					return err
+				}
+				exists = err == nil
+			} else if isDeleted {
+				exists = false
+			}
+			if exists != seen.exists || !bytes.Equal(val, seen.value) {
+				return common.ErrConflict
+			}
+		}
+		if unique != nil {
+			return unique(view)
+		}
+		return nil
+	}, stamp)
+	sm.flushMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sm.notifyChanges(tx.changes)
+	return nil
+}
+
+// Rollback discards all staged writes. It is safe to call on a closed transaction.
+func (tx *Txn) Rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.closed = true
+	tx.writes = nil
+	tx.reads = nil
+	tx.changes = nil
+}
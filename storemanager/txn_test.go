@@ -0,0 +1,75 @@
+package storemanager
+
+import (
+	"context"
+	"errors"
+	"onql/common"
+	"onql/config"
+	"testing"
+	"time"
+)
+
+func TestTxnCommitAndConflict(t *testing.T) {
+	engine := NewMockEngine()
+	cfg := &config.Config{FlushInterval: 100 * time.Millisecond}
+	sm := newTestStore(t, engine, cfg)
+	defer sm.Close()
+
+	dbName := "txndb"
+	tableName := "stock"
+	sm.CreateDatabase(dbName)
+	sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":  {Name: "id", Type: TypeString},
+			"qty": {Name: "qty", Type: TypeNumber, Indexed: true},
+		},
+	})
+	sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "p1", "qty": 5}})
+
+	// Staged writes are invisible until commit and visible to the transaction itself.
+	tx := sm.Begin()
+	if err := tx.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "p2", "qty": 1}}); err != nil {
+		t.Fatalf("tx insert failed: %v", err)
+	}
+	if err := tx.Update(dbName, tableName, "p1", Row{Data: map[string]interface{}{"id": "p1", "qty": 4}}); err != nil {
+		t.Fatalf("tx update failed: %v", err)
+	}
+	if _, err := sm.Get(dbName, tableName, "p2"); err != common.ErrNotFound {
+		t.Errorf("uncommitted insert is visible: %v", err)
+	}
+	if row, err := tx.Get(dbName, tableName, "p1"); err != nil || row.Data["qty"] != float64(4) {
+		t.Errorf("transaction does not see its own update: %v (%v)", row, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if _, err := sm.Get(dbName, tableName, "p2"); err != nil {
+		t.Errorf("committed insert not visible: %v", err)
+	}
+	if pks, _ := sm.GetPkByIndex(context.Background(), dbName, tableName, "qty", "4"); len(pks) != 1 || pks[0] != "p1" {
+		t.Errorf("committed index not visible: %v", pks)
+	}
+
+	// A concurrent write to a row the transaction touched makes the commit fail.
+	tx = sm.Begin()
+	if err := tx.Delete(dbName, tableName, "p1"); err != nil {
+		t.Fatalf("tx delete failed: %v", err)
+	}
+	if err := tx.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "p3", "qty": 9}}); err != nil {
+		t.Fatalf("tx insert failed: %v", err)
+	}
+	if err := sm.Update(dbName, tableName, "p1", Row{Data: map[string]interface{}{"id": "p1", "qty": 3}}); err != nil {
+		t.Fatalf("concurrent update failed: %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, common.ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if _, err := sm.Get(dbName, tableName, "p3"); err != common.ErrNotFound {
+		t.Errorf("conflicting transaction was partially applied: %v", err)
+	}
+	if err := tx.Commit(); err != common.ErrTxnClosed {
+		t.Errorf("expected closed transaction, got %v", err)
+	}
+}
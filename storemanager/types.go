@@ -42,8 +42,11 @@ For more details see: https://mariadb.com/bsl11/
 package storemanager
 
 import (
+	"encoding/json"
+	"io"
 	"onql/config"
 	"sync"
+	"sync/atomic"
 )
 
 // DataType represents the type of a column in the database.
@@ -61,8 +64,10 @@ const (
 // It holds in-memory representations of all databases and their tables.
 type Schema struct {
 	Databases map[string]*Database
-	Protocols map[string]*QueryProtocol // In-memory protocol cache
-	Mu        sync.RWMutex
+	Protocols map[string]*ProtocolRecord // In-memory protocol cache, by name
+	// ProtocolLookup holds the protocols of Protocols by SecretLookup.
+	ProtocolLookup map[string]*ProtocolRecord
+	Mu             sync.RWMutex
 }
 
 // Database represents a logical grouping of tables.
@@ -79,7 +84,17 @@ type Table struct {
 	ID      string
 	Name    string
 	Columns map[string]*Column
-	PK      string // Primary Key column name
+	PK      string            // Primary Key column name
+	Indexes map[string]*Index // Composite indexes by name
+}
+
+// Index is a composite index over an ordered list of columns.
+// Entries are keyed by the tuple of column values, so equality on a leading
+// prefix of the columns plus a range or sort on the next one is a single scan.
+type Index struct {
+	ID      string
+	Name    string
+	Columns []string // Column names in key order
 }
 
 // Column represents a single field in a table.
@@ -91,21 +106,65 @@ type Column struct {
 	Formatter    string // e.g., "trim|decimal:2"
 	Validator    string // e.g., "required|min:5"
 	DefaultValue interface{}
-	Indexed      bool
+	Indexed      bool // single-column index entries are complete and used by queries
+	Unique       bool // no two rows may hold the same non-null value
+
+	// IndexBuilding is set while a background build backfills the index.
+	// Writes already maintain the entries but queries do not use them yet.
+	IndexBuilding bool `json:",omitempty"`
 
 	// Parsed rules (internal use)
 	FormatterRules []string `json:"-"`
 	ValidatorRules []string `json:"-"`
 }
 
+// UnmarshalJSON decodes a column definition. Columns are indexed unless the
+// definition says otherwise.
+func (c *Column) UnmarshalJSON(data []byte) error {
+	type plain Column
+	col := plain{Indexed: true}
+	if err := json.Unmarshal(data, &col); err != nil {
+		return err
+	}
+	*c = Column(col)
+	return nil
+}
+
+// maintainsIndex reports whether writes must keep the column's index entries up to date.
+func (c *Column) maintainsIndex() bool {
+	return c.Indexed || c.IndexBuilding
+}
+
 // Row represents a single record in a table.
 // It stores data as a map of column names to values.
+// Version counts the writes of the row: 1 when inserted, raised by every
+// update. Rows written before versions were kept read as version 0.
 type Row struct {
-	Data map[string]interface{}
+	Data    map[string]interface{}
+	Version uint64
 }
 
+// VersionField is the field that carries a row's version in read results.
+const VersionField = "_version"
+
 // ===== Protocol Types =====
 
+// DefaultProtocol names the protocol generated from the schema. Its protopass
+// is "default" until rotated.
+const DefaultProtocol = "default"
+
+// ProtocolRecord is a stored protocol. Clients select it by presenting the
+// protopass whose hash is SecretHash.
+type ProtocolRecord struct {
+	Name       string
+	SecretHash string
+	// SecretLookup is an HMAC of the protopass under the server's protocol
+	// key. It finds the record without hashing the protopass against every
+	// protocol; records saved before it existed have none.
+	SecretLookup string `json:",omitempty"`
+	Protocol     QueryProtocol
+}
+
 // QueryProtocol defines the mapping between database aliases and entities.
 // It is a map of database names to ProtocolModules.
 type QueryProtocol map[string]*ProtocolModule
@@ -144,10 +203,30 @@ type StoreManager struct {
 	schema        *Schema
 	buffer        *Buffer
 	flushMutex    sync.Mutex
-	migrationLock sync.RWMutex // Prevents data operations during schema migrations
+	flushGen      atomic.Uint64 // counts flushes that wrote to the engine
+	migrationLock sync.RWMutex  // Prevents data operations during schema migrations
 	config        *config.Config
 	done          chan struct{}
 	wg            sync.WaitGroup
+
+	indexJobsMu sync.Mutex
+	indexJobs   map[string]bool // column IDs with a background index build or drop running
+
+	purgeWake chan struct{} // signals the purger that a table or database was dropped
+
+	changeSeq uint64 // last change log sequence number, guarded by buffer.mu
+
+	listenerMu sync.RWMutex
+	listener   func(changes []Change) // called after every committed write
+
+	authMu sync.RWMutex
+	users  map[string]*User
+	roles  map[string]*Role
+
+	protoKey    []byte     // HMAC key of ProtocolRecord.SecretLookup, guarded by schema.Mu
+	protoScanMu sync.Mutex // serialises hashing against records without a SecretLookup
+	protoPassMu sync.Mutex
+	protoPass   map[[32]byte]protoPassEntry // verified and rejected protopasses by SHA-256
 }
 
 // Engine interface abstracts the underlying key-value storage.
@@ -157,6 +236,11 @@ type Engine interface {
 	Get(key []byte) ([]byte, error)
 	Delete(key []byte) error
 	BatchSet(keys, values [][]byte) error
+	BatchDelete(keys [][]byte) error
 	IteratePrefix(prefix []byte, fn func(k, v []byte) error) error
 	IteratePrefixWithLimit(prefix []byte, offset, limit int, reverse bool, fn func(k, v []byte) error) error
+	IterateRange(start, end []byte, reverse bool, fn func(k, v []byte) error) error
+	CollectGarbage() error
+	Backup(w io.Writer, snapshotTaken func()) error
+	Restore(r io.Reader) error
 }
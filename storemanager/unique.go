@@ -0,0 +1,219 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"fmt"
+	"onql/common"
+	"strings"
+)
+
+// uniqueClaim is an index entry written for a unique column: no other row may
+// hold an entry under the same value prefix.
+type uniqueClaim struct {
+	prefix string // IDX:<dbID>:<tableID>:<colID>:<value>:
+	pk     string
+	table  string
+	column string
+}
+
+// uniqueCheck returns an ApplyIf check that fails with common.ErrDuplicate if
+// ops would give a unique column a value that another row already holds, or
+// nil if ops write no unique values. Null values are never considered equal.
+// The check must run with flushMutex held. The engine is read here, before the
+// caller takes the locks, and read again by the check only if a flush wrote to
+// it in between.
+func (sm *StoreManager) uniqueCheck(ops []BufferOp) func(view BufferView) error {
+	var claims []uniqueClaim
+	batch := make(map[string]BufferOp, len(ops))
+	for _, op := range ops {
+		batch[op.Key] = op
+	}
+
+	sm.schema.Mu.RLock()
+	for _, op := range ops {
+		if op.IsDeleted || !strings.HasPrefix(op.Key, "IDX:") {
+			continue
+		}
+		dbID, tableID, colID, val, pk := ParseIndexKey([]byte(op.Key))
+		if val == "" || val[0] == indexTagNull {
+			continue
+		}
+		table := sm.tableByID(dbID, tableID)
+		if table == nil {
+			continue
+		}
+		for _, col := range table.Columns {
+			if col.ID == colID && col.Unique {
+				claims = append(claims, uniqueClaim{
+					prefix: string(IndexKey(dbID, tableID, colID, val, "")),
+					pk:     pk,
+					table:  table.Name,
+					column: col.Name,
+				})
+				break
+			}
+		}
+	}
+	sm.schema.Mu.RUnlock()
+
+	if len(claims) == 0 {
+		return nil
+	}
+
+	gen := sm.flushGen.Load()
+	stored, err := sm.claimedInEngine(claims)
+
+	return func(view BufferView) error {
+		if err != nil || sm.flushGen.Load() != gen {
+			if stored, err = sm.claimedInEngine(claims); err != nil {
+				return err
+			}
+		}
+		for i, c := range claims {
+			conflict := ""
+			seen := make(map[string]bool)
+			owner := func(key, pk string, deleted bool) {
+				if seen[key] {
+					return
+				}
+				seen[key] = true
+				if !deleted && pk != c.pk && conflict == "" {
+					conflict = pk
+				}
+			}
+
+			// Newest state first: the batch itself, then the buffer, then the engine
+			end := c.prefix[:len(c.prefix)-1] + ";"
+			for key, op := range batch {
+				if key >= c.prefix && key < end {
+					owner(key, string(op.Value), op.IsDeleted)
+				}
+			}
+			view.Range(c.prefix, end, func(key string, entry BufferEntry) {
+				owner(key, string(entry.Value), entry.IsDeleted)
+			})
+			for key, pk := range stored[i] {
+				owner(key, pk, false)
+			}
+
+			if conflict != "" {
+				return fmt.Errorf("%w: %s.%s already has this value in row %s", common.ErrDuplicate, c.table, c.column, conflict)
+			}
+		}
+		return nil
+	}
+}
+
+// claimedInEngine returns the index entries under the prefix of every claim
+// in the engine, as the primary key by index key.
+func (sm *StoreManager) claimedInEngine(claims []uniqueClaim) ([]map[string]string, error) {
+	stored := make([]map[string]string, len(claims))
+	for i, c := range claims {
+		stored[i] = make(map[string]string)
+		err := sm.engine.IteratePrefix([]byte(c.prefix), func(k, v []byte) error {
+			stored[i][string(k)] = string(v)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// tableByID finds a table by its IDs. Caller must hold schema.Mu.
+func (sm *StoreManager) tableByID(dbID, tableID string) *Table {
+	for _, db := range sm.schema.Databases {
+		if db.ID != dbID {
+			continue
+		}
+		for _, table := range db.Tables {
+			if table.ID == tableID {
+				return table
+			}
+		}
+	}
+	return nil
+}
+
+// applyWrite applies the operations of a single write, enforcing unique columns
+// and recording changes in the change log.
+func (sm *StoreManager) applyWrite(ops []BufferOp, changes ...*Change) error {
+	stamp, err := sm.changeStamp(changes)
+	if err != nil {
+		return err
+	}
+	check := sm.uniqueCheck(ops)
+	if check == nil {
+		err = sm.buffer.ApplyStamped(ops, nil, stamp)
+	} else {
+		// Same as Txn.Commit: no flush may move entries between the buffer and the
+		// engine while the check looks at both.
+		sm.flushMutex.Lock()
+		err = sm.buffer.ApplyStamped(ops, check, stamp)
+		sm.flushMutex.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	sm.notifyChanges(changes)
+	return nil
+}
+
+// checkUniqueValues reports an error if two rows already share a value of col.
+// The caller must flush first and block concurrent writes.
+func (sm *StoreManager) checkUniqueValues(dbID string, table *Table, col *Column) error {
+	var prevVal, prevPK string
+	err := sm.engine.IteratePrefix(IndexPrefix(dbID, table.ID, col.ID), func(k, v []byte) error {
+		_, _, _, val, pk := ParseIndexKey(k)
+		if val == "" || val[0] == indexTagNull {
+			return nil
+		}
+		if val == prevVal {
+			return fmt.Errorf("%w: %s.%s has the same value in rows %s and %s", common.ErrDuplicate, table.Name, col.Name, prevPK, pk)
+		}
+		prevVal, prevPK = val, pk
+		return nil
+	})
+	return err
+}
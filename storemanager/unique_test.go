@@ -0,0 +1,120 @@
+package storemanager
+
+import (
+	"errors"
+	"onql/common"
+	"onql/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUniqueColumn(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	dbName := "uniqdb"
+	tableName := "users"
+	sm.CreateDatabase(dbName)
+	err := sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":    {Name: "id", Type: TypeString, Indexed: true},
+			"email": {Name: "email", Type: TypeString, Indexed: true, Unique: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	insert := func(id string, email interface{}) error {
+		return sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": id, "email": email}})
+	}
+
+	if err := insert("u1", "a@x"); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	sm.Flush()
+
+	// Conflicts are found on disk and in the buffer
+	err = insert("u2", "a@x")
+	if !errors.Is(err, common.ErrDuplicate) || !strings.Contains(err.Error(), "email") || !strings.Contains(err.Error(), "u1") {
+		t.Errorf("duplicate insert: got %v", err)
+	}
+	if err := insert("u2", "b@x"); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if err := sm.Update(dbName, tableName, "u1", Row{Data: map[string]interface{}{"id": "u1", "email": "b@x"}}); !errors.Is(err, common.ErrDuplicate) {
+		t.Errorf("update to a taken value: got %v", err)
+	}
+	if err := sm.Update(dbName, tableName, "u1", Row{Data: map[string]interface{}{"id": "u1", "email": "a@x"}}); err != nil {
+		t.Errorf("update keeping its own value: %v", err)
+	}
+
+	// A deleted row frees its value; nulls never conflict
+	sm.Delete(dbName, tableName, "u1")
+	if err := insert("u3", "a@x"); err != nil {
+		t.Errorf("insert after delete: %v", err)
+	}
+	if err := insert("u4", nil); err != nil {
+		t.Errorf("first null: %v", err)
+	}
+	if err := insert("u5", nil); err != nil {
+		t.Errorf("second null: %v", err)
+	}
+
+	// Two rows of one transaction may not share a value either
+	tx := sm.Begin()
+	tx.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "u6", "email": "c@x"}})
+	tx.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "u7", "email": "c@x"}})
+	if err := tx.Commit(); !errors.Is(err, common.ErrDuplicate) {
+		t.Errorf("duplicate within a transaction: got %v", err)
+	}
+	if _, err := sm.Get(dbName, tableName, "u6"); err == nil {
+		t.Errorf("rejected transaction was applied")
+	}
+
+	// Existing duplicates prevent adding the constraint
+	sm.AlterTable(dbName, tableName, map[string]interface{}{"addColumn": map[string]interface{}{"name": "team", "type": "string"}})
+	sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "u8", "team": "red"}})
+	sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "u9", "team": "red"}})
+	err = sm.AlterTable(dbName, tableName, map[string]interface{}{"modifyColumn": map[string]interface{}{"name": "team", "unique": true}})
+	if !errors.Is(err, common.ErrDuplicate) {
+		t.Errorf("making a column with duplicates unique: got %v", err)
+	}
+}
+
+func TestUniqueCheckAfterFlush(t *testing.T) {
+	sm := newTestStore(t, NewMockEngine(), &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+	sm.CreateDatabase("uniqdb")
+	sm.CreateTable("uniqdb", Table{
+		Name: "users",
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":    {Name: "id", Type: TypeString, Indexed: true},
+			"email": {Name: "email", Type: TypeString, Indexed: true, Unique: true},
+		},
+	})
+
+	ops, _, err := sm.insertOps(sm.readKey, "uniqdb", "users", Row{Data: map[string]interface{}{"id": "u1", "email": "a@x"}})
+	if err != nil {
+		t.Fatalf("insertOps failed: %v", err)
+	}
+	check := sm.uniqueCheck(ops)
+
+	// Another row takes the value and is flushed after the engine was read
+	if err := sm.Insert("uniqdb", "users", Row{Data: map[string]interface{}{"id": "u2", "email": "a@x"}}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	sm.Flush()
+
+	sm.flushMutex.Lock()
+	err = sm.buffer.ApplyIf(ops, check)
+	sm.flushMutex.Unlock()
+	if !errors.Is(err, common.ErrDuplicate) {
+		t.Errorf("value flushed after the check was built: got %v", err)
+	}
+}
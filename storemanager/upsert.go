@@ -0,0 +1,157 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"errors"
+	"fmt"
+	"onql/common"
+)
+
+// ConflictAction says what an insert does when a row with the same primary key
+// already exists.
+type ConflictAction string
+
+const (
+	ConflictError   ConflictAction = "error"   // fail with common.ErrDuplicate
+	ConflictIgnore  ConflictAction = "ignore"  // keep the existing row
+	ConflictReplace ConflictAction = "replace" // replace the existing row
+	ConflictMerge   ConflictAction = "merge"   // copy the new values onto the existing row
+)
+
+// upsertAttempts bounds how often Upsert retries after a concurrent write to its row.
+const upsertAttempts = 10
+
+// ParseConflictAction validates an on_conflict value; empty means ConflictError.
+func ParseConflictAction(s string) (ConflictAction, error) {
+	switch a := ConflictAction(s); a {
+	case "":
+		return ConflictError, nil
+	case ConflictError, ConflictIgnore, ConflictReplace, ConflictMerge:
+		return a, nil
+	default:
+		return "", fmt.Errorf("%w: unknown conflict action %q", common.ErrInvalidInput, s)
+	}
+}
+
+// Upsert inserts row, or resolves a conflict with the row holding its primary
+// key as onConflict says. defaults names the columns of row that were filled
+// in from column defaults; a merge leaves their existing values alone.
+// The row is read and written as one transaction, retried if another writer
+// changes it in between. It returns the operation performed, ChangeInsert or
+// ChangeUpdate, or "" if the existing row was kept.
+func (sm *StoreManager) Upsert(dbName, tableName string, row Row, onConflict ConflictAction, defaults []string) (string, error) {
+	var err error
+	for attempt := 0; attempt < upsertAttempts; attempt++ {
+		tx := sm.Begin()
+		var op string
+		op, err = tx.Upsert(dbName, tableName, row, onConflict, defaults)
+		if err != nil {
+			tx.Rollback()
+			return "", err
+		}
+		if err = tx.Commit(); !errors.Is(err, common.ErrConflict) {
+			if err != nil {
+				return "", err
+			}
+			return op, nil
+		}
+	}
+	return "", err
+}
+
+// Upsert stages an insert of row, or the resolution of a conflict with the row
+// holding its primary key; see StoreManager.Upsert.
+func (tx *Txn) Upsert(dbName, tableName string, row Row, onConflict ConflictAction, defaults []string) (string, error) {
+	var op string
+	err := tx.stage(dbName, tableName, func() ([]BufferOp, *Change, error) {
+		ops, change, err := tx.sm.upsertOps(tx.read, dbName, tableName, row, onConflict, defaults)
+		if change != nil {
+			op = change.Op
+		}
+		return ops, change, err
+	})
+	return op, err
+}
+
+// upsertOps builds the buffer operations of an upsert and the record of the
+// change, which is nil if the existing row is kept.
+func (sm *StoreManager) upsertOps(read keyReader, dbName, tableName string, row Row, onConflict ConflictAction, defaults []string) ([]BufferOp, *Change, error) {
+	_, table, err := sm.GetTableSchema(dbName, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkVal, ok := row.Data[table.PK]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: primary key %s missing", common.ErrInvalidInput, table.PK)
+	}
+	pk := fmt.Sprintf("%v", pkVal)
+
+	oldRow, err := sm.getRow(read, dbName, tableName, pk)
+	if err == common.ErrNotFound {
+		return sm.insertOps(read, dbName, tableName, row)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch onConflict {
+	case ConflictIgnore:
+		return nil, nil, nil
+	case ConflictReplace:
+		return sm.updateOps(read, dbName, tableName, pk, row)
+	case ConflictMerge:
+		keep := make(map[string]bool, len(defaults))
+		for _, col := range defaults {
+			keep[col] = true
+		}
+		merged := oldRow.Data
+		for k, v := range row.Data {
+			if !keep[k] {
+				merged[k] = v
+			}
+		}
+		return sm.updateOps(read, dbName, tableName, pk, Row{Data: merged})
+	default:
+		return nil, nil, common.ErrDuplicate
+	}
+}
@@ -0,0 +1,99 @@
+package storemanager
+
+import (
+	"context"
+	"errors"
+	"onql/common"
+	"onql/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpsert(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	dbName := "upsertdb"
+	tableName := "items"
+	sm.CreateDatabase(dbName)
+	err := sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":    {Name: "id", Type: TypeString},
+			"name":  {Name: "name", Type: TypeString, Indexed: true},
+			"count": {Name: "count", Type: TypeNumber},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	get := func() map[string]interface{} {
+		row, err := sm.Get(dbName, tableName, "a")
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		return row.Data
+	}
+
+	op, err := sm.Upsert(dbName, tableName, Row{Data: map[string]interface{}{"id": "a", "name": "x", "count": 1.0}}, ConflictMerge, nil)
+	if err != nil || op != ChangeInsert {
+		t.Fatalf("upsert of a new row: got %q, %v", op, err)
+	}
+
+	if _, err := sm.Upsert(dbName, tableName, Row{Data: map[string]interface{}{"id": "a"}}, ConflictError, nil); !errors.Is(err, common.ErrDuplicate) {
+		t.Errorf("error on conflict: got %v", err)
+	}
+
+	op, err = sm.Upsert(dbName, tableName, Row{Data: map[string]interface{}{"id": "a", "name": "y"}}, ConflictIgnore, nil)
+	if err != nil || op != "" || get()["name"] != "x" {
+		t.Errorf("ignore on conflict: got %q, %v, %v", op, err, get())
+	}
+
+	// Merge keeps columns the row leaves out or only has defaults for
+	op, err = sm.Upsert(dbName, tableName, Row{Data: map[string]interface{}{"id": "a", "name": "y", "count": 0.0}}, ConflictMerge, []string{"count"})
+	if err != nil || op != ChangeUpdate || get()["name"] != "y" || get()["count"] != 1.0 {
+		t.Errorf("merge on conflict: got %q, %v, %v", op, err, get())
+	}
+	if pks, _ := sm.GetPkByIndex(context.Background(), dbName, tableName, "name", "x"); len(pks) != 0 {
+		t.Errorf("merge left the old index entry: %v", pks)
+	}
+
+	op, err = sm.Upsert(dbName, tableName, Row{Data: map[string]interface{}{"id": "a", "name": "z"}}, ConflictReplace, nil)
+	if err != nil || op != ChangeUpdate {
+		t.Fatalf("replace on conflict: got %q, %v", op, err)
+	}
+	if data := get(); data["name"] != "z" || data["count"] != nil {
+		t.Errorf("replace kept old columns: %v", data)
+	}
+
+	if _, err := ParseConflictAction("overwrite"); !errors.Is(err, common.ErrInvalidInput) {
+		t.Errorf("unknown action: got %v", err)
+	}
+
+	// Concurrent inserts of one key: exactly one inserts, the rest update
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ops := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			op, err := sm.Upsert(dbName, tableName, Row{Data: map[string]interface{}{"id": "b", "name": "n"}}, ConflictMerge, nil)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				ops[err.Error()]++
+				return
+			}
+			ops[op]++
+		}()
+	}
+	wg.Wait()
+	if ops[ChangeInsert] != 1 || ops[ChangeUpdate] != 7 {
+		t.Errorf("concurrent upserts: got %v", ops)
+	}
+}
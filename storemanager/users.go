@@ -0,0 +1,422 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"onql/common"
+	"sort"
+	"strings"
+)
+
+// Permissions granted by roles. Read, write and schema are granted per
+// database; protocol and admin only count when granted on "*".
+const (
+	PermRead     = "read"     // queries, change feed and subscriptions
+	PermWrite    = "write"    // inserts, updates, deletes and transactions
+	PermSchema   = "schema"   // creating, altering and dropping databases and tables
+	PermProtocol = "protocol" // managing protocols
+	PermAdmin    = "admin"    // everything, including users, roles and backups
+)
+
+// AdminRole is built in and grants admin on every database.
+const AdminRole = "admin"
+
+// User is an account that can authenticate a connection.
+type User struct {
+	Name         string
+	PasswordHash string `json:",omitempty"`
+	Subject      string `json:",omitempty"` // TLS client certificate subject that logs in as this user
+	Roles        []string
+}
+
+// Role grants permissions per database; the database "*" matches all of them.
+type Role struct {
+	Name   string
+	Grants map[string][]string
+}
+
+// builtinAdmin is the AdminRole, which is not stored.
+var builtinAdmin = &Role{Name: AdminRole, Grants: map[string][]string{"*": {PermAdmin}}}
+
+// allows reports whether the role grants perm on dbName. An empty dbName
+// asks whether perm is granted on any database; "*" asks for all of them.
+func (r *Role) allows(dbName, perm string) bool {
+	for grantDB, perms := range r.Grants {
+		if grantDB != "*" && dbName != "" && grantDB != dbName {
+			continue
+		}
+		for _, p := range perms {
+			if p == perm || p == PermAdmin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadUsers loads users and roles from disk into memory.
+func (sm *StoreManager) LoadUsers() error {
+	users := make(map[string]*User)
+	roles := make(map[string]*Role)
+	err := sm.engine.IteratePrefix([]byte("USER:"), func(k, v []byte) error {
+		var u User
+		if err := json.Unmarshal(v, &u); err != nil {
+			return err
+		}
+		users[u.Name] = &u
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = sm.engine.IteratePrefix([]byte("ROLE:"), func(k, v []byte) error {
+		var r Role
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		roles[r.Name] = &r
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sm.authMu.Lock()
+	sm.users, sm.roles = users, roles
+	sm.authMu.Unlock()
+	return nil
+}
+
+// AuthEnabled reports whether connections must authenticate, which is the
+// case as soon as the first user exists.
+func (sm *StoreManager) AuthEnabled() bool {
+	sm.authMu.RLock()
+	defer sm.authMu.RUnlock()
+	return len(sm.users) > 0
+}
+
+// CreateUser adds a user. The first user must have the admin role, so the
+// store cannot lock everybody out.
+func (sm *StoreManager) CreateUser(name, password string, roles []string) error {
+	if name == "" || strings.ContainsAny(name, ":") {
+		return fmt.Errorf("%w: invalid user name %q", common.ErrInvalidInput, name)
+	}
+	if password == "" {
+		return fmt.Errorf("%w: password required", common.ErrInvalidInput)
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	sm.authMu.Lock()
+	defer sm.authMu.Unlock()
+
+	if _, ok := sm.users[name]; ok {
+		return fmt.Errorf("%w: user %s exists", common.ErrDuplicate, name)
+	}
+	if err := sm.checkRoles(roles); err != nil {
+		return err
+	}
+	if len(sm.users) == 0 && !containsString(roles, AdminRole) {
+		return fmt.Errorf("%w: the first user must have the %s role", common.ErrInvalidInput, AdminRole)
+	}
+	return sm.saveUser(&User{Name: name, PasswordHash: hash, Roles: roles})
+}
+
+// DropUser removes a user. The last user with the admin role cannot be dropped.
+func (sm *StoreManager) DropUser(name string) error {
+	sm.authMu.Lock()
+	defer sm.authMu.Unlock()
+
+	u, ok := sm.users[name]
+	if !ok {
+		return fmt.Errorf("user %s %w", name, common.ErrNotFound)
+	}
+	if err := sm.checkLastAdmin(u, nil); err != nil {
+		return err
+	}
+	if err := sm.engine.Delete(UserKey(name)); err != nil {
+		return err
+	}
+	delete(sm.users, name)
+	return nil
+}
+
+// SetUserPassword replaces the password of a user.
+func (sm *StoreManager) SetUserPassword(name, password string) error {
+	if password == "" {
+		return fmt.Errorf("%w: password required", common.ErrInvalidInput)
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return sm.updateUser(name, func(u *User) error {
+		u.PasswordHash = hash
+		return nil
+	})
+}
+
+// SetUserRoles replaces the roles of a user.
+func (sm *StoreManager) SetUserRoles(name string, roles []string) error {
+	return sm.updateUser(name, func(u *User) error {
+		if err := sm.checkRoles(roles); err != nil {
+			return err
+		}
+		if err := sm.checkLastAdmin(u, roles); err != nil {
+			return err
+		}
+		u.Roles = roles
+		return nil
+	})
+}
+
+// SetUserSubject sets the TLS client certificate subject that authenticates
+// as the user; an empty subject removes it.
+func (sm *StoreManager) SetUserSubject(name, subject string) error {
+	return sm.updateUser(name, func(u *User) error {
+		if subject != "" {
+			for _, other := range sm.users {
+				if other.Name != name && other.Subject == subject {
+					return fmt.Errorf("%w: subject already belongs to user %s", common.ErrDuplicate, other.Name)
+				}
+			}
+		}
+		u.Subject = subject
+		return nil
+	})
+}
+
+// updateUser applies change to a copy of the user and persists it.
+func (sm *StoreManager) updateUser(name string, change func(u *User) error) error {
+	sm.authMu.Lock()
+	defer sm.authMu.Unlock()
+
+	u, ok := sm.users[name]
+	if !ok {
+		return fmt.Errorf("user %s %w", name, common.ErrNotFound)
+	}
+	updated := *u
+	if err := change(&updated); err != nil {
+		return err
+	}
+	return sm.saveUser(&updated)
+}
+
+// saveUser persists a user and caches it. Caller must hold authMu.
+func (sm *StoreManager) saveUser(u *User) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	if err := sm.engine.Set(UserKey(u.Name), data); err != nil {
+		return err
+	}
+	sm.users[u.Name] = u
+	return nil
+}
+
+// checkRoles reports an error for roles that do not exist. Caller must hold authMu.
+func (sm *StoreManager) checkRoles(roles []string) error {
+	for _, r := range roles {
+		if _, ok := sm.roles[r]; !ok && r != AdminRole {
+			return fmt.Errorf("role %s %w", r, common.ErrNotFound)
+		}
+	}
+	return nil
+}
+
+// checkLastAdmin reports an error if giving u the roles newRoles (nil when
+// dropping u) would leave no user with the admin role. Caller must hold authMu.
+func (sm *StoreManager) checkLastAdmin(u *User, newRoles []string) error {
+	if !containsString(u.Roles, AdminRole) || containsString(newRoles, AdminRole) {
+		return nil
+	}
+	for _, other := range sm.users {
+		if other.Name != u.Name && containsString(other.Roles, AdminRole) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is the last user with the %s role", common.ErrInvalidInput, u.Name, AdminRole)
+}
+
+// Authenticate checks a user's password.
+func (sm *StoreManager) Authenticate(name, password string) error {
+	sm.authMu.RLock()
+	u, ok := sm.users[name]
+	sm.authMu.RUnlock()
+	if !ok || !VerifyPassword(password, u.PasswordHash) {
+		return common.ErrUnauthorized
+	}
+	return nil
+}
+
+// UserBySubject returns the name of the user bound to a TLS client
+// certificate subject, or "" if there is none.
+func (sm *StoreManager) UserBySubject(subject string) string {
+	if subject == "" {
+		return ""
+	}
+	sm.authMu.RLock()
+	defer sm.authMu.RUnlock()
+	for _, u := range sm.users {
+		if u.Subject == subject {
+			return u.Name
+		}
+	}
+	return ""
+}
+
+// Permits reports whether a user's roles grant perm on dbName. An empty
+// dbName asks whether perm is granted on any database.
+func (sm *StoreManager) Permits(userName, dbName, perm string) bool {
+	sm.authMu.RLock()
+	defer sm.authMu.RUnlock()
+
+	u, ok := sm.users[userName]
+	if !ok {
+		return false
+	}
+	for _, name := range u.Roles {
+		role := sm.roles[name]
+		if name == AdminRole {
+			role = builtinAdmin
+		}
+		if role != nil && role.allows(dbName, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListUsers returns all users, without their password hashes.
+func (sm *StoreManager) ListUsers() []User {
+	sm.authMu.RLock()
+	defer sm.authMu.RUnlock()
+
+	users := make([]User, 0, len(sm.users))
+	for _, u := range sm.users {
+		c := *u
+		c.PasswordHash = ""
+		users = append(users, c)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+// SetRole creates or replaces a role.
+func (sm *StoreManager) SetRole(role Role) error {
+	if role.Name == "" || role.Name == AdminRole || strings.ContainsAny(role.Name, ":") {
+		return fmt.Errorf("%w: invalid role name %q", common.ErrInvalidInput, role.Name)
+	}
+	for dbName, perms := range role.Grants {
+		for _, p := range perms {
+			switch p {
+			case PermRead, PermWrite, PermSchema:
+			case PermProtocol, PermAdmin:
+				if dbName != "*" {
+					return fmt.Errorf("%w: %s can only be granted on \"*\"", common.ErrInvalidInput, p)
+				}
+			default:
+				return fmt.Errorf("%w: unknown permission %q", common.ErrInvalidInput, p)
+			}
+		}
+	}
+
+	data, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+
+	sm.authMu.Lock()
+	defer sm.authMu.Unlock()
+	if err := sm.engine.Set(RoleKey(role.Name), data); err != nil {
+		return err
+	}
+	sm.roles[role.Name] = &role
+	return nil
+}
+
+// DropRole removes a role that no user has.
+func (sm *StoreManager) DropRole(name string) error {
+	sm.authMu.Lock()
+	defer sm.authMu.Unlock()
+
+	if _, ok := sm.roles[name]; !ok {
+		return fmt.Errorf("role %s %w", name, common.ErrNotFound)
+	}
+	for _, u := range sm.users {
+		if containsString(u.Roles, name) {
+			return fmt.Errorf("%w: role %s is used by user %s", common.ErrInvalidInput, name, u.Name)
+		}
+	}
+	if err := sm.engine.Delete(RoleKey(name)); err != nil {
+		return err
+	}
+	delete(sm.roles, name)
+	return nil
+}
+
+// ListRoles returns all roles, including the built-in admin role.
+func (sm *StoreManager) ListRoles() []Role {
+	sm.authMu.RLock()
+	defer sm.authMu.RUnlock()
+
+	roles := []Role{*builtinAdmin}
+	for _, r := range sm.roles {
+		roles = append(roles, *r)
+	}
+	sort.Slice(roles[1:], func(i, j int) bool { return roles[i+1].Name < roles[j+1].Name })
+	return roles
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
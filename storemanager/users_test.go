@@ -0,0 +1,100 @@
+package storemanager
+
+import (
+	"encoding/hex"
+	"errors"
+	"onql/common"
+	"onql/config"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2Vector(t *testing.T) {
+	// RFC 7914, section 11
+	got := hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64))
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got != want {
+		t.Fatalf("pbkdf2 = %s", got)
+	}
+}
+
+func TestUsersAndRoles(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	if sm.AuthEnabled() {
+		t.Fatal("auth enabled without users")
+	}
+	if err := sm.CreateUser("bob", "pw", nil); !errors.Is(err, common.ErrInvalidInput) {
+		t.Fatalf("first user without admin role: got %v", err)
+	}
+	if err := sm.CreateUser("root", "secret", []string{AdminRole}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if err := sm.SetRole(Role{Name: "shop_rw", Grants: map[string][]string{"shop": {PermRead, PermWrite}}}); err != nil {
+		t.Fatalf("SetRole failed: %v", err)
+	}
+	if err := sm.SetRole(Role{Name: "bad", Grants: map[string][]string{"shop": {PermProtocol}}}); err == nil {
+		t.Error("protocol granted on a single database")
+	}
+	if err := sm.CreateUser("bob", "pw", []string{"shop_rw"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	if err := sm.Authenticate("bob", "pw"); err != nil {
+		t.Errorf("Authenticate failed: %v", err)
+	}
+	if err := sm.Authenticate("bob", "wrong"); !errors.Is(err, common.ErrUnauthorized) {
+		t.Errorf("wrong password: got %v", err)
+	}
+
+	cases := []struct {
+		user, db, perm string
+		want           bool
+	}{
+		{"bob", "shop", PermWrite, true},
+		{"bob", "shop", PermSchema, false},
+		{"bob", "crm", PermRead, false},
+		{"bob", "", PermRead, true},
+		{"bob", "*", PermRead, false},
+		{"root", "crm", PermSchema, true},
+		{"root", "*", PermProtocol, true},
+		{"nobody", "shop", PermRead, false},
+	}
+	for _, c := range cases {
+		if got := sm.Permits(c.user, c.db, c.perm); got != c.want {
+			t.Errorf("Permits(%s, %q, %s) = %v", c.user, c.db, c.perm, got)
+		}
+	}
+
+	if err := sm.DropUser("root"); err == nil {
+		t.Error("dropped the last admin")
+	}
+	if err := sm.SetUserRoles("root", []string{"shop_rw"}); err == nil {
+		t.Error("removed the admin role from the last admin")
+	}
+	if err := sm.DropRole("shop_rw"); err == nil {
+		t.Error("dropped a role in use")
+	}
+
+	if err := sm.SetUserSubject("bob", "CN=bob"); err != nil {
+		t.Fatalf("SetUserSubject failed: %v", err)
+	}
+	if got := sm.UserBySubject("CN=bob"); got != "bob" {
+		t.Errorf("UserBySubject = %q", got)
+	}
+
+	// Users survive a restart
+	if err := sm.LoadUsers(); err != nil {
+		t.Fatalf("LoadUsers failed: %v", err)
+	}
+	if !sm.Permits("bob", "shop", PermRead) || sm.Authenticate("root", "secret") != nil {
+		t.Error("users not reloaded")
+	}
+	for _, u := range sm.ListUsers() {
+		if u.PasswordHash != "" {
+			t.Errorf("ListUsers leaks the password hash of %s", u.Name)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package storemanager
+
+import (
+	"context"
+	"onql/config"
+	"testing"
+	"time"
+)
+
+func TestRowVersions(t *testing.T) {
+	engine := NewMockEngine()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour})
+	defer sm.Close()
+
+	dbName := "verdb"
+	tableName := "items"
+	sm.CreateDatabase(dbName)
+	err := sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":  {Name: "id", Type: TypeString},
+			"qty": {Name: "qty", Type: TypeNumber, Indexed: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	version := func(pk string) uint64 {
+		row, err := sm.Get(dbName, tableName, pk)
+		if err != nil {
+			t.Fatalf("Get %s failed: %v", pk, err)
+		}
+		return row.Version
+	}
+
+	sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "a", "qty": 1.0}})
+	if v := version("a"); v != 1 {
+		t.Errorf("after insert: version %d, want 1", v)
+	}
+	sm.Update(dbName, tableName, "a", Row{Data: map[string]interface{}{"id": "a", "qty": 2.0}})
+	sm.Flush()
+	sm.Update(dbName, tableName, "a", Row{Data: map[string]interface{}{"id": "a", "qty": 3.0}})
+	if v := version("a"); v != 3 {
+		t.Errorf("after two updates: version %d, want 3", v)
+	}
+
+	rows, err := sm.GetDataByPKs(context.Background(), dbName, tableName, []string{"a"})
+	if err != nil || len(rows) != 1 || rows[0]["qty"] != 3.0 {
+		t.Errorf("GetDataByPKs: got %v, %v", rows, err)
+	}
+	if _, ok := rows[0][VersionField]; ok {
+		t.Errorf("GetDataByPKs added %s to the row", VersionField)
+	}
+
+	// Rows stored as plain JSON before versions read as version 0
+	dbID, table, _ := sm.GetTableSchema(dbName, tableName)
+	engine.Set(DataKey(dbID, table.ID, "old"), []byte(`{"id":"old","qty":5}`))
+	if v := version("old"); v != 0 {
+		t.Errorf("legacy row: version %d, want 0", v)
+	}
+	sm.Update(dbName, tableName, "old", Row{Data: map[string]interface{}{"id": "old", "qty": 6.0}})
+	if v := version("old"); v != 1 {
+		t.Errorf("updated legacy row: version %d, want 1", v)
+	}
+	if pks, _ := sm.GetPkByIndex(context.Background(), dbName, tableName, "qty", "6"); len(pks) != 1 {
+		t.Errorf("index of updated legacy row: got %v", pks)
+	}
+}
@@ -0,0 +1,565 @@
+/*
+Business Source License 1.1
+
+Parameters
+Licensor:             Autobit Software Services Private Limited
+Licensed Work:        ONQL (Database Engine)
+The Licensed Work is (c) 2025 Autobit Software Services Private Limited.
+Change Date:          2028-01-01
+Change License:       GNU General Public License, version 3 or later
+
+Terms
+The Business Source License (this “License”) grants you the right to copy,
+modify, and redistribute the Licensed Work, provided that you do not use the
+Licensed Work for a Commercial Use.
+
+“Commercial Use” means offering the Licensed Work to third parties as a
+paid service, product, or part of a service or product for which you or a
+third party receives payment or other consideration.
+
+You may make use of the Licensed Work for internal use, research, evaluation,
+education, and non-commercial purposes, and you may contribute modifications
+back to the Licensor under the same License.
+
+Before the Change Date, use of the Licensed Work in violation of this License
+automatically terminates your rights.  After the Change Date, the Licensed Work
+will be governed by the Change License.
+
+The Licensor may make an Additional Use Grant allowing specific commercial
+uses by prior written permission.
+
+THE LICENSED WORK IS PROVIDED “AS IS” AND WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE, OR NON-INFRINGEMENT.
+
+This License does not grant trademark rights.  The ONQL name and logo are
+trademarks of Autobit Software Services Private Limited and may not be used
+without written permission.
+
+For more details see: https://mariadb.com/bsl11/
+*/
+
+package storemanager
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"onql/logger"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncMode controls when the write-ahead log is fsynced relative to acknowledging a write.
+type SyncMode string
+
+const (
+	// SyncAlways fsyncs before every write is acknowledged.
+	// Concurrent writers that arrive during an fsync share the next one.
+	SyncAlways SyncMode = "always"
+	// SyncGroup hands fsyncs to a background committer which batches all
+	// writers waiting at that moment into a single fsync.
+	SyncGroup SyncMode = "group"
+	// SyncInterval acknowledges writes immediately and fsyncs on a timer.
+	// A crash can lose up to one interval of acknowledged writes.
+	SyncInterval SyncMode = "interval"
+)
+
+const walSegmentExt = ".wal"
+
+var walCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errWALCorrupt is returned while decoding a frame that is truncated or fails its checksum.
+var errWALCorrupt = errors.New("wal: corrupt frame")
+
+// WAL is an append-only, checksummed log of buffer operations.
+// Every batch applied to the Buffer is appended here before it becomes visible,
+// so that acknowledged writes survive a crash between flushes.
+//
+// The log is split into numbered segments. A flush seals the active segment and
+// opens the next one; once the flushed data is safely in the engine, all sealed
+// segments up to that point are removed.
+//
+// Frame layout (little endian):
+//
+//	[4 body length][4 crc32c(body)][body]
+//	body = [4 op count] { [1 flags][4 key len][key][4 value len][value] }...
+type WAL struct {
+	dir      string
+	mode     SyncMode
+	interval time.Duration
+
+	mu      sync.Mutex // guards file, segment and lsn
+	file    *os.File
+	segment uint64
+	lsn     uint64 // sequence number of the last appended frame
+
+	syncMu sync.Mutex // serializes fsync and segment rotation
+	cond   *sync.Cond // signalled (with syncMu held) whenever synced advances
+	synced uint64     // highest lsn known to be durable
+	err    error      // sticky fsync error
+	closed bool
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// OpenWAL opens (or creates) the write-ahead log in dir.
+// Existing segments are left untouched so they can be replayed; new appends go
+// to a fresh segment numbered after the newest existing one.
+func OpenWAL(dir string, mode SyncMode, interval time.Duration) (*WAL, error) {
+	switch mode {
+	case SyncAlways, SyncGroup, SyncInterval:
+	case "":
+		mode = SyncAlways
+	default:
+		return nil, fmt.Errorf("unknown wal sync mode %q", mode)
+	}
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	segments, err := listWALSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	next := uint64(1)
+	if len(segments) > 0 {
+		next = segments[len(segments)-1] + 1
+	}
+
+	w := &WAL{
+		dir:      dir,
+		mode:     mode,
+		interval: interval,
+		kick:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.syncMu)
+	if err := w.openSegment(next); err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case SyncGroup:
+		w.wg.Add(1)
+		go w.groupCommitter()
+	case SyncInterval:
+		w.wg.Add(1)
+		go w.intervalSyncer()
+	}
+	return w, nil
+}
+
+// Replay decodes every complete frame in the segments that precede the active one,
+// oldest first, and hands each batch to fn. A torn frame, as left by a crash
+// during a write, is only accepted as the final frame of the newest of these
+// segments. Anywhere else a bad frame fails the replay, so the segments are kept.
+func (w *WAL) Replay(fn func(ops []BufferOp)) (int, error) {
+	w.mu.Lock()
+	active := w.segment
+	w.mu.Unlock()
+
+	segments, err := listWALSegments(w.dir)
+	if err != nil {
+		return 0, err
+	}
+	// Empty segments left by runs that wrote nothing do not count as newest
+	var replayed []uint64
+	newest := uint64(0)
+	for _, seg := range segments {
+		if seg >= active {
+			break
+		}
+		replayed = append(replayed, seg)
+		if info, err := os.Stat(w.segmentPath(seg)); err == nil && info.Size() > 0 {
+			newest = seg
+		}
+	}
+
+	frames := 0
+	for _, seg := range replayed {
+		n, err := w.replaySegment(seg, seg == newest, fn)
+		frames += n
+		if err != nil {
+			return frames, fmt.Errorf("segment %d: %w", seg, err)
+		}
+	}
+	return frames, nil
+}
+
+// replaySegment hands the frames of segment seg to fn. With newest set a bad
+// frame that runs to the end of the file is taken as torn and ends the segment.
+func (w *WAL) replaySegment(seg uint64, newest bool, fn func(ops []BufferOp)) (int, error) {
+	f, err := os.Open(w.segmentPath(seg))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	r := &countingReader{r: bufio.NewReader(f)}
+	frames := 0
+	for {
+		start := r.n
+		ops, err := readWALFrame(r)
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			if newest && tornTail(f, start, info.Size()) {
+				logger.Warn("WAL replay dropped a torn frame at the end of segment %d after %d frames", seg, frames)
+				return frames, nil
+			}
+			return frames, fmt.Errorf("frame at offset %d: %w", start, err)
+		}
+		fn(ops)
+		frames++
+	}
+}
+
+// tornTail reports whether the frame at offset start of f, a file of size
+// bytes, is its last one: its header is incomplete or its body reaches the end.
+func tornTail(f *os.File, start, size int64) bool {
+	var header [8]byte
+	if _, err := f.ReadAt(header[:], start); err != nil {
+		return true
+	}
+	return start+8+int64(binary.LittleEndian.Uint32(header[0:])) >= size
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// TruncateReplayed removes the segments that preceded the active one when the WAL
+// was opened. Call it once their replayed contents have been persisted.
+func (w *WAL) TruncateReplayed() error {
+	w.mu.Lock()
+	active := w.segment
+	w.mu.Unlock()
+	return w.Truncate(active - 1)
+}
+
+// Append writes a batch of operations to the active segment and returns its sequence number.
+// The frame is handed to the OS but not necessarily durable; call WaitDurable to honour the sync mode.
+func (w *WAL) Append(ops []BufferOp) (uint64, error) {
+	frame := encodeWALFrame(ops)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, errors.New("wal is closed")
+	}
+	if _, err := w.file.Write(frame); err != nil {
+		return 0, err
+	}
+	w.lsn++
+	return w.lsn, nil
+}
+
+// WaitDurable blocks until the frame with sequence number lsn is durable according to the sync mode.
+func (w *WAL) WaitDurable(lsn uint64) error {
+	switch w.mode {
+	case SyncAlways:
+		return w.syncTo(lsn)
+	case SyncGroup:
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+		w.syncMu.Lock()
+		defer w.syncMu.Unlock()
+		for w.synced < lsn && w.err == nil && !w.closed {
+			w.cond.Wait()
+		}
+		if w.synced >= lsn {
+			return nil
+		}
+		if w.err != nil {
+			return w.err
+		}
+		return errors.New("wal is closed")
+	default:
+		return nil
+	}
+}
+
+// Rotate seals the active segment and starts a new one.
+// It returns the number of the sealed segment, which can be passed to Truncate
+// once everything logged so far has been persisted elsewhere.
+func (w *WAL) Rotate() (uint64, error) {
+	w.syncMu.Lock()
+	defer w.syncMu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, errors.New("wal is closed")
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	sealed := w.segment
+	old := w.file
+	if err := w.openSegment(sealed + 1); err != nil {
+		return 0, err
+	}
+	old.Close()
+
+	w.synced = w.lsn
+	w.cond.Broadcast()
+	return sealed, nil
+}
+
+// Truncate removes every sealed segment numbered upTo or lower.
+func (w *WAL) Truncate(upTo uint64) error {
+	segments, err := listWALSegments(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if seg > upTo {
+			break
+		}
+		if err := os.Remove(w.segmentPath(seg)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close syncs and closes the active segment and stops any background syncer.
+func (w *WAL) Close() error {
+	close(w.done)
+	w.wg.Wait()
+
+	w.syncMu.Lock()
+	defer w.syncMu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	w.synced = w.lsn
+	w.closed = true
+	w.cond.Broadcast()
+	return err
+}
+
+// syncTo fsyncs the active segment unless lsn is already durable.
+// Everything appended before the fsync starts becomes durable with it.
+func (w *WAL) syncTo(lsn uint64) error {
+	w.syncMu.Lock()
+	defer w.syncMu.Unlock()
+
+	if w.synced >= lsn {
+		return nil
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	w.mu.Lock()
+	target := w.lsn
+	f := w.file
+	w.mu.Unlock()
+	if f == nil {
+		return errors.New("wal is closed")
+	}
+
+	if err := f.Sync(); err != nil {
+		w.err = err
+		w.cond.Broadcast()
+		return err
+	}
+	w.synced = target
+	w.cond.Broadcast()
+	return nil
+}
+
+// groupCommitter performs one fsync for every batch of writers waiting in SyncGroup mode.
+func (w *WAL) groupCommitter() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.kick:
+			w.mu.Lock()
+			lsn := w.lsn
+			w.mu.Unlock()
+			if err := w.syncTo(lsn); err != nil {
+				logger.Error("WAL group commit failed: %v", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// intervalSyncer fsyncs the active segment periodically in SyncInterval mode.
+func (w *WAL) intervalSyncer() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			lsn := w.lsn
+			w.mu.Unlock()
+			if err := w.syncTo(lsn); err != nil {
+				logger.Error("WAL interval sync failed: %v", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// openSegment creates segment id and makes it the active one. Caller must hold w.mu (or own w exclusively).
+func (w *WAL) openSegment(id uint64) error {
+	f, err := os.OpenFile(w.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.segment = id
+	return nil
+}
+
+func (w *WAL) segmentPath(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", id, walSegmentExt))
+}
+
+// listWALSegments returns the segment numbers present in dir in ascending order.
+func listWALSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, id)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func encodeWALFrame(ops []BufferOp) []byte {
+	size := 4
+	for _, op := range ops {
+		size += 1 + 4 + len(op.Key) + 4 + len(op.Value)
+	}
+	frame := make([]byte, 8+size)
+	body := frame[8:]
+
+	binary.LittleEndian.PutUint32(body[0:], uint32(len(ops)))
+	off := 4
+	for _, op := range ops {
+		if op.IsDeleted {
+			body[off] = 1
+		}
+		off++
+		binary.LittleEndian.PutUint32(body[off:], uint32(len(op.Key)))
+		off += 4
+		off += copy(body[off:], op.Key)
+		binary.LittleEndian.PutUint32(body[off:], uint32(len(op.Value)))
+		off += 4
+		off += copy(body[off:], op.Value)
+	}
+
+	binary.LittleEndian.PutUint32(frame[0:], uint32(size))
+	binary.LittleEndian.PutUint32(frame[4:], crc32.Checksum(body, walCRCTable))
+	return frame
+}
+
+// readWALFrame reads one frame from r. It returns io.EOF only on a clean frame boundary.
+func readWALFrame(r io.Reader) ([]BufferOp, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errWALCorrupt
+	}
+	size := binary.LittleEndian.Uint32(header[0:])
+	sum := binary.LittleEndian.Uint32(header[4:])
+	if size < 4 {
+		return nil, errWALCorrupt
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, errWALCorrupt
+	}
+	if crc32.Checksum(body, walCRCTable) != sum {
+		return nil, errWALCorrupt
+	}
+
+	count := binary.LittleEndian.Uint32(body[0:])
+	ops := make([]BufferOp, 0, count)
+	off := uint32(4)
+	for i := uint32(0); i < count; i++ {
+		if off+5 > size {
+			return nil, errWALCorrupt
+		}
+		deleted := body[off] == 1
+		off++
+		keyLen := binary.LittleEndian.Uint32(body[off:])
+		off += 4
+		if off+keyLen+4 > size {
+			return nil, errWALCorrupt
+		}
+		key := string(body[off : off+keyLen])
+		off += keyLen
+		valLen := binary.LittleEndian.Uint32(body[off:])
+		off += 4
+		if off+valLen > size {
+			return nil, errWALCorrupt
+		}
+		var val []byte
+		if !deleted {
+			val = body[off : off+valLen]
+		}
+		off += valLen
+		ops = append(ops, BufferOp{Key: key, Value: val, IsDeleted: deleted})
+	}
+	return ops, nil
+}
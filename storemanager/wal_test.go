@@ -0,0 +1,200 @@
+package storemanager
+
+import (
+	"context"
+	"fmt"
+	"onql/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWALReplayAfterCrash(t *testing.T) {
+	engine := NewMockEngine()
+	walDir := t.TempDir()
+	// A long flush interval keeps writes in the buffer, as if the process died before a flush.
+	cfg := &config.Config{FlushInterval: time.Hour, WALDir: walDir, WALSyncMode: "always"}
+	sm := newTestStore(t, engine, cfg)
+
+	dbName := "waldb"
+	tableName := "users"
+	if err := sm.CreateDatabase(dbName); err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	err := sm.CreateTable(dbName, Table{
+		Name: tableName,
+		PK:   "id",
+		Columns: map[string]*Column{
+			"id":   {Name: "id", Type: TypeString, Indexed: true},
+			"name": {Name: "name", Type: TypeString, Indexed: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	if err := sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "u1", "name": "Alice"}}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := sm.Insert(dbName, tableName, Row{Data: map[string]interface{}{"id": "u2", "name": "Bob"}}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := sm.Delete(dbName, tableName, "u2"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// Simulate a torn write at the tail of the log.
+	segments, err := listWALSegments(walDir)
+	if err != nil || len(segments) == 0 {
+		t.Fatalf("expected WAL segments, got %v (%v)", segments, err)
+	}
+	f, err := os.OpenFile(sm.buffer.wal.segmentPath(segments[len(segments)-1]), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open segment: %v", err)
+	}
+	f.Write([]byte{0x20, 0x00, 0x00})
+	f.Close()
+
+	// "Restart" on the same engine without flushing or closing the first instance.
+	sm2 := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour, WALDir: walDir, WALSyncMode: "group"})
+	defer sm2.Close()
+
+	row, err := sm2.Get(dbName, tableName, "u1")
+	if err != nil {
+		t.Fatalf("row u1 not recovered: %v", err)
+	}
+	if row.Data["name"] != "Alice" {
+		t.Errorf("recovered row mismatch: %v", row.Data)
+	}
+	if _, err := sm2.Get(dbName, tableName, "u2"); err == nil {
+		t.Errorf("deleted row u2 was resurrected by replay")
+	}
+	pks, err := sm2.GetPkByIndex(context.Background(), dbName, tableName, "name", "Alice")
+	if err != nil || len(pks) != 1 || pks[0] != "u1" {
+		t.Errorf("index not recovered: %v (%v)", pks, err)
+	}
+
+	// Replay is persisted to the engine and the old segments are truncated.
+	segments, _ = listWALSegments(walDir)
+	if len(segments) != 1 {
+		t.Errorf("expected only the active segment after replay, got %v", segments)
+	}
+}
+
+// failingEngine rejects batch writes while fail is set.
+type failingEngine struct {
+	*MockEngine
+	fail bool
+}
+
+func (f *failingEngine) BatchSet(keys, values [][]byte) error {
+	if f.fail {
+		return os.ErrDeadlineExceeded
+	}
+	return f.MockEngine.BatchSet(keys, values)
+}
+
+func TestFlushFailureKeepsWrites(t *testing.T) {
+	engine := &failingEngine{MockEngine: NewMockEngine()}
+	walDir := t.TempDir()
+	sm := newTestStore(t, engine, &config.Config{FlushInterval: time.Hour, WALDir: walDir, WALSyncMode: "always"})
+
+	if err := sm.CreateDatabase("fdb"); err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	err := sm.CreateTable("fdb", Table{
+		Name:    "items",
+		PK:      "id",
+		Columns: map[string]*Column{"id": {Name: "id", Type: TypeString}},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	if err := sm.Insert("fdb", "items", Row{Data: map[string]interface{}{"id": "a"}}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	engine.fail = true
+	if err := sm.Flush(); err == nil {
+		t.Fatalf("expected flush to fail")
+	}
+	if _, err := sm.Get("fdb", "items", "a"); err != nil {
+		t.Fatalf("row lost from buffer after failed flush: %v", err)
+	}
+
+	// A later successful flush persists the row before truncating the log.
+	engine.fail = false
+	if err := sm.Insert("fdb", "items", Row{Data: map[string]interface{}{"id": "b"}}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := sm.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	sm.Close()
+
+	sm2 := newTestStore(t, engine.MockEngine, &config.Config{FlushInterval: time.Hour, WALDir: walDir})
+	defer sm2.Close()
+	for _, pk := range []string{"a", "b"} {
+		if _, err := sm2.Get("fdb", "items", pk); err != nil {
+			t.Errorf("row %s lost: %v", pk, err)
+		}
+	}
+}
+
+func TestNewFailsWithoutWAL(t *testing.T) {
+	// A file where the WAL directory should be
+	walDir := filepath.Join(t.TempDir(), "wal")
+	if err := os.WriteFile(walDir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(NewMockEngine(), &config.Config{FlushInterval: time.Hour, WALDir: walDir}); err == nil {
+		t.Errorf("New succeeded without a usable WAL")
+	}
+}
+
+func TestWALReplayRejectsCorruptSegment(t *testing.T) {
+	walDir := t.TempDir()
+	ops := []BufferOp{{Key: "k", Value: []byte("v")}}
+	// Two segments of two frames each, from two runs
+	for run := 0; run < 2; run++ {
+		w, err := OpenWAL(walDir, SyncAlways, 0)
+		if err != nil {
+			t.Fatalf("OpenWAL failed: %v", err)
+		}
+		w.Append(ops)
+		w.Append(ops)
+		w.Close()
+	}
+	segments, _ := listWALSegments(walDir)
+	if len(segments) != 2 {
+		t.Fatalf("expected two segments, got %v", segments)
+	}
+	replay := func() (int, error) {
+		w, err := OpenWAL(walDir, SyncAlways, 0)
+		if err != nil {
+			t.Fatalf("OpenWAL failed: %v", err)
+		}
+		defer w.Close()
+		return w.Replay(func([]BufferOp) {})
+	}
+
+	// A torn frame at the end of the newest segment is dropped
+	path := (&WAL{dir: walDir}).segmentPath(segments[1])
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	f.Write([]byte{0x20, 0x00, 0x00})
+	f.Close()
+	if frames, err := replay(); err != nil || frames != 4 {
+		t.Errorf("replay with a torn tail: %d frames, %v", frames, err)
+	}
+
+	// A bad frame in an older segment fails the replay
+	path = (&WAL{dir: walDir}).segmentPath(segments[0])
+	data, _ := os.ReadFile(path)
+	data[10] ^= 0xFF
+	os.WriteFile(path, data, 0o644)
+	if _, err := replay(); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("segment %d:", segments[0])) {
+		t.Errorf("replay with a corrupt frame in an older segment: got %v", err)
+	}
+}